@@ -0,0 +1,193 @@
+// Package certs generates a certificate authority and node certificates to
+// run a local network over mutual TLS. They are meant for development only.
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	caValidity   = time.Hour * 24 * 365 * 5
+	certValidity = time.Hour * 24 * 365
+)
+
+// DefaultHosts are put in every node certificate, so nodes on the local
+// machine can verify each other.
+var DefaultHosts = []string{"localhost", "127.0.0.1", "::1"}
+
+type CA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func NewCA(name string) (*CA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &CA{cert: cert, key: key}, nil
+}
+
+// LoadCA reads a CA written with CA.Save.
+func LoadCA(certFile, keyFile string) (*CA, error) {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+	if certBlock == nil || keyBlock == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return &CA{cert: cert, key: key}, nil
+}
+
+// CertPEM returns the certificate of the CA, which nodes verify each other
+// with.
+func (ca *CA) CertPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+}
+
+func (ca *CA) Save(certFile, keyFile string) error {
+	keyPEM, err := encodeKey(ca.key)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(certFile, ca.CertPEM(), 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(keyFile, keyPEM, 0600)
+}
+
+// Issue returns a certificate and key for a node reachable under the given
+// host names and IP addresses. The certificate is valid for both ends of a
+// connection, so it serves as client certificate for mutual TLS too.
+func (ca *CA) Issue(name string, hosts []string) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(certValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err = encodeKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), keyPEM, nil
+}
+
+// WriteDevCerts writes ca.crt and ca.key to dir, reusing the CA found there,
+// and a <name>.crt and <name>.key pair for every node valid for
+// DefaultHosts and the extra hosts.
+func WriteDevCerts(dir string, nodes []string, hosts []string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	var (
+		caCert = filepath.Join(dir, "ca.crt")
+		caKey  = filepath.Join(dir, "ca.key")
+	)
+	ca, err := LoadCA(caCert, caKey)
+	if errors.Is(err, os.ErrNotExist) {
+		if ca, err = NewCA("GoBlocker dev CA"); err != nil {
+			return err
+		}
+		err = ca.Save(caCert, caKey)
+	}
+	if err != nil {
+		return err
+	}
+
+	hosts = append(append([]string{}, DefaultHosts...), hosts...)
+	for _, name := range nodes {
+		certPEM, keyPEM, err := ca.Issue(name, hosts)
+		if err != nil {
+			return fmt.Errorf("issuing certificate for %s: %w", name, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name+".crt"), certPEM, 0644); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, name+".key"), keyPEM, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+func randomSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
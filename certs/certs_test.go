@@ -0,0 +1,64 @@
+package certs
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parseCert(t *testing.T, b []byte) *x509.Certificate {
+	block, _ := pem.Decode(b)
+	require.NotNil(t, block)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	require.Nil(t, err)
+	return cert
+}
+
+func TestIssue(t *testing.T) {
+	ca, err := NewCA("test CA")
+	require.Nil(t, err)
+	certPEM, _, err := ca.Issue("node", []string{"localhost", "10.0.0.1"})
+	require.Nil(t, err)
+
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(ca.CertPEM()))
+	cert := parseCert(t, certPEM)
+	for _, host := range []string{"localhost", "10.0.0.1"} {
+		_, err = cert.Verify(x509.VerifyOptions{
+			DNSName:   host,
+			Roots:     roots,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		})
+		assert.Nil(t, err, host)
+	}
+	_, err = cert.Verify(x509.VerifyOptions{DNSName: "example.com", Roots: roots})
+	assert.NotNil(t, err)
+}
+
+func TestWriteDevCertsReusesCA(t *testing.T) {
+	dir := t.TempDir()
+	require.Nil(t, WriteDevCerts(dir, []string{"a"}, nil))
+	caPEM, err := os.ReadFile(filepath.Join(dir, "ca.crt"))
+	require.Nil(t, err)
+
+	require.Nil(t, WriteDevCerts(dir, []string{"b"}, []string{"node.example"}))
+	again, err := os.ReadFile(filepath.Join(dir, "ca.crt"))
+	require.Nil(t, err)
+	assert.Equal(t, caPEM, again)
+
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(caPEM))
+	for _, name := range []string{"a", "b"} {
+		b, err := os.ReadFile(filepath.Join(dir, name+".crt"))
+		require.Nil(t, err)
+		_, err = parseCert(t, b).Verify(x509.VerifyOptions{DNSName: "127.0.0.1", Roots: roots})
+		assert.Nil(t, err, name)
+		_, err = os.Stat(filepath.Join(dir, name+".key"))
+		assert.Nil(t, err)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/LDM-A/GoBlocker/crypto"
+)
+
+func main() {
+	var (
+		dir       = flag.String("dir", "frost", "directory to write the group and the key shares to")
+		threshold = flag.Int("threshold", 2, "number of participants needed to sign")
+		n         = flag.Int("n", 3, "number of participants")
+	)
+	flag.Parse()
+
+	group, shares, err := crypto.GenerateThresholdKey(*threshold, *n)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.MkdirAll(*dir, 0700); err != nil {
+		log.Fatal(err)
+	}
+	b, err := json.MarshalIndent(group, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(*dir, "group.json"), b, 0644); err != nil {
+		log.Fatal(err)
+	}
+	for _, share := range shares {
+		file := filepath.Join(*dir, fmt.Sprintf("share_%d.key", share.Index))
+		if err := os.WriteFile(file, []byte(hex.EncodeToString(share.Bytes())+"\n"), 0600); err != nil {
+			log.Fatal(err)
+		}
+	}
+	log.Printf("wrote a %d-of-%d group key to %s, hand each share to its participant and delete it here", *threshold, *n, *dir)
+}
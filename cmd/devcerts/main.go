@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"strings"
+
+	"github.com/LDM-A/GoBlocker/certs"
+)
+
+func main() {
+	var (
+		dir   = flag.String("dir", "tls", "directory to write the certificates to")
+		nodes = flag.String("nodes", "node", "comma separated names of the nodes to issue certificates for")
+		hosts = flag.String("hosts", "", "comma separated host names and IPs to add to the node certificates")
+	)
+	flag.Parse()
+
+	extra := []string{}
+	if *hosts != "" {
+		extra = strings.Split(*hosts, ",")
+	}
+	if err := certs.WriteDevCerts(*dir, strings.Split(*nodes, ","), extra); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("wrote dev certificates to %s", *dir)
+}
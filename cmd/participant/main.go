@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/LDM-A/GoBlocker/crypto"
+	"github.com/LDM-A/GoBlocker/node"
+	"github.com/LDM-A/GoBlocker/signer"
+	"google.golang.org/grpc"
+)
+
+func main() {
+	var (
+		listenAddr = flag.String("listen", ":7000", "address to listen on")
+		shareFile  = flag.String("share-file", "", "file holding the hex encoded key share, - reads it from stdin")
+		stateFile  = flag.String("state", "participant_state.json", "file used to persist the last signed height")
+		certFile   = flag.String("cert", "", "TLS certificate of the participant")
+		keyFile    = flag.String("key", "", "TLS key of the participant")
+		caFile     = flag.String("ca", "", "CA of the nodes allowed to request signatures")
+	)
+	flag.Parse()
+
+	if *shareFile == "" {
+		log.Fatal("a key share file is required")
+	}
+	b, err := signer.ReadSecret(*shareFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	share, err := crypto.KeyShareFromBytes(b)
+	if err != nil {
+		log.Fatal(err)
+	}
+	server, err := signer.NewParticipantServer(share, *stateFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	opts := []grpc.ServerOption{}
+	if *certFile != "" {
+		tlsConfig := &node.TLSConfig{CertFile: *certFile, KeyFile: *keyFile, CAFile: *caFile, RequireClientCert: true}
+		opt, err := tlsConfig.ServerOption()
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, opt)
+	} else {
+		log.Print("TLS is disabled, anyone reaching the participant can request signatures")
+	}
+	log.Printf("participant %d listening on %s", share.Index, *listenAddr)
+	log.Fatal(server.Serve(*listenAddr, opts...))
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/LDM-A/GoBlocker/crypto"
+	"github.com/LDM-A/GoBlocker/signer"
+)
+
+func main() {
+	var (
+		socketPath = flag.String("socket", "/tmp/goblocker-signer.sock", "unix socket to listen on")
+		seedFile   = flag.String("seed-file", "", "file holding the hex encoded 32 byte seed of the validator key, - reads it from stdin")
+		stateFile  = flag.String("state", "signer_state.json", "file used to persist the last signed height")
+	)
+	flag.Parse()
+
+	if *seedFile == "" {
+		log.Fatal("a validator seed file is required")
+	}
+	seed, err := signer.ReadSecret(*seedFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(seed) != crypto.SeedLen {
+		log.Fatalf("seed must be %d bytes", crypto.SeedLen)
+	}
+	server, err := signer.NewServer(crypto.NewPrivateKeyFromSeed(seed), *stateFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("signer listening on %s", *socketPath)
+	log.Fatal(server.Serve(*socketPath))
+}
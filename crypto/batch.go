@@ -0,0 +1,160 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"errors"
+	"io"
+
+	"filippo.io/edwards25519"
+)
+
+// All signatures of the chain, of transactions as well as blocks, are
+// checked with the cofactored ed25519 equation [8][s]B = [8]R + [8][k]A.
+// Unlike the cofactorless check done by ed25519.Verify, it gives the same
+// answer whether a signature is verified on its own or as part of a batch,
+// so nodes can never disagree on validity depending on how they happened to
+// verify a block. Public keys and R values of small order are rejected, as
+// the cofactor would wipe them out of the equation.
+
+var errSmallOrder = errors.New("small order point")
+
+type batchEntry struct {
+	pubKey []byte
+	msg    []byte
+	sig    []byte
+}
+
+// BatchVerifier verifies many ed25519 signatures with a single multi-scalar
+// multiplication. It is not safe for concurrent use.
+type BatchVerifier struct {
+	entries []batchEntry
+}
+
+func NewBatchVerifier() *BatchVerifier {
+	return &BatchVerifier{}
+}
+
+func (v *BatchVerifier) Add(pubKey *PublicKey, msg []byte, sig *Signature) {
+	v.entries = append(v.entries, batchEntry{
+		pubKey: pubKey.Bytes(),
+		msg:    msg,
+		sig:    sig.Bytes(),
+	})
+}
+
+func (v *BatchVerifier) Len() int {
+	return len(v.entries)
+}
+
+// Verify reports whether every signature in the batch is valid. When the
+// batch fails, each signature is checked on its own and the second return
+// value tells which ones are valid.
+func (v *BatchVerifier) Verify() (bool, []bool) {
+	valid := make([]bool, len(v.entries))
+	if len(v.entries) == 0 {
+		return true, valid
+	}
+
+	var (
+		n       = len(v.entries)
+		scalars = make([]*edwards25519.Scalar, 0, 2*n+1)
+		points  = make([]*edwards25519.Point, 0, 2*n+1)
+		sumS    = edwards25519.NewScalar()
+		ok      = true
+	)
+	for _, e := range v.entries {
+		R, A, s, k, err := e.decode()
+		if err != nil {
+			ok = false
+			break
+		}
+		z := randomBatchScalar()
+		sumS.MultiplyAdd(z, s, sumS)
+		scalars = append(scalars, z, new(edwards25519.Scalar).Multiply(z, k))
+		points = append(points, R, A)
+	}
+
+	if ok {
+		// sum(z_i * R_i) + sum(z_i * k_i * A_i) - sum(z_i * s_i) * B
+		scalars = append(scalars, sumS.Negate(sumS))
+		points = append(points, edwards25519.NewGeneratorPoint())
+		check := new(edwards25519.Point).VarTimeMultiScalarMult(scalars, points)
+		if check.MultByCofactor(check).Equal(edwards25519.NewIdentityPoint()) == 1 {
+			for i := range valid {
+				valid[i] = true
+			}
+			return true, valid
+		}
+	}
+
+	allValid := true
+	for i, e := range v.entries {
+		valid[i] = e.verify()
+		allValid = allValid && valid[i]
+	}
+	return allValid, valid
+}
+
+// VerifyCofactored checks a single signature with the same equation used by
+// BatchVerifier.
+func VerifyCofactored(pubKey *PublicKey, msg []byte, sig *Signature) bool {
+	e := batchEntry{
+		pubKey: pubKey.Bytes(),
+		msg:    msg,
+		sig:    sig.Bytes(),
+	}
+	return e.verify()
+}
+
+func (e batchEntry) verify() bool {
+	R, A, s, k, err := e.decode()
+	if err != nil {
+		return false
+	}
+	// [s]B - [k]A - R
+	check := new(edwards25519.Point).VarTimeDoubleScalarBaseMult(k, new(edwards25519.Point).Negate(A), s)
+	check.Subtract(check, R)
+
+	return check.MultByCofactor(check).Equal(edwards25519.NewIdentityPoint()) == 1
+}
+
+func (e batchEntry) decode() (R, A *edwards25519.Point, s, k *edwards25519.Scalar, err error) {
+	if A, err = new(edwards25519.Point).SetBytes(e.pubKey); err != nil {
+		return
+	}
+	if R, err = new(edwards25519.Point).SetBytes(e.sig[:32]); err != nil {
+		return
+	}
+	if isSmallOrder(A) || isSmallOrder(R) {
+		err = errSmallOrder
+		return
+	}
+	if s, err = new(edwards25519.Scalar).SetCanonicalBytes(e.sig[32:]); err != nil {
+		return
+	}
+	h := sha512.New()
+	h.Write(e.sig[:32])
+	h.Write(e.pubKey)
+	h.Write(e.msg)
+	k, err = new(edwards25519.Scalar).SetUniformBytes(h.Sum(nil))
+	return
+}
+
+func isSmallOrder(p *edwards25519.Point) bool {
+	return new(edwards25519.Point).MultByCofactor(p).Equal(edwards25519.NewIdentityPoint()) == 1
+}
+
+// randomBatchScalar returns a random 128 bit scalar, which is enough to make
+// a forged batch pass with negligible probability.
+func randomBatchScalar() *edwards25519.Scalar {
+	b := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, b[:16]); err != nil {
+		panic(err)
+	}
+	s, err := new(edwards25519.Scalar).SetCanonicalBytes(b)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
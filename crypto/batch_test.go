@@ -0,0 +1,97 @@
+package crypto
+
+import (
+	"fmt"
+	"testing"
+
+	"filippo.io/edwards25519"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeBatch(n int) *BatchVerifier {
+	v := NewBatchVerifier()
+	for i := 0; i < n; i++ {
+		privKey := GeneratePrivateKey()
+		msg := []byte(fmt.Sprintf("message %d", i))
+		v.Add(privKey.Public(), msg, privKey.Sign(msg))
+	}
+	return v
+}
+
+func TestBatchVerify(t *testing.T) {
+	v := makeBatch(16)
+	ok, valid := v.Verify()
+	assert.True(t, ok)
+	assert.Equal(t, 16, len(valid))
+	for _, isValid := range valid {
+		assert.True(t, isValid)
+	}
+
+	empty := NewBatchVerifier()
+	ok, _ = empty.Verify()
+	assert.True(t, ok)
+}
+
+func TestBatchVerifyInvalidSignature(t *testing.T) {
+	v := makeBatch(8)
+	privKey := GeneratePrivateKey()
+	v.Add(privKey.Public(), []byte("foo"), privKey.Sign([]byte("bar")))
+	v.entries = append(v.entries, makeBatch(3).entries...)
+
+	ok, valid := v.Verify()
+	assert.False(t, ok)
+	for i, isValid := range valid {
+		assert.Equal(t, i != 8, isValid)
+	}
+}
+
+func TestVerifyCofactored(t *testing.T) {
+	privKey := GeneratePrivateKey()
+	msg := []byte("foo bar baz")
+	sig := privKey.Sign(msg)
+	assert.True(t, VerifyCofactored(privKey.Public(), msg, sig))
+	assert.False(t, VerifyCofactored(privKey.Public(), []byte("foo"), sig))
+	assert.False(t, VerifyCofactored(GeneratePrivateKey().Public(), msg, sig))
+}
+
+func TestVerifyRejectsSmallOrderPoints(t *testing.T) {
+	// with the identity as public key and R and a zero s the cofactored
+	// equation holds for any message
+	identity := edwards25519.NewIdentityPoint().Bytes()
+	pubKey := PublicKeyFromBytes(identity)
+	sig := SignatureFromBytes(append(append([]byte{}, identity...), make([]byte, 32)...))
+	msg := []byte("foo bar baz")
+
+	assert.False(t, VerifyCofactored(pubKey, msg, sig))
+	assert.False(t, sig.Verify(pubKey, msg))
+
+	v := makeBatch(4)
+	v.Add(pubKey, msg, sig)
+	ok, valid := v.Verify()
+	assert.False(t, ok)
+	assert.False(t, valid[4])
+}
+
+func BenchmarkVerifyIndividually(b *testing.B) {
+	for _, n := range []int{64, 1024} {
+		v := makeBatch(n)
+		b.Run(fmt.Sprintf("sigs=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, e := range v.entries {
+					SignatureFromBytes(e.sig).Verify(PublicKeyFromBytes(e.pubKey), e.msg)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkBatchVerify(b *testing.B) {
+	for _, n := range []int{64, 1024} {
+		v := makeBatch(n)
+		b.Run(fmt.Sprintf("sigs=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				v.Verify()
+			}
+		})
+	}
+}
@@ -121,8 +121,10 @@ func (s *Signature) Bytes() []byte {
 	return s.value
 }
 
+// Verify checks the signature with the cofactored equation of
+// BatchVerifier, the one verification rule of the chain.
 func (s *Signature) Verify(pubKey *PublicKey, msg []byte) bool {
-	return ed25519.Verify(pubKey.key, msg, s.value)
+	return VerifyCofactored(pubKey, msg, s)
 }
 
 func AddressFromBytes(b []byte) Address {
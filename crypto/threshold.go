@@ -0,0 +1,420 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+
+	"filippo.io/edwards25519"
+)
+
+// Threshold signatures follow FROST(Ed25519, SHA-512) with a trusted dealer.
+// t of n operators jointly produce a signature that is indistinguishable from
+// a regular ed25519 signature under the group public key, so anything that
+// verifies ed25519 signatures (like VerifyBlock) accepts the group key as is.
+
+const (
+	KeyShareLen    = 2 + 32 + PubKeyLen
+	frostDomainTag = "GoBlocker-FROST-ed25519-v1"
+)
+
+// groupOrder is the order L of the ed25519 base point.
+var groupOrder, _ = new(big.Int).SetString("7237005577332262213973186563042994240857116359379907606001950938285454250989", 10)
+
+// ThresholdGroup is the public description of a t-of-n signing group.
+type ThresholdGroup struct {
+	Threshold int
+	GroupKey  *PublicKey
+	// VerifyingShares holds the public key of each share, indexed by the
+	// share index, and is used to pinpoint operators sending bad shares.
+	VerifyingShares map[uint16][]byte
+}
+
+type thresholdGroupJSON struct {
+	Threshold       int               `json:"threshold"`
+	GroupKey        string            `json:"groupKey"`
+	VerifyingShares map[uint16]string `json:"verifyingShares"`
+}
+
+// MarshalJSON encodes the group for the configuration of the coordinators.
+func (g *ThresholdGroup) MarshalJSON() ([]byte, error) {
+	v := thresholdGroupJSON{
+		Threshold:       g.Threshold,
+		GroupKey:        hex.EncodeToString(g.GroupKey.Bytes()),
+		VerifyingShares: make(map[uint16]string, len(g.VerifyingShares)),
+	}
+	for index, share := range g.VerifyingShares {
+		v.VerifyingShares[index] = hex.EncodeToString(share)
+	}
+	return json.Marshal(v)
+}
+
+func (g *ThresholdGroup) UnmarshalJSON(b []byte) error {
+	v := thresholdGroupJSON{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	groupKey, err := hex.DecodeString(v.GroupKey)
+	if err != nil || len(groupKey) != PubKeyLen {
+		return fmt.Errorf("invalid group key")
+	}
+	if v.Threshold < 1 || v.Threshold > len(v.VerifyingShares) {
+		return fmt.Errorf("invalid threshold %d for %d participants", v.Threshold, len(v.VerifyingShares))
+	}
+	shares := make(map[uint16][]byte, len(v.VerifyingShares))
+	for index, s := range v.VerifyingShares {
+		share, err := hex.DecodeString(s)
+		if err != nil || len(share) != PubKeyLen || index == 0 {
+			return fmt.Errorf("invalid verifying share of participant %d", index)
+		}
+		shares[index] = share
+	}
+	g.Threshold = v.Threshold
+	g.GroupKey = PublicKeyFromBytes(groupKey)
+	g.VerifyingShares = shares
+	return nil
+}
+
+// KeyShare is the secret share of the group key held by a single operator.
+type KeyShare struct {
+	Index    uint16
+	GroupKey *PublicKey
+	secret   *edwards25519.Scalar
+}
+
+// SigningNonces are the secret nonces of one signing round. They must never
+// be used for more than one signature.
+type SigningNonces struct {
+	hiding  *edwards25519.Scalar
+	binding *edwards25519.Scalar
+}
+
+// SigningCommitment is the public commitment to a participant's nonces that
+// is shared with the other participants before signing.
+type SigningCommitment struct {
+	Index   uint16
+	Hiding  []byte
+	Binding []byte
+}
+
+type SignatureShare struct {
+	Index uint16
+	Value []byte
+}
+
+// GenerateThresholdKey splits a freshly generated group key into n shares of
+// which any threshold can sign.
+func GenerateThresholdKey(threshold, n int) (*ThresholdGroup, []*KeyShare, error) {
+	if threshold < 1 || threshold > n {
+		return nil, nil, fmt.Errorf("invalid threshold %d for %d participants", threshold, n)
+	}
+	if n >= 1<<16 {
+		return nil, nil, fmt.Errorf("too many participants %d", n)
+	}
+
+	coefficients := make([]*edwards25519.Scalar, threshold)
+	for i := range coefficients {
+		coefficients[i] = randomScalar()
+	}
+	groupKey := new(edwards25519.Point).ScalarBaseMult(coefficients[0])
+
+	group := &ThresholdGroup{
+		Threshold:       threshold,
+		GroupKey:        &PublicKey{key: groupKey.Bytes()},
+		VerifyingShares: make(map[uint16][]byte, n),
+	}
+	shares := make([]*KeyShare, n)
+	for i := 0; i < n; i++ {
+		index := uint16(i + 1)
+		secret := evalPolynomial(coefficients, index)
+		shares[i] = &KeyShare{
+			Index:    index,
+			GroupKey: group.GroupKey,
+			secret:   secret,
+		}
+		group.VerifyingShares[index] = new(edwards25519.Point).ScalarBaseMult(secret).Bytes()
+	}
+
+	return group, shares, nil
+}
+
+func KeyShareFromBytes(b []byte) (*KeyShare, error) {
+	if len(b) != KeyShareLen {
+		return nil, fmt.Errorf("invalid key share length %d", len(b))
+	}
+	secret, err := new(edwards25519.Scalar).SetCanonicalBytes(b[2:34])
+	if err != nil {
+		return nil, err
+	}
+	index := binary.BigEndian.Uint16(b[:2])
+	if index == 0 {
+		return nil, fmt.Errorf("invalid key share index 0")
+	}
+	return &KeyShare{
+		Index:    index,
+		GroupKey: PublicKeyFromBytes(append([]byte{}, b[34:]...)),
+		secret:   secret,
+	}, nil
+}
+
+func (k *KeyShare) Bytes() []byte {
+	b := make([]byte, 2, KeyShareLen)
+	binary.BigEndian.PutUint16(b, k.Index)
+	b = append(b, k.secret.Bytes()...)
+	return append(b, k.GroupKey.Bytes()...)
+}
+
+// Commit starts a signing round by generating fresh nonces and the
+// commitment to publish to the other participants.
+func (k *KeyShare) Commit() (*SigningNonces, *SigningCommitment) {
+	nonces := &SigningNonces{
+		hiding:  randomScalar(),
+		binding: randomScalar(),
+	}
+	commitment := &SigningCommitment{
+		Index:   k.Index,
+		Hiding:  new(edwards25519.Point).ScalarBaseMult(nonces.hiding).Bytes(),
+		Binding: new(edwards25519.Point).ScalarBaseMult(nonces.binding).Bytes(),
+	}
+	return nonces, commitment
+}
+
+// Sign produces this participant's signature share over msg. The nonces are
+// wiped afterwards so they cannot be reused by accident.
+func (k *KeyShare) Sign(msg []byte, nonces *SigningNonces, commitments []*SigningCommitment) (*SignatureShare, error) {
+	if nonces.hiding == nil || nonces.binding == nil {
+		return nil, fmt.Errorf("signing nonces already used")
+	}
+	round, err := newSigningRound(k.GroupKey, msg, commitments)
+	if err != nil {
+		return nil, err
+	}
+	own, ok := round.commitments[k.Index]
+	if !ok {
+		return nil, fmt.Errorf("participant %d has no commitment in this round", k.Index)
+	}
+	// a coordinator swapping our commitment would make us sign with nonces
+	// the round does not account for
+	if !bytes.Equal(own.Hiding, new(edwards25519.Point).ScalarBaseMult(nonces.hiding).Bytes()) ||
+		!bytes.Equal(own.Binding, new(edwards25519.Point).ScalarBaseMult(nonces.binding).Bytes()) {
+		return nil, fmt.Errorf("commitment of participant %d does not match its nonces", k.Index)
+	}
+
+	lambda := round.lagrange(k.Index)
+	z := new(edwards25519.Scalar).Multiply(nonces.binding, round.bindingFactors[k.Index])
+	z.Add(z, nonces.hiding)
+	z.MultiplyAdd(new(edwards25519.Scalar).Multiply(lambda, k.secret), round.challenge, z)
+
+	nonces.hiding = nil
+	nonces.binding = nil
+
+	return &SignatureShare{
+		Index: k.Index,
+		Value: z.Bytes(),
+	}, nil
+}
+
+// Aggregate verifies every signature share and combines them into a regular
+// ed25519 signature under the group key.
+func (g *ThresholdGroup) Aggregate(msg []byte, commitments []*SigningCommitment, shares []*SignatureShare) (*Signature, error) {
+	if len(commitments) < g.Threshold {
+		return nil, fmt.Errorf("need %d participants, got %d", g.Threshold, len(commitments))
+	}
+	if len(shares) != len(commitments) {
+		return nil, fmt.Errorf("got %d signature shares for %d commitments", len(shares), len(commitments))
+	}
+	round, err := newSigningRound(g.GroupKey, msg, commitments)
+	if err != nil {
+		return nil, err
+	}
+
+	z := edwards25519.NewScalar()
+	seen := make(map[uint16]bool, len(shares))
+	for _, share := range shares {
+		if seen[share.Index] {
+			return nil, fmt.Errorf("duplicate signature share from participant %d", share.Index)
+		}
+		seen[share.Index] = true
+		if err := g.verifyShare(round, share); err != nil {
+			return nil, err
+		}
+		zi, _ := new(edwards25519.Scalar).SetCanonicalBytes(share.Value)
+		z.Add(z, zi)
+	}
+
+	sig := make([]byte, 0, SignatureLen)
+	sig = append(sig, round.groupCommitment.Bytes()...)
+	sig = append(sig, z.Bytes()...)
+	signature := &Signature{value: sig}
+	if !signature.Verify(g.GroupKey, msg) {
+		return nil, fmt.Errorf("aggregated signature does not verify")
+	}
+	return signature, nil
+}
+
+func (g *ThresholdGroup) verifyShare(round *signingRound, share *SignatureShare) error {
+	commitment, ok := round.commitments[share.Index]
+	if !ok {
+		return fmt.Errorf("signature share from participant %d without commitment", share.Index)
+	}
+	pubShare, ok := g.VerifyingShares[share.Index]
+	if !ok {
+		return fmt.Errorf("unknown participant %d", share.Index)
+	}
+	zi, err := new(edwards25519.Scalar).SetCanonicalBytes(share.Value)
+	if err != nil {
+		return fmt.Errorf("malformed signature share from participant %d", share.Index)
+	}
+	y, err := new(edwards25519.Point).SetBytes(pubShare)
+	if err != nil {
+		return err
+	}
+	hiding, _ := new(edwards25519.Point).SetBytes(commitment.Hiding)
+	binding, _ := new(edwards25519.Point).SetBytes(commitment.Binding)
+
+	// z_i * B == D_i + rho_i * E_i + c * lambda_i * Y_i
+	expected := new(edwards25519.Point).ScalarMult(round.bindingFactors[share.Index], binding)
+	expected.Add(expected, hiding)
+	cl := new(edwards25519.Scalar).Multiply(round.challenge, round.lagrange(share.Index))
+	expected.Add(expected, new(edwards25519.Point).ScalarMult(cl, y))
+
+	if new(edwards25519.Point).ScalarBaseMult(zi).Equal(expected) != 1 {
+		return fmt.Errorf("invalid signature share from participant %d", share.Index)
+	}
+	return nil
+}
+
+// signingRound holds the values every participant derives from the message
+// and the full set of commitments.
+type signingRound struct {
+	indices         []uint16
+	commitments     map[uint16]*SigningCommitment
+	bindingFactors  map[uint16]*edwards25519.Scalar
+	groupCommitment *edwards25519.Point
+	challenge       *edwards25519.Scalar
+}
+
+func newSigningRound(groupKey *PublicKey, msg []byte, commitments []*SigningCommitment) (*signingRound, error) {
+	sorted := make([]*SigningCommitment, len(commitments))
+	copy(sorted, commitments)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Index < sorted[j].Index })
+
+	round := &signingRound{
+		commitments:     make(map[uint16]*SigningCommitment, len(sorted)),
+		bindingFactors:  make(map[uint16]*edwards25519.Scalar, len(sorted)),
+		groupCommitment: edwards25519.NewIdentityPoint(),
+	}
+
+	encoded := new(bytes.Buffer)
+	for _, c := range sorted {
+		if c.Index == 0 {
+			return nil, fmt.Errorf("invalid participant index 0")
+		}
+		if _, ok := round.commitments[c.Index]; ok {
+			return nil, fmt.Errorf("duplicate commitment from participant %d", c.Index)
+		}
+		if _, err := new(edwards25519.Point).SetBytes(c.Hiding); err != nil {
+			return nil, fmt.Errorf("invalid hiding commitment from participant %d", c.Index)
+		}
+		if _, err := new(edwards25519.Point).SetBytes(c.Binding); err != nil {
+			return nil, fmt.Errorf("invalid binding commitment from participant %d", c.Index)
+		}
+		round.commitments[c.Index] = c
+		round.indices = append(round.indices, c.Index)
+		binary.Write(encoded, binary.BigEndian, c.Index)
+		encoded.Write(c.Hiding)
+		encoded.Write(c.Binding)
+	}
+
+	msgHash := sha512.Sum512(msg)
+	commitmentsHash := sha512.Sum512(encoded.Bytes())
+	for _, c := range sorted {
+		idx := make([]byte, 2)
+		binary.BigEndian.PutUint16(idx, c.Index)
+		rho := hashToScalar([]byte(frostDomainTag+"rho"), groupKey.Bytes(), msgHash[:], commitmentsHash[:], idx)
+		round.bindingFactors[c.Index] = rho
+
+		hiding, _ := new(edwards25519.Point).SetBytes(c.Hiding)
+		binding, _ := new(edwards25519.Point).SetBytes(c.Binding)
+		round.groupCommitment.Add(round.groupCommitment, hiding)
+		round.groupCommitment.Add(round.groupCommitment, new(edwards25519.Point).ScalarMult(rho, binding))
+	}
+
+	// The challenge is computed exactly like ed25519 does, which is what
+	// makes the aggregated signature a plain ed25519 signature.
+	round.challenge = hashToScalar(round.groupCommitment.Bytes(), groupKey.Bytes(), msg)
+
+	return round, nil
+}
+
+// lagrange returns the lagrange coefficient of index at x = 0 over the
+// participants of this round.
+func (r *signingRound) lagrange(index uint16) *edwards25519.Scalar {
+	num := big.NewInt(1)
+	den := big.NewInt(1)
+	for _, j := range r.indices {
+		if j == index {
+			continue
+		}
+		num.Mul(num, big.NewInt(int64(j)))
+		den.Mul(den, big.NewInt(int64(j)-int64(index)))
+	}
+	den.Mod(den, groupOrder)
+	num.Mul(num, den.ModInverse(den, groupOrder))
+	num.Mod(num, groupOrder)
+
+	return scalarFromBig(num)
+}
+
+func evalPolynomial(coefficients []*edwards25519.Scalar, index uint16) *edwards25519.Scalar {
+	x := scalarFromBig(big.NewInt(int64(index)))
+	result := edwards25519.NewScalar()
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		result.MultiplyAdd(result, x, coefficients[i])
+	}
+	return result
+}
+
+func scalarFromBig(n *big.Int) *edwards25519.Scalar {
+	be := n.FillBytes(make([]byte, 32))
+	le := make([]byte, 32)
+	for i := range be {
+		le[i] = be[31-i]
+	}
+	s, err := new(edwards25519.Scalar).SetCanonicalBytes(le)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func hashToScalar(parts ...[]byte) *edwards25519.Scalar {
+	h := sha512.New()
+	for _, part := range parts {
+		h.Write(part)
+	}
+	s, err := new(edwards25519.Scalar).SetUniformBytes(h.Sum(nil))
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func randomScalar() *edwards25519.Scalar {
+	b := make([]byte, 64)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		panic(err)
+	}
+	s, err := new(edwards25519.Scalar).SetUniformBytes(b)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
@@ -0,0 +1,121 @@
+package crypto
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func thresholdSign(t *testing.T, group *ThresholdGroup, signers []*KeyShare, msg []byte) (*Signature, error) {
+	var (
+		nonces      = make([]*SigningNonces, len(signers))
+		commitments = make([]*SigningCommitment, len(signers))
+		shares      = make([]*SignatureShare, len(signers))
+	)
+	for i, share := range signers {
+		nonces[i], commitments[i] = share.Commit()
+	}
+	for i, share := range signers {
+		sigShare, err := share.Sign(msg, nonces[i], commitments)
+		require.Nil(t, err)
+		shares[i] = sigShare
+	}
+	return group.Aggregate(msg, commitments, shares)
+}
+
+func TestThresholdSignature(t *testing.T) {
+	group, shares, err := GenerateThresholdKey(3, 5)
+	require.Nil(t, err)
+	assert.Equal(t, 5, len(shares))
+	assert.Equal(t, PubKeyLen, len(group.GroupKey.Bytes()))
+
+	msg := []byte("foo bar baz")
+	for _, signers := range [][]*KeyShare{
+		{shares[0], shares[1], shares[2]},
+		{shares[4], shares[1], shares[3]},
+		shares,
+	} {
+		sig, err := thresholdSign(t, group, signers, msg)
+		require.Nil(t, err)
+		assert.Equal(t, SignatureLen, len(sig.Bytes()))
+		assert.True(t, sig.Verify(group.GroupKey, msg))
+		assert.False(t, sig.Verify(group.GroupKey, []byte("foo")))
+	}
+}
+
+func TestThresholdSignatureBelowThreshold(t *testing.T) {
+	group, shares, err := GenerateThresholdKey(3, 5)
+	require.Nil(t, err)
+
+	_, err = thresholdSign(t, group, shares[:2], []byte("foo bar baz"))
+	assert.NotNil(t, err)
+}
+
+func TestThresholdSignatureInvalidShare(t *testing.T) {
+	group, shares, err := GenerateThresholdKey(2, 3)
+	require.Nil(t, err)
+
+	var (
+		msg             = []byte("foo bar baz")
+		nonces1, comm1  = shares[0].Commit()
+		nonces2, comm2  = shares[1].Commit()
+		commitments     = []*SigningCommitment{comm1, comm2}
+		sigShare1, err1 = shares[0].Sign(msg, nonces1, commitments)
+		sigShare2, err2 = shares[1].Sign([]byte("other"), nonces2, commitments)
+	)
+	require.Nil(t, err1)
+	require.Nil(t, err2)
+
+	_, err = group.Aggregate(msg, commitments, []*SignatureShare{sigShare1, sigShare2})
+	assert.NotNil(t, err)
+
+	// nonces can only be used once
+	_, err = shares[0].Sign(msg, nonces1, commitments)
+	assert.NotNil(t, err)
+}
+
+func TestThresholdSignRejectsForeignCommitment(t *testing.T) {
+	_, shares, err := GenerateThresholdKey(2, 3)
+	require.Nil(t, err)
+
+	var (
+		msg       = []byte("foo bar baz")
+		nonces, _ = shares[0].Commit()
+		_, other  = shares[0].Commit()
+		_, comm2  = shares[1].Commit()
+	)
+	// the commitment sent for us was not made with our nonces
+	_, err = shares[0].Sign(msg, nonces, []*SigningCommitment{other, comm2})
+	assert.NotNil(t, err)
+
+	_, err = shares[0].Sign(msg, nonces, []*SigningCommitment{comm2})
+	assert.NotNil(t, err)
+}
+
+func TestThresholdGroupJSON(t *testing.T) {
+	group, _, err := GenerateThresholdKey(2, 3)
+	require.Nil(t, err)
+
+	b, err := json.Marshal(group)
+	require.Nil(t, err)
+	decoded := &ThresholdGroup{}
+	require.Nil(t, json.Unmarshal(b, decoded))
+	assert.Equal(t, group.Threshold, decoded.Threshold)
+	assert.Equal(t, group.GroupKey.Bytes(), decoded.GroupKey.Bytes())
+	assert.Equal(t, group.VerifyingShares, decoded.VerifyingShares)
+}
+
+func TestKeyShareBytes(t *testing.T) {
+	_, shares, err := GenerateThresholdKey(2, 3)
+	require.Nil(t, err)
+
+	b := shares[1].Bytes()
+	assert.Equal(t, KeyShareLen, len(b))
+	share, err := KeyShareFromBytes(b)
+	require.Nil(t, err)
+	assert.Equal(t, shares[1].Index, share.Index)
+	assert.Equal(t, shares[1].GroupKey.Bytes(), share.GroupKey.Bytes())
+	assert.Equal(t, b, share.Bytes())
+}
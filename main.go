@@ -2,46 +2,113 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/LDM-A/GoBlocker/crypto"
 	"github.com/LDM-A/GoBlocker/node"
 	"github.com/LDM-A/GoBlocker/proto"
+	"github.com/LDM-A/GoBlocker/types"
 	"github.com/LDM-A/GoBlocker/util"
 	"google.golang.org/grpc"
 )
 
+// validatorKey seals the blocks of the local network. It is kept in a file
+// since the saved chains only accept blocks sealed by it.
+var validatorKey = loadValidatorKey("validator.key")
+
+func loadValidatorKey(path string) *crypto.PrivateKey {
+	key, err := node.LoadKeyFile(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return key
+}
+
+// tlsConfig enables TLS with the certificates written by cmd/devcerts to
+// tls/, the nodes run without TLS when there are none.
+var tlsConfig = devTLS()
+
+func devTLS() *node.TLSConfig {
+	if _, err := os.Stat("tls/node.crt"); err != nil {
+		return nil
+	}
+	return &node.TLSConfig{
+		CertFile: "tls/node.crt",
+		KeyFile:  "tls/node.key",
+		CAFile:   "tls/ca.crt",
+	}
+}
+
 func main() {
 
-	makeNode(":3000", []string{}, true)
+	nodes := []*node.Node{}
+	nodes = append(nodes, makeNode(":3000", []string{}, true))
 	time.Sleep(time.Second)
-	makeNode(":4000", []string{":3000"}, false)
+	nodes = append(nodes, makeNode(":4000", []string{":3000"}, false))
 	time.Sleep(time.Second)
-	makeNode(":5000", []string{":4000"}, false)
+	nodes = append(nodes, makeNode(":5000", []string{":4000"}, false))
+
+	sigch := make(chan os.Signal, 1)
+	signal.Notify(sigch, os.Interrupt, syscall.SIGTERM)
 
+	ticker := time.NewTicker(time.Second)
 	for {
-		time.Sleep(1 * time.Second)
-		makeTransaction()
+		select {
+		case <-ticker.C:
+			makeTransaction()
+		case <-sigch:
+			for _, n := range nodes {
+				if err := n.Stop(); err != nil {
+					log.Println("failed to stop node:", err)
+				}
+			}
+			return
+		}
 	}
 }
 
 func makeNode(listenAddr string, bootstrapNodes []string, isValidator bool) *node.Node {
+	port := strings.TrimPrefix(listenAddr, ":")
 	cfg := node.ServerConfig{
-		Version:    "Blocker-1",
-		ListenAddr: listenAddr,
+		Version:          "Blocker-1",
+		ListenAddr:       listenAddr,
+		ChainFile:        fmt.Sprintf("chain_%s.dat", port),
+		MempoolFile:      fmt.Sprintf("mempool_%s.dat", port),
+		FeeEstimatesFile: fmt.Sprintf("fees_%s.dat", port),
+		AddressBookFile:  fmt.Sprintf("peers_%s.dat", port),
+		BanListFile:      fmt.Sprintf("bans_%s.dat", port),
+		NodeKeyFile:      fmt.Sprintf("node_%s.key", port),
+		AdminSocket:      fmt.Sprintf("admin_%s.sock", port),
+		TLS:              tlsConfig,
+		Validators:       []*crypto.PublicKey{validatorKey.Public()},
 	}
 	if isValidator {
-		cfg.PrivateKey = crypto.GeneratePrivateKey()
+		cfg.PrivateKey = validatorKey
+	}
+	n, err := node.NewNode(cfg)
+	if err != nil {
+		log.Fatal(err)
 	}
-	n := node.NewNode(cfg)
 	go n.Start(listenAddr, bootstrapNodes)
 
 	return n
 }
 
 func makeTransaction() {
-	client, err := grpc.Dial(":3000", grpc.WithInsecure())
+	opt := grpc.WithInsecure()
+	if tlsConfig != nil {
+		var err error
+		if opt, err = tlsConfig.DialOption(":3000"); err != nil {
+			log.Fatal(err)
+		}
+	}
+	client, err := grpc.Dial(":3000", opt)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -65,8 +132,10 @@ func makeTransaction() {
 		},
 	}
 
+	tx.Inputs[0].Signature = types.SignTransaction(privKey, tx).Bytes()
+
 	_, err = c.HandleTransaction(context.TODO(), tx)
 	if err != nil {
-		log.Fatal(err)
+		log.Println("transaction rejected:", err)
 	}
 }
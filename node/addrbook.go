@@ -0,0 +1,315 @@
+package node
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/LDM-A/GoBlocker/proto"
+	"github.com/LDM-A/GoBlocker/util"
+
+	pb "github.com/golang/protobuf/proto"
+)
+
+const (
+	// maxAddresses bounds the size of the address book. When full, an
+	// address we never connected to makes room for a new one, see evict.
+	maxAddresses = 2000
+	// maxAddrsPerSource bounds the addresses learned from a single peer.
+	maxAddrsPerSource = 200
+	// maxAddrsPerMessage is the number of addresses shared per GetPeers.
+	maxAddrsPerMessage = 100
+	// addrMaxAge is how long an address not seen is kept around.
+	addrMaxAge = time.Hour * 24 * 7
+	// maxAddrFailures is the number of consecutive failed dials after which
+	// an address is given up on.
+	maxAddrFailures = 5
+	// addrRetryDelay is how long an address is not dialed after a failure.
+	addrRetryDelay = time.Minute * 10
+)
+
+type addrEntry struct {
+	lastSeen    time.Time
+	lastAttempt time.Time
+	successes   int
+	failures    int
+	// source is the peer the address was learned from, empty when we
+	// learned it ourselves.
+	source string
+}
+
+// terrible reports whether the address is not worth sharing or dialing.
+func (e *addrEntry) terrible(now time.Time) bool {
+	return now.Sub(e.lastSeen) > addrMaxAge || e.failures >= maxAddrFailures
+}
+
+// AddressBook holds the addresses of the nodes we know about, learned from
+// peers or from connecting to them, along with how dialing them went.
+type AddressBook struct {
+	lock    sync.Mutex
+	entries map[string]*addrEntry
+	// sources counts the entries learned from every source.
+	sources map[string]int
+}
+
+func NewAddressBook() *AddressBook {
+	return &AddressBook{
+		entries: make(map[string]*addrEntry),
+		sources: make(map[string]int),
+	}
+}
+
+// Add records an address seen at lastSeen. Addresses already known only
+// have their lastSeen moved forward.
+func (a *AddressBook) Add(addr string, lastSeen time.Time) {
+	a.AddFrom(addr, lastSeen, "")
+}
+
+// AddFrom is Add for an address shared by the peer source. New addresses are
+// ignored once source added maxAddrsPerSource of them.
+func (a *AddressBook) AddFrom(addr string, lastSeen time.Time, source string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if now := time.Now(); lastSeen.After(now) {
+		lastSeen = now
+	}
+	if e, ok := a.entries[addr]; ok {
+		if lastSeen.After(e.lastSeen) {
+			e.lastSeen = lastSeen
+		}
+		return
+	}
+	if source != "" && a.sources[source] >= maxAddrsPerSource {
+		return
+	}
+	if len(a.entries) >= maxAddresses {
+		a.evict()
+	}
+	a.insert(addr, &addrEntry{lastSeen: lastSeen, source: source})
+}
+
+// insert adds a new entry. The caller must hold lock.
+func (a *AddressBook) insert(addr string, e *addrEntry) {
+	a.entries[addr] = e
+	if e.source != "" {
+		a.sources[e.source]++
+	}
+}
+
+// evict drops the entry least worth keeping: addresses given up on first,
+// then the ones we never connected to, the one seen least recently among
+// them. The caller must hold lock.
+func (a *AddressBook) evict() {
+	var (
+		now    = time.Now()
+		victim string
+		worst  *addrEntry
+	)
+	for addr, e := range a.entries {
+		if worst == nil || worseEntry(now, e, worst) {
+			victim, worst = addr, e
+		}
+	}
+	if worst == nil {
+		return
+	}
+	delete(a.entries, victim)
+	if worst.source != "" {
+		if a.sources[worst.source]--; a.sources[worst.source] <= 0 {
+			delete(a.sources, worst.source)
+		}
+	}
+}
+
+// worseEntry reports whether e is less worth keeping than other.
+func worseEntry(now time.Time, e, other *addrEntry) bool {
+	if e.terrible(now) != other.terrible(now) {
+		return e.terrible(now)
+	}
+	if (e.successes > 0) != (other.successes > 0) {
+		return other.successes > 0
+	}
+	return e.lastSeen.Before(other.lastSeen)
+}
+
+// Good records a successful connection to addr.
+func (a *AddressBook) Good(addr string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	now := time.Now()
+	e, ok := a.entries[addr]
+	if !ok {
+		if len(a.entries) >= maxAddresses {
+			a.evict()
+		}
+		e = &addrEntry{}
+		a.insert(addr, e)
+	}
+	e.lastSeen = now
+	e.lastAttempt = now
+	e.successes++
+	e.failures = 0
+}
+
+// Failed records a failed attempt to connect to addr.
+func (a *AddressBook) Failed(addr string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if e, ok := a.entries[addr]; ok {
+		e.lastAttempt = time.Now()
+		e.failures++
+	}
+}
+
+func (a *AddressBook) Len() int {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return len(a.entries)
+}
+
+// Addresses returns up to max addresses worth sharing, seen most recently
+// first.
+func (a *AddressBook) Addresses(max int) []*proto.PeerAddr {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	now := time.Now()
+	addrs := []*proto.PeerAddr{}
+	for addr, e := range a.entries {
+		if !e.terrible(now) {
+			addrs = append(addrs, &proto.PeerAddr{Addr: addr, LastSeen: e.lastSeen.Unix()})
+		}
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		return addrs[i].LastSeen > addrs[j].LastSeen
+	})
+	if len(addrs) > max {
+		addrs = addrs[:max]
+	}
+	return addrs
+}
+
+// Select returns up to max addresses to dial for which skip is false,
+// leaving out the ones that failed within addrRetryDelay. The ones we
+// connected to before come first, then the ones failing the least, then the
+// ones seen most recently.
+func (a *AddressBook) Select(max int, skip func(addr string) bool) []string {
+	type candidate struct {
+		addr string
+		addrEntry
+	}
+	a.lock.Lock()
+	now := time.Now()
+	candidates := []candidate{}
+	for addr, e := range a.entries {
+		if e.terrible(now) {
+			continue
+		}
+		if e.failures > 0 && now.Sub(e.lastAttempt) < addrRetryDelay {
+			continue
+		}
+		candidates = append(candidates, candidate{addr, *e})
+	}
+	a.lock.Unlock()
+
+	sort.Slice(candidates, func(i, j int) bool {
+		ci, cj := candidates[i], candidates[j]
+		if (ci.successes > 0) != (cj.successes > 0) {
+			return ci.successes > 0
+		}
+		if ci.failures != cj.failures {
+			return ci.failures < cj.failures
+		}
+		return ci.lastSeen.After(cj.lastSeen)
+	})
+	// skip is called without holding lock, it may well take other locks
+	addrs := []string{}
+	for _, c := range candidates {
+		if len(addrs) == max {
+			break
+		}
+		if !skip(c.addr) {
+			addrs = append(addrs, c.addr)
+		}
+	}
+	return addrs
+}
+
+// Save writes the address book to path. Addresses given up on are left out.
+func (a *AddressBook) Save(path string) error {
+	a.lock.Lock()
+	now := time.Now()
+	state := &proto.AddrBookState{}
+	for addr, e := range a.entries {
+		if e.terrible(now) {
+			continue
+		}
+		state.Entries = append(state.Entries, &proto.AddrBookEntry{
+			Addr:        addr,
+			LastSeen:    e.lastSeen.Unix(),
+			LastAttempt: e.lastAttempt.Unix(),
+			Successes:   int32(e.successes),
+			Failures:    int32(e.failures),
+			Source:      e.source,
+		})
+	}
+	a.lock.Unlock()
+
+	b, err := pb.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(path, b, 0644)
+}
+
+// LoadAddressBook restores an address book saved with AddressBook.Save. A
+// missing file yields an empty address book. The limits of the address book
+// apply to the saved entries as well, the ones worth the least are dropped.
+func LoadAddressBook(path string) (*AddressBook, error) {
+	a := NewAddressBook()
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := &proto.AddrBookState{}
+	if err := pb.Unmarshal(b, state); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	entries := make(map[string]*addrEntry, len(state.Entries))
+	for _, e := range state.Entries {
+		entries[e.Addr] = &addrEntry{
+			lastSeen:    time.Unix(e.LastSeen, 0),
+			lastAttempt: time.Unix(e.LastAttempt, 0),
+			successes:   int(e.Successes),
+			failures:    int(e.Failures),
+			source:      e.Source,
+		}
+	}
+	addrs := make([]string, 0, len(entries))
+	for addr := range entries {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		return worseEntry(now, entries[addrs[j]], entries[addrs[i]])
+	})
+	for _, addr := range addrs {
+		e := entries[addr]
+		if len(a.entries) == maxAddresses {
+			break
+		}
+		if e.source != "" && a.sources[e.source] >= maxAddrsPerSource {
+			continue
+		}
+		a.insert(addr, e)
+	}
+	return a, nil
+}
@@ -0,0 +1,128 @@
+package node
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/LDM-A/GoBlocker/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pb "github.com/golang/protobuf/proto"
+)
+
+func noSkip(string) bool { return false }
+
+func TestAddressBookSelect(t *testing.T) {
+	var (
+		a   = NewAddressBook()
+		now = time.Now()
+	)
+	a.Add("old", now.Add(-time.Hour))
+	a.Add("recent", now.Add(-time.Minute))
+	a.Add("stale", now.Add(-addrMaxAge-time.Hour))
+	a.Add("good", now.Add(-time.Hour*2))
+	a.Good("good")
+	a.Add("failing", now)
+	a.Failed("failing")
+	// a future lastSeen is not trusted
+	a.Add("future", now.Add(time.Hour))
+
+	assert.Equal(t, []string{"good", "future", "recent", "old"}, a.Select(10, noSkip))
+	assert.Equal(t, []string{"good", "recent"}, a.Select(2, func(addr string) bool {
+		return addr == "future"
+	}))
+
+	shared := a.Addresses(10)
+	require.Len(t, shared, 5)
+	assert.LessOrEqual(t, shared[0].LastSeen, now.Unix())
+	for _, addr := range shared {
+		assert.NotEqual(t, "stale", addr.Addr)
+	}
+}
+
+func TestAddressBookGivesUpOnFailingAddress(t *testing.T) {
+	a := NewAddressBook()
+	a.Add("flaky", time.Now())
+	for i := 0; i < maxAddrFailures-1; i++ {
+		a.Failed("flaky")
+	}
+	assert.Len(t, a.Addresses(10), 1)
+	a.Failed("flaky")
+	assert.Empty(t, a.Addresses(10))
+
+	// a successful connection makes it good again
+	a.Good("flaky")
+	assert.Equal(t, []string{"flaky"}, a.Select(10, noSkip))
+}
+
+func TestAddressBookPersistence(t *testing.T) {
+	var (
+		file = filepath.Join(t.TempDir(), "peers.dat")
+		a    = NewAddressBook()
+	)
+	a.Add("known", time.Now().Add(-time.Hour))
+	a.Good("good")
+	a.Add("stale", time.Now().Add(-addrMaxAge-time.Hour))
+	require.Nil(t, a.Save(file))
+
+	loaded, err := LoadAddressBook(file)
+	require.Nil(t, err)
+	assert.Equal(t, 2, loaded.Len())
+	assert.Equal(t, []string{"good", "known"}, loaded.Select(10, noSkip))
+	assert.Equal(t, 1, loaded.entries["good"].successes)
+
+	empty, err := LoadAddressBook(filepath.Join(t.TempDir(), "missing.dat"))
+	require.Nil(t, err)
+	assert.Equal(t, 0, empty.Len())
+}
+
+func TestAddressBookEvictsUnprovenFirst(t *testing.T) {
+	a := NewAddressBook()
+	a.Good("proven")
+	a.entries["proven"].lastSeen = time.Now().Add(-time.Hour * 24)
+	for i := 0; i < maxAddresses; i++ {
+		a.Add(fmt.Sprint(i), time.Now().Add(-time.Hour))
+	}
+
+	assert.Equal(t, maxAddresses, a.Len())
+	assert.Contains(t, a.entries, "proven")
+}
+
+func TestAddressBookLimitsSource(t *testing.T) {
+	a := NewAddressBook()
+	for i := 0; i < maxAddrsPerSource+10; i++ {
+		a.AddFrom(fmt.Sprint("spam", i), time.Now(), "spammer")
+	}
+	assert.Equal(t, maxAddrsPerSource, a.Len())
+
+	a.AddFrom("honest", time.Now(), "other")
+	assert.Equal(t, maxAddrsPerSource+1, a.Len())
+}
+
+func TestLoadAddressBookRespectsLimits(t *testing.T) {
+	var (
+		file  = filepath.Join(t.TempDir(), "peers.dat")
+		now   = time.Now()
+		state = &proto.AddrBookState{}
+	)
+	state.Entries = append(state.Entries, &proto.AddrBookEntry{Addr: "proven", LastSeen: now.Add(-time.Hour * 24).Unix(), Successes: 1})
+	for i := 0; i < maxAddresses; i++ {
+		state.Entries = append(state.Entries, &proto.AddrBookEntry{Addr: fmt.Sprint(i), LastSeen: now.Unix()})
+	}
+	for i := 0; i < maxAddrsPerSource+10; i++ {
+		state.Entries = append(state.Entries, &proto.AddrBookEntry{Addr: fmt.Sprint("spam", i), LastSeen: now.Unix(), Source: "spammer"})
+	}
+	b, err := pb.Marshal(state)
+	require.Nil(t, err)
+	require.Nil(t, os.WriteFile(file, b, 0644))
+
+	loaded, err := LoadAddressBook(file)
+	require.Nil(t, err)
+	assert.Equal(t, maxAddresses, loaded.Len())
+	assert.Contains(t, loaded.entries, "proven")
+	assert.LessOrEqual(t, loaded.sources["spammer"], maxAddrsPerSource)
+}
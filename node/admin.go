@@ -0,0 +1,66 @@
+package node
+
+import (
+	"context"
+	"net"
+	"os"
+
+	"github.com/LDM-A/GoBlocker/proto"
+	"google.golang.org/grpc"
+)
+
+// adminServer serves the Admin service of a node. It is only reachable
+// through the unix socket of ServerConfig.AdminSocket.
+type adminServer struct {
+	node *Node
+	proto.UnimplementedAdminServer
+}
+
+// serveAdmin starts serving the Admin service on the unix socket at path.
+// The socket is only accessible to the user running the node.
+func (n *Node) serveAdmin(path string) error {
+	if err := os.RemoveAll(path); err != nil {
+		return err
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return err
+	}
+	server := grpc.NewServer()
+	proto.RegisterAdminServer(server, &adminServer{node: n})
+	n.serverLock.Lock()
+	n.adminServer = server
+	n.serverLock.Unlock()
+	go server.Serve(ln)
+	return nil
+}
+
+// stopAdmin stops the admin server, if it runs.
+func (n *Node) stopAdmin() {
+	n.serverLock.Lock()
+	server := n.adminServer
+	n.serverLock.Unlock()
+	if server != nil {
+		server.Stop()
+	}
+}
+
+func (s *adminServer) ListBans(ctx context.Context, _ *proto.Ack) (*proto.BanList, error) {
+	return banListProto(s.node.bans.List()), nil
+}
+
+// ClearBans lifts the ban of the requested host, or all bans when no host
+// is given.
+func (s *adminServer) ClearBans(ctx context.Context, req *proto.ClearBansRequest) (*proto.ClearBansResult, error) {
+	if req.Host == "" {
+		return &proto.ClearBansResult{Cleared: int32(s.node.bans.Clear())}, nil
+	}
+	if !s.node.bans.Unban(req.Host) {
+		return &proto.ClearBansResult{}, nil
+	}
+	return &proto.ClearBansResult{Cleared: 1}, nil
+}
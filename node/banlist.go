@@ -0,0 +1,246 @@
+package node
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/LDM-A/GoBlocker/proto"
+	"github.com/LDM-A/GoBlocker/util"
+
+	pb "github.com/golang/protobuf/proto"
+)
+
+const (
+	// banThreshold is the misbehavior score at which a host is banned.
+	banThreshold       = 100
+	defaultBanDuration = time.Hour * 24
+	// maxTrackedScores bounds the number of hosts with a misbehavior score.
+	// When full, the lowest score is forgotten to make room.
+	maxTrackedScores = 10000
+
+	misbehaviorInvalidTx    = 20
+	misbehaviorInvalidBlock = 100
+	// misbehaviorOversizedInv is scored for Announce and GetData messages
+	// with more than maxInvItems items.
+	misbehaviorOversizedInv = 20
+	// misbehaviorUnansweredRequest is scored when a peer does not deliver
+	// items it announced within requestTimeout.
+	misbehaviorUnansweredRequest = 10
+)
+
+var errBanned = errors.New("host is banned")
+
+type Ban struct {
+	Host   string
+	Until  time.Time
+	Reason string
+}
+
+// BanList keeps the misbehavior scores of the hosts we talk to and the hosts
+// banned for reaching banThreshold.
+type BanList struct {
+	lock   sync.Mutex
+	bans   map[string]Ban
+	scores map[string]int
+}
+
+func NewBanList() *BanList {
+	return &BanList{
+		bans:   make(map[string]Ban),
+		scores: make(map[string]int),
+	}
+}
+
+// Misbehaving adds score to the misbehavior score of host and bans it for
+// duration once it reaches banThreshold. It reports whether host got banned.
+func (l *BanList) Misbehaving(host string, score int, reason string, duration time.Duration) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if _, ok := l.scores[host]; !ok && len(l.scores) >= maxTrackedScores {
+		l.forgetLowestScore()
+	}
+	l.scores[host] += score
+	if l.scores[host] < banThreshold {
+		return false
+	}
+	delete(l.scores, host)
+	l.bans[host] = Ban{Host: host, Until: time.Now().Add(duration), Reason: reason}
+	return true
+}
+
+// forgetLowestScore drops the host closest to a clean record. The caller
+// must hold lock.
+func (l *BanList) forgetLowestScore() {
+	lowest := ""
+	for host, score := range l.scores {
+		if lowest == "" || score < l.scores[lowest] {
+			lowest = host
+		}
+	}
+	delete(l.scores, lowest)
+}
+
+func (l *BanList) IsBanned(host string) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	ban, ok := l.bans[host]
+	if !ok {
+		return false
+	}
+	if time.Now().After(ban.Until) {
+		delete(l.bans, host)
+		return false
+	}
+	return true
+}
+
+// Unban lifts the ban of host and reports whether there was one.
+func (l *BanList) Unban(host string) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	_, ok := l.bans[host]
+	delete(l.bans, host)
+	return ok
+}
+
+// Clear lifts all bans and returns how many there were.
+func (l *BanList) Clear() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	cleared := len(l.bans)
+	l.bans = make(map[string]Ban)
+	return cleared
+}
+
+// List returns the bans in effect sorted by host.
+func (l *BanList) List() []Ban {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := time.Now()
+	bans := []Ban{}
+	for host, ban := range l.bans {
+		if now.After(ban.Until) {
+			delete(l.bans, host)
+			continue
+		}
+		bans = append(bans, ban)
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Host < bans[j].Host
+	})
+	return bans
+}
+
+func banListProto(bans []Ban) *proto.BanList {
+	list := &proto.BanList{}
+	for _, ban := range bans {
+		list.Bans = append(list.Bans, &proto.BanEntry{
+			Host:   ban.Host,
+			Until:  ban.Until.Unix(),
+			Reason: ban.Reason,
+		})
+	}
+	return list
+}
+
+// Save writes the bans in effect to path. Scores are not saved.
+func (l *BanList) Save(path string) error {
+	b, err := pb.Marshal(banListProto(l.List()))
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(path, b, 0644)
+}
+
+// LoadBanList restores the bans saved with BanList.Save, leaving out the
+// ones that ended in the meantime. A missing file yields an empty list.
+func LoadBanList(path string) (*BanList, error) {
+	l := NewBanList()
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	list := &proto.BanList{}
+	if err := pb.Unmarshal(b, list); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, e := range list.Bans {
+		until := time.Unix(e.Until, 0)
+		if now.After(until) {
+			continue
+		}
+		l.bans[e.Host] = Ban{Host: e.Host, Until: until, Reason: e.Reason}
+	}
+	return l, nil
+}
+
+// banKey returns the key a peer is scored and banned by: the host it
+// connects from, or its address when the host is not known.
+func banKey(host, addr string) string {
+	if host != "" {
+		return host
+	}
+	return addr
+}
+
+// isLoopback reports whether host is the local machine.
+func isLoopback(host string) bool {
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (p *remotePeer) banKey() string {
+	return banKey(p.host, p.addr())
+}
+
+// txMisbehavior returns the misbehavior score for sending a transaction
+// rejected with err. Transactions that may just be out of date, or fail
+// local policy only, do not count.
+func txMisbehavior(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidSignature), errors.Is(err, ErrNotOwner), errors.Is(err, ErrInsufficientFunds),
+		errors.Is(err, ErrNoInputs), errors.Is(err, ErrNegativeAmount), errors.Is(err, ErrAmountOverflow):
+		return misbehaviorInvalidTx
+	}
+	return 0
+}
+
+// blockMisbehavior returns the misbehavior score for sending a block
+// rejected with err.
+func blockMisbehavior(err error) int {
+	if errors.Is(err, ErrKnownBlock) || errors.Is(err, ErrOrphanBlock) ||
+		errors.Is(err, ErrStaleBlock) || errors.Is(err, ErrTooManySideBlocks) {
+		return 0
+	}
+	return misbehaviorInvalidBlock
+}
+
+// misbehaving raises the misbehavior score of key. Once it gets banned, its
+// peers are dropped.
+func (n *Node) misbehaving(key string, score int, reason error) {
+	if score == 0 || key == "" {
+		return
+	}
+	if !n.bans.Misbehaving(key, score, reason.Error(), n.BanDuration) {
+		return
+	}
+	n.logger.Infow("banned misbehaving peer", "we", n.ListenAddr, "peer", key, "until", time.Now().Add(n.BanDuration), "reason", reason)
+	for _, p := range n.getPeers() {
+		if p.banKey() == key {
+			n.deletePeer(p)
+		}
+	}
+}
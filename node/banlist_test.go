@@ -0,0 +1,176 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/LDM-A/GoBlocker/proto"
+	"github.com/LDM-A/GoBlocker/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBanListThreshold(t *testing.T) {
+	l := NewBanList()
+	for i := 0; i < banThreshold/misbehaviorInvalidTx-1; i++ {
+		assert.False(t, l.Misbehaving("10.0.0.1", misbehaviorInvalidTx, "bad tx", time.Hour))
+	}
+	assert.False(t, l.IsBanned("10.0.0.1"))
+	assert.True(t, l.Misbehaving("10.0.0.1", misbehaviorInvalidTx, "bad tx", time.Hour))
+	assert.True(t, l.IsBanned("10.0.0.1"))
+	assert.False(t, l.IsBanned("10.0.0.2"))
+
+	// bans run out
+	assert.True(t, l.Misbehaving("10.0.0.3", misbehaviorInvalidBlock, "bad block", -time.Second))
+	assert.False(t, l.IsBanned("10.0.0.3"))
+	bans := l.List()
+	require.Len(t, bans, 1)
+	assert.Equal(t, "10.0.0.1", bans[0].Host)
+	assert.Equal(t, "bad tx", bans[0].Reason)
+
+	assert.True(t, l.Unban("10.0.0.1"))
+	assert.False(t, l.Unban("10.0.0.1"))
+	assert.False(t, l.IsBanned("10.0.0.1"))
+}
+
+func TestBanListPersistence(t *testing.T) {
+	var (
+		file = filepath.Join(t.TempDir(), "bans.dat")
+		l    = NewBanList()
+	)
+	l.Misbehaving("10.0.0.1", banThreshold, "bad block", time.Hour)
+	l.Misbehaving("10.0.0.2", banThreshold, "bad block", -time.Second)
+	l.Misbehaving("10.0.0.3", banThreshold-1, "bad tx", time.Hour)
+	require.Nil(t, l.Save(file))
+
+	loaded, err := LoadBanList(file)
+	require.Nil(t, err)
+	assert.True(t, loaded.IsBanned("10.0.0.1"))
+	assert.Len(t, loaded.List(), 1)
+	// scores are not saved
+	assert.False(t, loaded.Misbehaving("10.0.0.3", 1, "bad tx", time.Hour))
+
+	empty, err := LoadBanList(filepath.Join(t.TempDir(), "missing.dat"))
+	require.Nil(t, err)
+	assert.Empty(t, empty.List())
+}
+
+func TestHandleTransactionBansMisbehavingHost(t *testing.T) {
+	var (
+		n     = newTestNode(t, ServerConfig{Version: "Blocker-1"})
+		ctx   = remoteContext("10.0.0.7")
+		admin = &adminServer{node: n}
+	)
+	for i := 0; i < banThreshold/misbehaviorInvalidTx; i++ {
+		badSig := makeGenesisSpend(t, n.chain, 10)
+		badSig.Outputs[0].Amount = 20
+		_, err := n.HandleTransaction(ctx, badSig)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+	_, err := n.HandleTransaction(ctx, makeGenesisSpend(t, n.chain, 400))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	bans, err := admin.ListBans(context.Background(), &proto.Ack{})
+	require.Nil(t, err)
+	require.Len(t, bans.Bans, 1)
+	assert.Equal(t, "10.0.0.7", bans.Bans[0].Host)
+
+	cleared, err := admin.ClearBans(context.Background(), &proto.ClearBansRequest{Host: "10.0.0.7"})
+	require.Nil(t, err)
+	assert.Equal(t, int32(1), cleared.Cleared)
+	_, err = n.HandleTransaction(ctx, makeGenesisSpend(t, n.chain, 400))
+	assert.Nil(t, err)
+}
+
+func TestHandleTransactionTrustsLoopback(t *testing.T) {
+	n := newTestNode(t, ServerConfig{Version: "Blocker-1"})
+
+	for i := 0; i < banThreshold/misbehaviorInvalidTx+1; i++ {
+		badSig := makeGenesisSpend(t, n.chain, 10)
+		badSig.Outputs[0].Amount = 20
+		_, err := n.HandleTransaction(testContext(), badSig)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+	assert.Empty(t, n.bans.List())
+	assert.Empty(t, n.bans.scores)
+}
+
+func TestBanListForgetsLowestScore(t *testing.T) {
+	l := NewBanList()
+	l.Misbehaving("suspect", banThreshold-1, "bad tx", time.Hour)
+	for i := 1; i < maxTrackedScores; i++ {
+		l.Misbehaving(fmt.Sprint(i), 1, "bad tx", time.Hour)
+	}
+	l.Misbehaving("new", 1, "bad tx", time.Hour)
+
+	assert.Len(t, l.scores, maxTrackedScores)
+	assert.Equal(t, 1, l.scores["new"])
+	assert.True(t, l.Misbehaving("suspect", 1, "bad tx", time.Hour))
+}
+
+func TestAdminSocket(t *testing.T) {
+	var (
+		path = filepath.Join(t.TempDir(), "admin.sock")
+		n    = newTestNode(t, ServerConfig{Version: "Blocker-1"})
+	)
+	require.Nil(t, n.serveAdmin(path))
+	t.Cleanup(n.adminServer.Stop)
+	info, err := os.Stat(path)
+	require.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	n.bans.Misbehaving("10.0.0.1", banThreshold, "bad block", time.Hour)
+	conn, err := grpc.Dial("unix://"+path, grpc.WithInsecure())
+	require.Nil(t, err)
+	defer conn.Close()
+	bans, err := proto.NewAdminClient(conn).ListBans(context.Background(), &proto.Ack{})
+	require.Nil(t, err)
+	require.Len(t, bans.Bans, 1)
+	assert.Equal(t, "10.0.0.1", bans.Bans[0].Host)
+}
+
+func TestStartLoadsStateBeforeAdmin(t *testing.T) {
+	var (
+		dir  = t.TempDir()
+		path = filepath.Join(dir, "admin.sock")
+		n    = newTestNode(t, ServerConfig{
+			Version:     "Blocker-1",
+			ChainFile:   filepath.Join(dir, "chain.dat"),
+			AdminSocket: path,
+		})
+	)
+	require.Nil(t, os.WriteFile(n.ChainFile, []byte("not a chain"), 0644))
+
+	assert.NotNil(t, n.Start(freeAddr(t), nil))
+	_, err := os.Stat(path)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+	assert.Nil(t, n.adminServer)
+}
+
+func TestInvalidBlockBansPeer(t *testing.T) {
+	n := newTestNode(t, ServerConfig{Version: "Blocker-1"})
+	honest := addFakePeer(t, n, "honest", func(*proto.PeerMessage) error { return nil })
+	liar := addFakePeer(t, n, "liar", func(*proto.PeerMessage) error { return nil })
+
+	// blocks on unknown parents are not the peer's fault
+	orphan := blockOn(util.RandomBlock())
+	require.True(t, n.startRequest(honest, blockInv(orphan)))
+	n.handleData(honest, &proto.InventoryData{Blocks: []*proto.Block{orphan}})
+	assert.True(t, connectedTo(n, "honest")())
+
+	unsigned := blockOn(genesisBlock(t, n.chain))
+	unsigned.Signature = nil
+	require.True(t, n.startRequest(liar, blockInv(unsigned)))
+	n.handleData(liar, &proto.InventoryData{Blocks: []*proto.Block{unsigned}})
+	assert.False(t, connectedTo(n, "liar")())
+	assert.True(t, n.bans.IsBanned("liar"))
+	assert.True(t, errors.Is(n.connect("liar"), errBanned))
+}
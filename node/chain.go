@@ -3,16 +3,56 @@ package node
 import (
 	"bytes"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"os"
+	"sync"
 
 	"github.com/LDM-A/GoBlocker/crypto"
 	"github.com/LDM-A/GoBlocker/proto"
 	"github.com/LDM-A/GoBlocker/types"
+	"github.com/LDM-A/GoBlocker/util"
+
+	pb "github.com/golang/protobuf/proto"
 )
 
 const seed = "f3c6d62c34725bd8c0c176738425d4d9e4a2f4d280886714f47e0acd250da504"
 
+var (
+	ErrInvalidSignature  = errors.New("invalid transaction signature")
+	ErrMissingInput      = errors.New("missing input")
+	ErrSpentInput        = errors.New("input already spent")
+	ErrInsufficientFunds = errors.New("insufficient balance")
+	ErrNoInputs          = errors.New("transaction has no inputs")
+	ErrNotOwner          = errors.New("input not signed by the owner of the output")
+	ErrNegativeAmount    = errors.New("negative output amount")
+	ErrAmountOverflow    = errors.New("amount above the money supply")
+	ErrKnownBlock        = errors.New("block already known")
+	ErrOrphanBlock       = errors.New("unknown previous block")
+	ErrInvalidHeight     = errors.New("invalid block height")
+	ErrUnknownValidator  = errors.New("block not sealed by a validator")
+	ErrStaleBlock        = errors.New("block forks off too deep below the tip")
+	ErrTooManySideBlocks = errors.New("too many side branch blocks")
+)
+
+// maxMoney bounds every amount, single outputs as well as the sums of
+// inputs and outputs, so adding amounts up never overflows.
+const maxMoney int64 = 21_000_000 * 100_000_000
+
+// sigCacheSize bounds the number of verified input signatures remembered
+// between mempool admission and block validation.
+const sigCacheSize = 100_000
+
+const (
+	// maxSideBlocks bounds the number of blocks kept on side branches.
+	maxSideBlocks = 1000
+	// maxForkDepth is how far below the tip a side branch may fork off.
+	// Older side blocks are pruned, so the chain never reorganizes deeper.
+	maxForkDepth = 100
+)
+
 type HeaderList struct {
+	lock    sync.RWMutex
 	headers []*proto.Header
 }
 
@@ -23,10 +63,23 @@ func NewHeaderList() *HeaderList {
 }
 
 func (list *HeaderList) Add(h *proto.Header) {
+	list.lock.Lock()
+	defer list.lock.Unlock()
 	list.headers = append(list.headers, h)
 }
 
+// Pop removes and returns the last header of the list.
+func (list *HeaderList) Pop() *proto.Header {
+	list.lock.Lock()
+	defer list.lock.Unlock()
+	last := list.headers[len(list.headers)-1]
+	list.headers = list.headers[:len(list.headers)-1]
+	return last
+}
+
 func (list *HeaderList) Len() int {
+	list.lock.RLock()
+	defer list.lock.RUnlock()
 	return len(list.headers)
 }
 
@@ -38,14 +91,42 @@ type UTXO struct {
 	Hash     string
 	OutIndex int
 	Amount   int64
-	Spent    bool
+	// Address is the owner of the output, only the key of that address can
+	// spend it.
+	Address []byte
+	Spent   bool
+}
+
+// ChainUpdate describes how the main chain changed after processing a
+// block. Disconnected blocks are listed tip first, connected blocks in chain
+// order.
+type ChainUpdate struct {
+	Connected    []*proto.Block
+	Disconnected []*proto.Block
 }
 
 type Chain struct {
+	// lock serializes block processing.
+	lock       sync.Mutex
 	blockStore BlockStorer
 	txStore    TXStorer
 	utxoStore  UTXOStorer
+	txIndex    TXIndexStorer
 	headers    *HeaderList
+	sigCache   *types.SigCache
+	// heights holds the height of every known block, including blocks on
+	// side branches.
+	heights map[string]int
+	// side holds the blocks not on the main chain.
+	side map[string]sideBlock
+	// validators are the keys allowed to seal blocks, any key is accepted
+	// while it is empty.
+	validators map[string]bool
+}
+
+type sideBlock struct {
+	prevHash string
+	height   int
 }
 
 func NewChain(bs BlockStorer, txStore TXStorer) *Chain {
@@ -53,15 +134,41 @@ func NewChain(bs BlockStorer, txStore TXStorer) *Chain {
 		blockStore: bs,
 		txStore:    txStore,
 		utxoStore:  newMemoryUTXOStore(),
+		txIndex:    newMemoryTXIndexStore(),
 		headers:    NewHeaderList(),
+		sigCache:   types.NewSigCache(sigCacheSize),
+		heights:    make(map[string]int),
+		side:       make(map[string]sideBlock),
+		validators: make(map[string]bool),
 	}
 	chain.addBlock(createGenesisBlock())
 
 	return chain
 }
 
+// SetValidators restricts the blocks accepted to the ones sealed by one of
+// keys. Blocks of any key are accepted when keys is empty.
+func (c *Chain) SetValidators(keys []*crypto.PublicKey) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.validators = make(map[string]bool, len(keys))
+	for _, key := range keys {
+		c.validators[hex.EncodeToString(key.Bytes())] = true
+	}
+}
+
+// checkProducer checks that b was sealed by one of the validators.
+func (c *Chain) checkProducer(b *proto.Block) error {
+	if len(c.validators) == 0 || c.validators[hex.EncodeToString(b.PublicKey)] {
+		return nil
+	}
+	return fmt.Errorf("%w: %x", ErrUnknownValidator, b.PublicKey)
+}
+
 func (list *HeaderList) Get(index int) *proto.Header {
-	if index > list.Height() {
+	list.lock.RLock()
+	defer list.lock.RUnlock()
+	if index >= len(list.headers) {
 		panic("index too high")
 	}
 	return list.headers[index]
@@ -72,30 +179,248 @@ func (c *Chain) Height() int {
 }
 
 func (c *Chain) AddBlock(b *proto.Block) error {
-	if err := c.ValidateBlock(b); err != nil {
-		return err
+	_, err := c.ProcessBlock(b)
+	return err
+}
+
+// ProcessBlock adds the block to the chain. A block extending the tip is
+// connected right away. A block on another branch is kept aside, and once its
+// branch grows longer than the main chain the chain switches to it.
+func (c *Chain) ProcessBlock(b *proto.Block) (*ChainUpdate, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !types.VerifyBlock(b) {
+		return nil, fmt.Errorf("invalid block signature")
+	}
+	if err := c.checkProducer(b); err != nil {
+		return nil, err
+	}
+	hash := hex.EncodeToString(types.HashBlock(b))
+	if _, ok := c.heights[hash]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrKnownBlock, hash)
+	}
+	prevHash := hex.EncodeToString(b.Header.PreviousHash)
+	prevHeight, ok := c.heights[prevHash]
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrOrphanBlock, prevHash)
+	}
+	if int(b.Header.Height) != prevHeight+1 {
+		return nil, fmt.Errorf("%w: %d on a parent at height %d", ErrInvalidHeight, b.Header.Height, prevHeight)
+	}
+
+	if prevHeight == c.Height() && c.isMainChain(prevHash) {
+		if err := c.ValidateBlock(b); err != nil {
+			return nil, err
+		}
+		if err := c.addBlock(b); err != nil {
+			return nil, err
+		}
+		if err := c.pruneSideBlocks(); err != nil {
+			return nil, err
+		}
+		return &ChainUpdate{Connected: []*proto.Block{b}}, nil
+	}
+
+	if prevHeight+1+maxForkDepth <= c.Height() {
+		return nil, fmt.Errorf("%w: parent at height %d, tip at %d", ErrStaleBlock, prevHeight, c.Height())
+	}
+	if len(c.side) >= maxSideBlocks {
+		return nil, ErrTooManySideBlocks
+	}
+	if err := c.blockStore.Put(b); err != nil {
+		return nil, err
+	}
+	c.heights[hash] = prevHeight + 1
+	c.side[hash] = sideBlock{prevHash: prevHash, height: prevHeight + 1}
+	if prevHeight+1 <= c.Height() {
+		return &ChainUpdate{}, nil
+	}
+	return c.reorganize(b)
+}
+
+// reorganize switches the main chain to the branch ending in tip. When a
+// block of the branch turns out to be invalid the original chain is restored
+// and the invalid block is dropped along with the blocks built on it.
+func (c *Chain) reorganize(tip *proto.Block) (*ChainUpdate, error) {
+	var branch []*proto.Block
+	for b := tip; ; {
+		branch = append([]*proto.Block{b}, branch...)
+		prevHash := hex.EncodeToString(b.Header.PreviousHash)
+		if c.isMainChain(prevHash) {
+			break
+		}
+		prev, err := c.blockStore.Get(prevHash)
+		if err != nil {
+			return nil, err
+		}
+		b = prev
+	}
+
+	forkHeight := c.heights[hex.EncodeToString(branch[0].Header.PreviousHash)]
+	var disconnected []*proto.Block
+	for c.Height() > forkHeight {
+		b, err := c.disconnectTip()
+		if err != nil {
+			return nil, err
+		}
+		disconnected = append(disconnected, b)
+	}
+
+	for i, b := range branch {
+		err := c.ValidateBlock(b)
+		if err == nil {
+			err = c.addBlock(b)
+		}
+		if err == nil {
+			continue
+		}
+		for j := 0; j < i; j++ {
+			if _, err := c.disconnectTip(); err != nil {
+				return nil, err
+			}
+		}
+		for j := len(disconnected) - 1; j >= 0; j-- {
+			if err := c.addBlock(disconnected[j]); err != nil {
+				return nil, err
+			}
+		}
+		// Forget the invalid block so the branch can't be extended further.
+		if err := c.dropSideBlock(hex.EncodeToString(types.HashBlock(b))); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("reorganization to %x failed: %w", types.HashBlock(tip), err)
+	}
+
+	for _, b := range branch {
+		delete(c.side, hex.EncodeToString(types.HashBlock(b)))
+	}
+	for _, b := range disconnected {
+		hash := hex.EncodeToString(types.HashBlock(b))
+		c.side[hash] = sideBlock{
+			prevHash: hex.EncodeToString(b.Header.PreviousHash),
+			height:   c.heights[hash],
+		}
+	}
+	if err := c.pruneSideBlocks(); err != nil {
+		return nil, err
+	}
+	return &ChainUpdate{
+		Connected:    branch,
+		Disconnected: disconnected,
+	}, nil
+}
+
+// dropSideBlock forgets the side block with the given hash and every side
+// block built on it.
+func (c *Chain) dropSideBlock(hash string) error {
+	drop := map[string]bool{hash: true}
+	for grown := true; grown; {
+		grown = false
+		for h, b := range c.side {
+			if !drop[h] && drop[b.prevHash] {
+				drop[h] = true
+				grown = true
+			}
+		}
+	}
+	for h := range drop {
+		delete(c.side, h)
+		delete(c.heights, h)
+		if err := c.blockStore.Delete(h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneSideBlocks drops the side blocks that are maxForkDepth or more below
+// the tip, they can no longer become part of the main chain.
+func (c *Chain) pruneSideBlocks() error {
+	for hash, b := range c.side {
+		if b.height+maxForkDepth > c.Height() {
+			continue
+		}
+		if err := c.dropSideBlock(hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// disconnectTip removes the last block from the main chain and undoes its
+// changes to the utxo set.
+func (c *Chain) disconnectTip() (*proto.Block, error) {
+	b, err := c.GetBlockByHeight(c.Height())
+	if err != nil {
+		return nil, err
+	}
+	for i := len(b.Transactions) - 1; i >= 0; i-- {
+		tx := b.Transactions[i]
+		if err := c.txIndex.Delete(hex.EncodeToString(types.HashTransaction(tx))); err != nil {
+			return nil, err
+		}
+		for _, utxo := range outputUTXOs(tx) {
+			if err := c.utxoStore.Delete(fmt.Sprintf("%s_%d", utxo.Hash, utxo.OutIndex)); err != nil {
+				return nil, err
+			}
+		}
+		for _, input := range tx.Inputs {
+			utxo, err := c.utxoStore.Get(outpointKey(input))
+			if err != nil {
+				return nil, err
+			}
+			unspent := *utxo
+			unspent.Spent = false
+			if err := c.utxoStore.Put(&unspent); err != nil {
+				return nil, err
+			}
+		}
 	}
-	return c.addBlock(b)
+	c.headers.Pop()
+	return b, nil
+}
+
+// isMainChain reports whether the block with the given hash is part of the
+// main chain.
+func (c *Chain) isMainChain(hash string) bool {
+	height, ok := c.heights[hash]
+	if !ok || height > c.Height() {
+		return false
+	}
+	return hex.EncodeToString(types.HashHeader(c.headers.Get(height))) == hash
 }
 
 func (c *Chain) addBlock(b *proto.Block) error {
 
 	// Add the header to the list of headers
 	c.headers.Add(b.Header)
+	var (
+		blockHash = hex.EncodeToString(types.HashBlock(b))
+		loc       = &TXLocation{BlockHash: blockHash, Height: c.Height()}
+	)
+	c.heights[blockHash] = loc.Height
 
 	for _, tx := range b.Transactions {
 		if err := c.txStore.Put(tx); err != nil {
 			return err
 		}
-		hash := hex.EncodeToString(types.HashTransaction(tx))
-
-		for it, output := range tx.Outputs {
-			utxo := &UTXO{
-				Hash:     hash,
-				Amount:   output.Amount,
-				OutIndex: it,
-				Spent:    false,
+		if err := c.txIndex.Put(hex.EncodeToString(types.HashTransaction(tx)), loc); err != nil {
+			return err
+		}
+		for _, input := range tx.Inputs {
+			utxo, err := c.utxoStore.Get(outpointKey(input))
+			if err != nil {
+				return err
 			}
+			spent := *utxo
+			spent.Spent = true
+			if err := c.utxoStore.Put(&spent); err != nil {
+				return err
+			}
+		}
+
+		for _, utxo := range outputUTXOs(tx) {
 			if err := c.utxoStore.Put(utxo); err != nil {
 				return err
 			}
@@ -120,11 +445,32 @@ func (c *Chain) GetBlockByHeight(height int) (*proto.Block, error) {
 	return c.GetBlockByHash(hash)
 }
 
+// HasBlock reports whether the block with the given hex encoded hash is
+// known, on the main chain or a side branch.
+func (c *Chain) HasBlock(hash string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	_, ok := c.heights[hash]
+	return ok
+}
+
+// GetTransactionLocation returns where the transaction with the given hex
+// encoded hash was included in the main chain.
+func (c *Chain) GetTransactionLocation(hash string) (*TXLocation, error) {
+	return c.txIndex.Get(hash)
+}
+
 func (c *Chain) ValidateBlock(b *proto.Block) error {
 	// validate sign of block
 	if !types.VerifyBlock(b) {
 		return fmt.Errorf("invalid block signature")
 	}
+	if err := c.checkProducer(b); err != nil {
+		return err
+	}
+	if int(b.Header.Height) != c.Height()+1 {
+		return fmt.Errorf("%w: %d on a tip at height %d", ErrInvalidHeight, b.Header.Height, c.Height())
+	}
 	// Validate if the previous hash is actually the hash of the current block
 	currentBlock, err := c.GetBlockByHeight(c.Height())
 	if err != nil {
@@ -135,42 +481,220 @@ func (c *Chain) ValidateBlock(b *proto.Block) error {
 		return fmt.Errorf("invalid previous block hash")
 	}
 
-	for _, tx := range b.Transactions {
-		if c.ValidateTransaction(tx); err != nil {
+	return c.validateTransactions(b.Transactions)
+}
+
+// CheckBlockTransactions validates txx as the transactions of a block on
+// top of the current tip, so a validator can check them before sealing.
+func (c *Chain) CheckBlockTransactions(txx []*proto.Transaction) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.validateTransactions(txx)
+}
+
+func (c *Chain) validateTransactions(txx []*proto.Transaction) error {
+	if err := c.sigCache.VerifyTransactions(txx); err != nil {
+		return err
+	}
+	// Transactions may spend outputs of transactions earlier in the block.
+	var (
+		spent   = make(map[string]bool)
+		created = make(map[string]*UTXO)
+		lookup  = func(input *proto.TxInput) (*UTXO, error) {
+			if utxo, ok := created[outpointKey(input)]; ok {
+				return utxo, nil
+			}
+			return c.utxoStore.Get(outpointKey(input))
+		}
+	)
+	for _, tx := range txx {
+		if _, err := c.validateInputs(tx, lookup); err != nil {
 			return err
 		}
+		for _, input := range tx.Inputs {
+			key := outpointKey(input)
+			if spent[key] {
+				return fmt.Errorf("%w: %s is spent twice in block", ErrSpentInput, key)
+			}
+			spent[key] = true
+		}
+		for _, utxo := range outputUTXOs(tx) {
+			created[fmt.Sprintf("%s_%d", utxo.Hash, utxo.OutIndex)] = utxo
+		}
 	}
 	return nil
 }
 
 func (c *Chain) ValidateTransaction(tx *proto.Transaction) error {
-	if !types.VerifyTransaction(tx) {
-		return fmt.Errorf("invalid transaction")
+	_, err := c.CheckTransaction(tx)
+	return err
+}
+
+// CheckTransaction validates the transaction like ValidateTransaction and
+// returns the fee it pays, the difference between its inputs and outputs.
+func (c *Chain) CheckTransaction(tx *proto.Transaction) (int64, error) {
+	if !c.VerifyTransaction(tx) {
+		return 0, ErrInvalidSignature
+	}
+	return c.validateInputs(tx, c.lookupUTXO)
+}
+
+// CheckPendingTransaction is like CheckTransaction but also lets tx spend
+// outputs of transactions still pending in the pool.
+func (c *Chain) CheckPendingTransaction(tx *proto.Transaction, pool *Mempool) (int64, error) {
+	if !c.VerifyTransaction(tx) {
+		return 0, ErrInvalidSignature
 	}
+	pool.lock.RLock()
+	defer pool.lock.RUnlock()
+	return c.checkPendingInputs(tx, pool)
+}
+
+// checkPendingInputs validates the inputs of tx, which may spend outputs of
+// transactions pending in pool. The caller must hold the pool lock.
+func (c *Chain) checkPendingInputs(tx *proto.Transaction, pool *Mempool) (int64, error) {
+	return c.validateInputs(tx, func(input *proto.TxInput) (*UTXO, error) {
+		if utxo, ok := pool.pendingOutput(input); ok {
+			return utxo, nil
+		}
+		return c.lookupUTXO(input)
+	})
+}
 
+// VerifyTransaction checks the input signatures of the transaction through
+// the signature cache shared with block validation.
+func (c *Chain) VerifyTransaction(tx *proto.Transaction) bool {
+	return c.sigCache.VerifyTransaction(tx)
+}
+
+func (c *Chain) SigCacheStats() types.SigCacheStats {
+	return c.sigCache.Stats()
+}
+
+func (c *Chain) lookupUTXO(input *proto.TxInput) (*UTXO, error) {
+	return c.utxoStore.Get(outpointKey(input))
+}
+
+func (c *Chain) validateInputs(tx *proto.Transaction, lookup func(*proto.TxInput) (*UTXO, error)) (int64, error) {
 	// check if all inputs are unspent by querying the utxo storage
-	sumInputs := 0
+	var sumInputs int64
 	nInputs := len(tx.Inputs)
 	hash := types.HashTransaction(tx)
+	if nInputs == 0 {
+		return 0, fmt.Errorf("%w: %x", ErrNoInputs, hash)
+	}
+	seen := make(map[string]bool, nInputs)
 	for i := 0; i < nInputs; i++ {
-		key := fmt.Sprintf("%s_%d", tx.Inputs[i].PrevTxHash, i)
-		utxo, err := c.utxoStore.Get(key)
-		sumInputs += int(utxo.Amount)
+		key := outpointKey(tx.Inputs[i])
+		if seen[key] {
+			return 0, fmt.Errorf("%w: %x spends %s twice", ErrSpentInput, hash, key)
+		}
+		seen[key] = true
+		utxo, err := lookup(tx.Inputs[i])
 		if err != nil {
-			return err
+			return 0, fmt.Errorf("%w: %s", ErrMissingInput, key)
+		}
+		if sumInputs, err = addAmount(sumInputs, utxo.Amount); err != nil {
+			return 0, fmt.Errorf("%w: inputs of %x", err, hash)
 		}
 		if utxo.Spent {
-			return fmt.Errorf("Output %d of %s is already spent", i, hash)
+			return 0, fmt.Errorf("%w: input %d of %x spends %s", ErrSpentInput, i, hash, key)
+		}
+		if !ownsOutput(tx.Inputs[i].PublicKey, utxo) {
+			return 0, fmt.Errorf("%w: input %d of %x spends %s", ErrNotOwner, i, hash, key)
 		}
 	}
-	sumOuts := 0
-	for _, output := range tx.Outputs {
-		sumOuts += int(output.Amount)
+	var sumOuts int64
+	for i, output := range tx.Outputs {
+		if output.Amount < 0 {
+			return 0, fmt.Errorf("%w: output %d of %x", ErrNegativeAmount, i, hash)
+		}
+		var err error
+		if sumOuts, err = addAmount(sumOuts, output.Amount); err != nil {
+			return 0, fmt.Errorf("%w: output %d of %x", err, i, hash)
+		}
 	}
 	if sumInputs < sumOuts {
-		return fmt.Errorf("Insufficient Balance")
+		return 0, fmt.Errorf("%w: inputs %d, outputs %d", ErrInsufficientFunds, sumInputs, sumOuts)
 	}
-	return nil
+	return sumInputs - sumOuts, nil
+}
+
+// addAmount adds two amounts that are each within [0, maxMoney] and fails
+// if the sum is not.
+func addAmount(sum, amount int64) (int64, error) {
+	if amount < 0 || amount > maxMoney || sum > maxMoney-amount {
+		return 0, ErrAmountOverflow
+	}
+	return sum + amount, nil
+}
+
+// ownsOutput reports whether pubKey belongs to the address utxo was paid to.
+func ownsOutput(pubKey []byte, utxo *UTXO) bool {
+	if len(pubKey) != crypto.PubKeyLen {
+		return false
+	}
+	return bytes.Equal(crypto.PublicKeyFromBytes(pubKey).Address().Bytes(), utxo.Address)
+}
+
+// outputUTXOs returns the unspent outputs created by tx.
+func outputUTXOs(tx *proto.Transaction) []*UTXO {
+	hash := hex.EncodeToString(types.HashTransaction(tx))
+	utxos := make([]*UTXO, len(tx.Outputs))
+	for it, output := range tx.Outputs {
+		utxos[it] = &UTXO{
+			Hash:     hash,
+			Amount:   output.Amount,
+			OutIndex: it,
+			Address:  output.Address,
+			Spent:    false,
+		}
+	}
+	return utxos
+}
+
+// Save writes the blocks of the main chain after genesis to path, so they can
+// be restored with LoadChainSnapshot after a restart.
+func (c *Chain) Save(path string) error {
+	snapshot := &proto.ChainSnapshot{}
+	c.lock.Lock()
+	for height := 1; height <= c.Height(); height++ {
+		b, err := c.GetBlockByHeight(height)
+		if err != nil {
+			c.lock.Unlock()
+			return err
+		}
+		snapshot.Blocks = append(snapshot.Blocks, b)
+	}
+	c.lock.Unlock()
+
+	b, err := pb.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(path, b, 0644)
+}
+
+// LoadChainSnapshot reads the blocks saved by Chain.Save, oldest first. A
+// missing file is not an error and yields no blocks.
+func LoadChainSnapshot(path string) ([]*proto.Block, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &proto.ChainSnapshot{}
+	if err := pb.Unmarshal(b, snapshot); err != nil {
+		return nil, fmt.Errorf("corrupt chain file %s: %w", path, err)
+	}
+	return snapshot.Blocks, nil
+}
+
+// outpointKey is the key of the utxo the input spends.
+func outpointKey(input *proto.TxInput) string {
+	return fmt.Sprintf("%s_%d", hex.EncodeToString(input.PrevTxHash), input.PrevOutIndex)
 }
 
 func createGenesisBlock() *proto.Block {
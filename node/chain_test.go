@@ -1,7 +1,10 @@
 package node
 
 import (
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"math"
 	"testing"
 
 	"github.com/LDM-A/GoBlocker/crypto"
@@ -18,6 +21,7 @@ func RandomBlock(t *testing.T, chain *Chain) *proto.Block {
 	prevBlock, err := chain.GetBlockByHeight(chain.Height())
 	require.Nil(t, err)
 	block.Header.PreviousHash = types.HashBlock(prevBlock)
+	block.Header.Height = int32(chain.Height() + 1)
 	types.SignBlock(privKey, block)
 	return block
 }
@@ -144,3 +148,271 @@ func TestAddBlockWithTx(t *testing.T) {
 	require.Nil(t, chain.AddBlock(block))
 
 }
+
+func TestValidateBlockUsesSigCache(t *testing.T) {
+	var (
+		chain     = NewChain(NewMemoryBlockStore(), newMemoryTXStore())
+		block     = RandomBlock(t, chain)
+		privKey   = crypto.NewPrivateKeyFromSeedStr(seed)
+		recipient = crypto.GeneratePrivateKey().Public().Address().Bytes()
+	)
+	prevTx, err := chain.txStore.Get("8ada2924e739ee52ea194129ccc96ba93e9a87cbe465b912f381334cd7b939d0")
+	require.Nil(t, err)
+
+	tx := &proto.Transaction{
+		Version: 1,
+		Inputs: []*proto.TxInput{
+			{
+				PrevTxHash:   types.HashTransaction(prevTx),
+				PrevOutIndex: 0,
+				PublicKey:    privKey.Public().Bytes(),
+			},
+		},
+		Outputs: []*proto.TxOutput{
+			{
+				Amount:  1000,
+				Address: recipient,
+			},
+		},
+	}
+	tx.Inputs[0].Signature = types.SignTransaction(privKey, tx).Bytes()
+
+	// mempool admission verifies the signature first
+	require.Nil(t, chain.ValidateTransaction(tx))
+	assert.Equal(t, uint64(0), chain.SigCacheStats().Hits)
+
+	block.Transactions = append(block.Transactions, tx)
+	types.SignBlock(privKey, block)
+	require.Nil(t, chain.AddBlock(block))
+
+	stats := chain.SigCacheStats()
+	assert.Equal(t, uint64(1), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+}
+
+func TestValidateTransactionSpentInput(t *testing.T) {
+	var (
+		chain   = NewChain(NewMemoryBlockStore(), newMemoryTXStore())
+		block   = RandomBlock(t, chain)
+		privKey = crypto.NewPrivateKeyFromSeedStr(seed)
+		tx      = makeGenesisSpend(t, chain, 100)
+	)
+	require.Nil(t, chain.ValidateTransaction(tx))
+
+	block.Transactions = append(block.Transactions, tx)
+	types.SignBlock(privKey, block)
+	require.Nil(t, chain.AddBlock(block))
+
+	err := chain.ValidateTransaction(makeGenesisSpend(t, chain, 100))
+	assert.True(t, errors.Is(err, ErrSpentInput))
+}
+
+func TestValidateTransactionMalformed(t *testing.T) {
+	var (
+		chain   = NewChain(NewMemoryBlockStore(), newMemoryTXStore())
+		genesis = crypto.NewPrivateKeyFromSeedStr(seed)
+	)
+	// nothing to verify, and a fee rate of 0/0
+	empty := &proto.Transaction{
+		Version: 1,
+		Outputs: []*proto.TxOutput{{Amount: 0, Address: genesis.Public().Address().Bytes()}},
+	}
+	err := chain.ValidateTransaction(empty)
+	assert.True(t, errors.Is(err, ErrNoInputs))
+
+	// a valid signature, but not by the key the genesis output was paid to
+	thief := crypto.GeneratePrivateKey()
+	stolen := makeGenesisSpend(t, chain, 100)
+	stolen.Inputs[0].PublicKey = thief.Public().Bytes()
+	stolen.Inputs[0].Signature = types.SignTransaction(thief, stolen).Bytes()
+	err = chain.ValidateTransaction(stolen)
+	assert.True(t, errors.Is(err, ErrNotOwner))
+
+	negative := makeGenesisSpend(t, chain, 100)
+	negative.Outputs = append(negative.Outputs, &proto.TxOutput{Amount: -100, Address: genesis.Public().Address().Bytes()})
+	negative.Inputs[0].Signature = types.SignTransaction(genesis, negative).Bytes()
+	err = chain.ValidateTransaction(negative)
+	assert.True(t, errors.Is(err, ErrNegativeAmount))
+
+	// two outputs that would wrap the sum of the outputs around to negative
+	overflow := makeGenesisSpend(t, chain, math.MaxInt64)
+	overflow.Outputs = append(overflow.Outputs, &proto.TxOutput{Amount: math.MaxInt64, Address: genesis.Public().Address().Bytes()})
+	overflow.Inputs[0].Signature = types.SignTransaction(genesis, overflow).Bytes()
+	err = chain.ValidateTransaction(overflow)
+	assert.True(t, errors.Is(err, ErrAmountOverflow))
+
+	tooLarge := makeGenesisSpend(t, chain, maxMoney+1)
+	tooLarge.Inputs[0].Signature = types.SignTransaction(genesis, tooLarge).Bytes()
+	err = chain.ValidateTransaction(tooLarge)
+	assert.True(t, errors.Is(err, ErrAmountOverflow))
+}
+
+func TestValidateBlockDoubleSpend(t *testing.T) {
+	var (
+		chain   = NewChain(NewMemoryBlockStore(), newMemoryTXStore())
+		block   = RandomBlock(t, chain)
+		privKey = crypto.NewPrivateKeyFromSeedStr(seed)
+	)
+	block.Transactions = append(block.Transactions,
+		makeGenesisSpend(t, chain, 100),
+		makeGenesisSpend(t, chain, 200),
+	)
+	types.SignBlock(privKey, block)
+
+	err := chain.AddBlock(block)
+	assert.True(t, errors.Is(err, ErrSpentInput))
+}
+
+// blockOn returns a signed block with the given transactions on top of parent.
+func blockOn(parent *proto.Block, txx ...*proto.Transaction) *proto.Block {
+	return sealedBlockOn(crypto.GeneratePrivateKey(), parent, txx...)
+}
+
+func sealedBlockOn(key *crypto.PrivateKey, parent *proto.Block, txx ...*proto.Transaction) *proto.Block {
+	block := util.RandomBlock()
+	block.Header.PreviousHash = types.HashBlock(parent)
+	block.Header.Height = parent.Header.Height + 1
+	block.Transactions = txx
+	types.SignBlock(key, block)
+	return block
+}
+
+func TestChainReorganize(t *testing.T) {
+	var (
+		chain      = NewChain(NewMemoryBlockStore(), newMemoryTXStore())
+		genesis, _ = chain.GetBlockByHeight(0)
+		spend      = makeGenesisSpend(t, chain, 400)
+		a1         = blockOn(genesis, spend)
+		b1         = blockOn(genesis)
+		b2         = blockOn(b1)
+	)
+	require.Nil(t, chain.AddBlock(a1))
+	assert.NotNil(t, chain.ValidateTransaction(makeGenesisSpend(t, chain, 300)))
+
+	// a side branch that is not longer leaves the main chain alone
+	update, err := chain.ProcessBlock(b1)
+	require.Nil(t, err)
+	assert.Empty(t, update.Connected)
+	assert.Empty(t, update.Disconnected)
+	tip, _ := chain.GetBlockByHeight(1)
+	assert.Equal(t, a1, tip)
+
+	update, err = chain.ProcessBlock(b2)
+	require.Nil(t, err)
+	assert.Equal(t, []*proto.Block{b1, b2}, update.Connected)
+	assert.Equal(t, []*proto.Block{a1}, update.Disconnected)
+	assert.Equal(t, 2, chain.Height())
+	tip, _ = chain.GetBlockByHeight(1)
+	assert.Equal(t, b1, tip)
+
+	// the genesis output is unspent again and the output of spend is gone
+	assert.Nil(t, chain.ValidateTransaction(spend))
+	_, err = chain.utxoStore.Get(fmt.Sprintf("%x_0", types.HashTransaction(spend)))
+	assert.NotNil(t, err)
+
+	_, err = chain.ProcessBlock(b2)
+	assert.NotNil(t, err)
+	_, err = chain.ProcessBlock(blockOn(util.RandomBlock()))
+	assert.NotNil(t, err)
+}
+
+func TestChainReorganizeInvalidBranch(t *testing.T) {
+	var (
+		chain      = NewChain(NewMemoryBlockStore(), newMemoryTXStore())
+		genesis, _ = chain.GetBlockByHeight(0)
+		spend      = makeGenesisSpend(t, chain, 400)
+		a1         = blockOn(genesis, spend)
+		b1         = blockOn(genesis)
+		// spends the genesis output a second time on top of a1
+		b2 = blockOn(b1, spend, makeGenesisSpend(t, chain, 300))
+	)
+	require.Nil(t, chain.AddBlock(a1))
+	require.Nil(t, chain.AddBlock(b1))
+
+	_, err := chain.ProcessBlock(b2)
+	assert.True(t, errors.Is(err, ErrSpentInput))
+	assert.Equal(t, 1, chain.Height())
+	tip, _ := chain.GetBlockByHeight(1)
+	assert.Equal(t, a1, tip)
+	assert.NotNil(t, chain.ValidateTransaction(makeGenesisSpend(t, chain, 300)))
+
+	// the invalid block cannot be built upon
+	_, err = chain.ProcessBlock(blockOn(b2))
+	assert.NotNil(t, err)
+}
+
+func TestChainDropsInvalidSubtree(t *testing.T) {
+	var (
+		chain      = NewChain(NewMemoryBlockStore(), newMemoryTXStore())
+		genesis, _ = chain.GetBlockByHeight(0)
+		spend      = makeGenesisSpend(t, chain, 400)
+		a1         = blockOn(genesis)
+		a2         = blockOn(a1)
+		a3         = blockOn(a2)
+		b1         = blockOn(genesis)
+		b2         = blockOn(b1, spend, makeGenesisSpend(t, chain, 300))
+		b3         = blockOn(b2)
+		b4         = blockOn(b3)
+	)
+	for _, b := range []*proto.Block{a1, a2, a3, b1, b2, b3} {
+		require.Nil(t, chain.AddBlock(b))
+	}
+
+	_, err := chain.ProcessBlock(b4)
+	assert.True(t, errors.Is(err, ErrSpentInput))
+	assert.Equal(t, 3, chain.Height())
+	assert.True(t, chain.HasBlock(hex.EncodeToString(types.HashBlock(b1))))
+	for _, b := range []*proto.Block{b2, b3, b4} {
+		assert.False(t, chain.HasBlock(hex.EncodeToString(types.HashBlock(b))))
+	}
+	assert.Len(t, chain.side, 1)
+}
+
+func TestChainPrunesSideBlocks(t *testing.T) {
+	var (
+		chain      = NewChain(NewMemoryBlockStore(), newMemoryTXStore())
+		genesis, _ = chain.GetBlockByHeight(0)
+		side       = blockOn(genesis)
+	)
+	require.Nil(t, chain.AddBlock(RandomBlock(t, chain)))
+	require.Nil(t, chain.AddBlock(side))
+	for chain.Height() < maxForkDepth+1 {
+		require.Nil(t, chain.AddBlock(RandomBlock(t, chain)))
+	}
+
+	assert.False(t, chain.HasBlock(hex.EncodeToString(types.HashBlock(side))))
+	assert.Empty(t, chain.side)
+	_, err := chain.ProcessBlock(blockOn(genesis))
+	assert.True(t, errors.Is(err, ErrStaleBlock))
+}
+
+func TestChainRejectsInvalidHeight(t *testing.T) {
+	var (
+		chain      = NewChain(NewMemoryBlockStore(), newMemoryTXStore())
+		genesis, _ = chain.GetBlockByHeight(0)
+		key        = crypto.GeneratePrivateKey()
+		block      = util.RandomBlock()
+	)
+	block.Header.PreviousHash = types.HashBlock(genesis)
+	block.Header.Height = 5
+	types.SignBlock(key, block)
+
+	_, err := chain.ProcessBlock(block)
+	assert.True(t, errors.Is(err, ErrInvalidHeight))
+	assert.Equal(t, 0, chain.Height())
+}
+
+func TestChainRejectsUnknownValidator(t *testing.T) {
+	var (
+		chain      = NewChain(NewMemoryBlockStore(), newMemoryTXStore())
+		genesis, _ = chain.GetBlockByHeight(0)
+		validator  = crypto.GeneratePrivateKey()
+	)
+	chain.SetValidators([]*crypto.PublicKey{validator.Public()})
+
+	_, err := chain.ProcessBlock(blockOn(genesis))
+	assert.True(t, errors.Is(err, ErrUnknownValidator))
+	assert.Equal(t, 0, chain.Height())
+	require.Nil(t, chain.AddBlock(sealedBlockOn(validator, genesis)))
+	assert.Equal(t, 1, chain.Height())
+}
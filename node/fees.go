@@ -0,0 +1,213 @@
+package node
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+
+	"github.com/LDM-A/GoBlocker/proto"
+	"github.com/LDM-A/GoBlocker/types"
+	"github.com/LDM-A/GoBlocker/util"
+
+	pb "github.com/golang/protobuf/proto"
+)
+
+const (
+	// maxFeeTarget is the highest confirmation target, in blocks, estimates
+	// are given for. Transactions pending for longer count as failures.
+	maxFeeTarget = 25
+	// feeDecay is applied to the collected statistics on every block, so
+	// older blocks weigh less in the estimates.
+	feeDecay = 0.998
+	// feeSuccessThreshold is the share of transactions of a bucket that must
+	// have confirmed within the target for the bucket to qualify.
+	feeSuccessThreshold = 0.85
+	// minBucketSamples is how much data a bucket needs before it is used.
+	minBucketSamples = 5
+)
+
+var ErrNoFeeEstimate = errors.New("not enough data to estimate fee")
+
+type trackedTx struct {
+	height int
+	bucket int
+}
+
+// FeeEstimator learns how fast transactions confirm depending on their fee
+// rate. Pending transactions are grouped in buckets of exponentially
+// growing fee rates, and for every bucket it counts how many of them
+// confirmed within each number of blocks.
+type FeeEstimator struct {
+	lock   sync.Mutex
+	bounds []float64
+	// confirmed[b][t] counts the transactions of bucket b confirmed within
+	// t+1 blocks, total[b] all transactions of bucket b that were confirmed
+	// or given up on.
+	confirmed [][]float64
+	total     []float64
+	tracked   map[string]trackedTx
+}
+
+func NewFeeEstimator() *FeeEstimator {
+	bounds := []float64{0}
+	for rate := 1.0; rate <= 10_000; rate *= 1.25 {
+		bounds = append(bounds, rate)
+	}
+	e := &FeeEstimator{
+		bounds:    bounds,
+		confirmed: make([][]float64, len(bounds)),
+		total:     make([]float64, len(bounds)),
+		tracked:   make(map[string]trackedTx),
+	}
+	for i := range e.confirmed {
+		e.confirmed[i] = make([]float64, maxFeeTarget)
+	}
+	return e
+}
+
+// Track starts following a transaction that entered the mempool at the
+// given chain height.
+func (e *FeeEstimator) Track(hash string, feeRate float64, height int) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.tracked[hash] = trackedTx{height: height, bucket: e.bucket(feeRate)}
+}
+
+// Forget stops following a transaction that left the mempool without being
+// confirmed, counting it as a failure.
+func (e *FeeEstimator) Forget(hash string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if t, ok := e.tracked[hash]; ok {
+		e.total[t.bucket]++
+		delete(e.tracked, hash)
+	}
+}
+
+// ProcessBlock records the confirmation of the tracked transactions
+// included in the block at the given height.
+func (e *FeeEstimator) ProcessBlock(height int, txx []*proto.Transaction) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	for b := range e.total {
+		e.total[b] *= feeDecay
+		for t := range e.confirmed[b] {
+			e.confirmed[b][t] *= feeDecay
+		}
+	}
+	for _, tx := range txx {
+		hash := hex.EncodeToString(types.HashTransaction(tx))
+		t, ok := e.tracked[hash]
+		if !ok {
+			continue
+		}
+		delete(e.tracked, hash)
+		blocks := height - t.height
+		if blocks < 1 {
+			blocks = 1
+		}
+		for i := blocks - 1; i < maxFeeTarget; i++ {
+			e.confirmed[t.bucket][i]++
+		}
+		e.total[t.bucket]++
+	}
+	for hash, t := range e.tracked {
+		if height-t.height >= maxFeeTarget {
+			e.total[t.bucket]++
+			delete(e.tracked, hash)
+		}
+	}
+}
+
+// EstimateFee returns the lowest fee rate at which transactions have
+// reliably confirmed within target blocks.
+func (e *FeeEstimator) EstimateFee(target int) (float64, error) {
+	if target < 1 || target > maxFeeTarget {
+		return 0, fmt.Errorf("target must be between 1 and %d blocks", maxFeeTarget)
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	best := -1
+	for b := len(e.bounds) - 1; b >= 0; b-- {
+		if e.total[b] < minBucketSamples {
+			continue
+		}
+		if e.confirmed[b][target-1]/e.total[b] < feeSuccessThreshold {
+			break
+		}
+		best = b
+	}
+	if best < 0 {
+		return 0, ErrNoFeeEstimate
+	}
+	return e.bounds[best], nil
+}
+
+func (e *FeeEstimator) bucket(feeRate float64) int {
+	if feeRate < 1 {
+		return 0
+	}
+	b := 1 + int(math.Log(feeRate)/math.Log(1.25))
+	if b >= len(e.bounds) {
+		b = len(e.bounds) - 1
+	}
+	// guard against rounding at the bucket edges
+	for b > 0 && e.bounds[b] > feeRate {
+		b--
+	}
+	return b
+}
+
+// Save writes the collected statistics to path. Transactions still being
+// tracked are not saved.
+func (e *FeeEstimator) Save(path string) error {
+	e.lock.Lock()
+	state := &proto.FeeEstimatorState{}
+	for b, bound := range e.bounds {
+		state.Buckets = append(state.Buckets, &proto.FeeBucketStats{
+			MinFeeRate: bound,
+			Total:      e.total[b],
+			Confirmed:  append([]float64{}, e.confirmed[b]...),
+		})
+	}
+	e.lock.Unlock()
+
+	b, err := pb.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(path, b, 0644)
+}
+
+// LoadFeeEstimator restores an estimator saved with FeeEstimator.Save. A
+// missing file yields a fresh estimator.
+func LoadFeeEstimator(path string) (*FeeEstimator, error) {
+	e := NewFeeEstimator()
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return e, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := &proto.FeeEstimatorState{}
+	if err := pb.Unmarshal(b, state); err != nil {
+		return nil, err
+	}
+	if len(state.Buckets) != len(e.bounds) {
+		return nil, fmt.Errorf("fee estimates have %d buckets, expected %d", len(state.Buckets), len(e.bounds))
+	}
+	for i, bucket := range state.Buckets {
+		if bucket.MinFeeRate != e.bounds[i] || len(bucket.Confirmed) != maxFeeTarget {
+			return nil, fmt.Errorf("fee estimates bucket %d does not match", i)
+		}
+		e.total[i] = bucket.Total
+		copy(e.confirmed[i], bucket.Confirmed)
+	}
+	return e, nil
+}
@@ -0,0 +1,103 @@
+package node
+
+import (
+	"encoding/hex"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/LDM-A/GoBlocker/proto"
+	"github.com/LDM-A/GoBlocker/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// trackConfirmed tracks n transactions paying feeRate at height and returns
+// them so they can be confirmed later.
+func trackConfirmed(e *FeeEstimator, n int, feeRate float64, height int) []*proto.Transaction {
+	txx := make([]*proto.Transaction, n)
+	for i := range txx {
+		txx[i] = randomPoolTx()
+		e.Track(hex.EncodeToString(types.HashTransaction(txx[i])), feeRate, height)
+	}
+	return txx
+}
+
+func TestFeeEstimatorBuckets(t *testing.T) {
+	e := NewFeeEstimator()
+	for _, rate := range []float64{0, 0.5, 1, 1.2, 1.25, 3, 99, 1e9} {
+		b := e.bucket(rate)
+		assert.LessOrEqual(t, e.bounds[b], rate)
+		if b+1 < len(e.bounds) {
+			assert.Greater(t, e.bounds[b+1], rate)
+		}
+	}
+}
+
+func TestFeeEstimatorEstimate(t *testing.T) {
+	e := NewFeeEstimator()
+	_, err := e.EstimateFee(1)
+	assert.True(t, errors.Is(err, ErrNoFeeEstimate))
+	_, err = e.EstimateFee(0)
+	assert.NotNil(t, err)
+	_, err = e.EstimateFee(maxFeeTarget + 1)
+	assert.NotNil(t, err)
+
+	for height := 0; height < 10; height++ {
+		fast := trackConfirmed(e, 2, 100, height)
+		slow := trackConfirmed(e, 2, 2, height)
+		e.ProcessBlock(height+1, fast)
+		e.ProcessBlock(height+3, slow)
+	}
+
+	rate, err := e.EstimateFee(1)
+	require.Nil(t, err)
+	assert.Equal(t, e.bounds[e.bucket(100)], rate)
+
+	rate, err = e.EstimateFee(3)
+	require.Nil(t, err)
+	assert.Equal(t, e.bounds[e.bucket(2)], rate)
+}
+
+func TestFeeEstimatorCountsFailures(t *testing.T) {
+	e := NewFeeEstimator()
+	for height := 0; height < 10; height++ {
+		e.ProcessBlock(height+1, trackConfirmed(e, 2, 10, height))
+	}
+	rate, err := e.EstimateFee(1)
+	require.Nil(t, err)
+	assert.Equal(t, e.bounds[e.bucket(10)], rate)
+
+	// dropped transactions count as failures and push the bucket below the
+	// success threshold
+	stuck := trackConfirmed(e, 20, 10, 10)
+	for _, tx := range stuck {
+		e.Forget(hex.EncodeToString(types.HashTransaction(tx)))
+	}
+	_, err = e.EstimateFee(1)
+	assert.True(t, errors.Is(err, ErrNoFeeEstimate))
+}
+
+func TestFeeEstimatorPersistence(t *testing.T) {
+	var (
+		file = filepath.Join(t.TempDir(), "fees.dat")
+		e    = NewFeeEstimator()
+	)
+	for height := 0; height < 10; height++ {
+		e.ProcessBlock(height+1, trackConfirmed(e, 2, 10, height))
+	}
+	want, err := e.EstimateFee(1)
+	require.Nil(t, err)
+	require.Nil(t, e.Save(file))
+
+	loaded, err := LoadFeeEstimator(file)
+	require.Nil(t, err)
+	got, err := loaded.EstimateFee(1)
+	require.Nil(t, err)
+	assert.Equal(t, want, got)
+
+	fresh, err := LoadFeeEstimator(filepath.Join(t.TempDir(), "missing.dat"))
+	require.Nil(t, err)
+	_, err = fresh.EstimateFee(1)
+	assert.True(t, errors.Is(err, ErrNoFeeEstimate))
+}
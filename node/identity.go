@@ -0,0 +1,104 @@
+package node
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/LDM-A/GoBlocker/crypto"
+)
+
+const nonceLen = 32
+
+// handshakeDomain separates handshake signatures from any other use of the
+// node key.
+var handshakeDomain = []byte("GoBlocker handshake")
+
+var (
+	errBadIdentity    = errors.New("peer failed to prove its node id")
+	errSelfConnection = errors.New("connected to ourselves")
+)
+
+// LoadKeyFile reads a private key, like the node identity key, from path,
+// generating and saving a new one when the file does not exist yet.
+func LoadKeyFile(path string) (*crypto.PrivateKey, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		key := crypto.GeneratePrivateKey()
+		seed := hex.EncodeToString(key.Bytes()[:crypto.SeedLen])
+		if err := os.WriteFile(path, []byte(seed+"\n"), 0600); err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	seed, err := hex.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil || len(seed) != crypto.SeedLen {
+		return nil, fmt.Errorf("invalid node key in %s", path)
+	}
+	return crypto.NewPrivateKeyFromSeed(seed), nil
+}
+
+func newNonce() []byte {
+	nonce := make([]byte, nonceLen)
+	if _, err := rand.Read(nonce); err != nil {
+		panic(err)
+	}
+	return nonce
+}
+
+// handshake identifies one connection: the node ids of the dialing and the
+// listening end and the nonce each of them picked. Both ends sign it, so a
+// signature only proves an identity on the connection it was made for and
+// cannot be relayed to one with another end.
+type handshake struct {
+	dialerID      []byte
+	dialerNonce   []byte
+	listenerID    []byte
+	listenerNonce []byte
+}
+
+// Roles sign the handshake under different digests, so the dialer's
+// signature cannot be passed off as the listener's or the other way round.
+const (
+	roleDialer   = "dialer"
+	roleListener = "listener"
+)
+
+func (h *handshake) digest(role string) []byte {
+	d := sha256.New()
+	d.Write(handshakeDomain)
+	d.Write([]byte(role))
+	d.Write(h.dialerID)
+	d.Write(h.dialerNonce)
+	d.Write(h.listenerID)
+	d.Write(h.listenerNonce)
+	return d.Sum(nil)
+}
+
+// sign proves to the other end that we, acting as role, hold our node key.
+func (h *handshake) sign(key *crypto.PrivateKey, role string) []byte {
+	return key.Sign(h.digest(role)).Bytes()
+}
+
+// verify checks that the node at the end acting as role signed h.
+func (h *handshake) verify(role string, sig []byte) error {
+	nodeID := h.dialerID
+	if role == roleListener {
+		nodeID = h.listenerID
+	}
+	if len(nodeID) != crypto.PubKeyLen || len(sig) != crypto.SignatureLen {
+		return errBadIdentity
+	}
+	pubKey := crypto.PublicKeyFromBytes(nodeID)
+	if !crypto.SignatureFromBytes(sig).Verify(pubKey, h.digest(role)) {
+		return errBadIdentity
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package node
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/LDM-A/GoBlocker/crypto"
+	"github.com/LDM-A/GoBlocker/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLoadNodeKey(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "node.key")
+	key, err := LoadKeyFile(file)
+	require.Nil(t, err)
+	again, err := LoadKeyFile(file)
+	require.Nil(t, err)
+	assert.Equal(t, key.Public().Bytes(), again.Public().Bytes())
+
+	require.Nil(t, os.WriteFile(file, []byte("not a key"), 0600))
+	_, err = LoadKeyFile(file)
+	assert.NotNil(t, err)
+}
+
+func TestHandshakeSignature(t *testing.T) {
+	var (
+		dialer   = crypto.GeneratePrivateKey()
+		listener = crypto.GeneratePrivateKey()
+		hs       = &handshake{
+			dialerID:      dialer.Public().Bytes(),
+			dialerNonce:   newNonce(),
+			listenerID:    listener.Public().Bytes(),
+			listenerNonce: newNonce(),
+		}
+		sig = hs.sign(listener, roleListener)
+	)
+	assert.Nil(t, hs.verify(roleListener, sig))
+	assert.Nil(t, hs.verify(roleDialer, hs.sign(dialer, roleDialer)))
+	assert.ErrorIs(t, hs.verify(roleListener, nil), errBadIdentity)
+	// signed for the other role
+	assert.ErrorIs(t, hs.verify(roleDialer, hs.sign(dialer, roleListener)), errBadIdentity)
+
+	for _, other := range []*handshake{
+		{dialerID: hs.dialerID, dialerNonce: newNonce(), listenerID: hs.listenerID, listenerNonce: hs.listenerNonce},
+		{dialerID: hs.dialerID, dialerNonce: hs.dialerNonce, listenerID: hs.listenerID, listenerNonce: newNonce()},
+		{dialerID: crypto.GeneratePrivateKey().Public().Bytes(), dialerNonce: hs.dialerNonce, listenerID: hs.listenerID, listenerNonce: hs.listenerNonce},
+		{dialerID: hs.dialerID, dialerNonce: hs.dialerNonce, listenerID: nil, listenerNonce: hs.listenerNonce},
+	} {
+		assert.ErrorIs(t, other.verify(roleListener, sig), errBadIdentity)
+	}
+}
+
+func TestHandshakeRejectsForgedIdentity(t *testing.T) {
+	addr := freeAddr(t)
+	n := startTestNode(t, addr)
+	defer n.Stop()
+
+	stream := openStream(t, addr)
+	// claim somebody else's node id
+	victim := crypto.GeneratePrivateKey()
+	v := testVersion("forger")
+	v.NodeId = victim.Public().Bytes()
+	v.Nonce = newNonce()
+	require.Nil(t, stream.Send(versionMsg(v)))
+	msg, err := stream.Recv()
+	require.Nil(t, err)
+	hs := &handshake{
+		dialerID:      v.NodeId,
+		dialerNonce:   v.Nonce,
+		listenerID:    n.nodeKey.Public().Bytes(),
+		listenerNonce: msg.GetVersion().Nonce,
+	}
+	require.Nil(t, hs.verify(roleListener, msg.GetVersion().Signature))
+
+	forged := hs.sign(crypto.GeneratePrivateKey(), roleDialer)
+	require.Nil(t, stream.Send(&proto.PeerMessage{Payload: &proto.PeerMessage_VersionAck{VersionAck: &proto.VersionAck{Signature: forged}}}))
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.False(t, connectedTo(n, "forger")())
+}
+
+func TestHandshakeRejectsRelayedSignature(t *testing.T) {
+	var (
+		addr   = freeAddr(t)
+		victim = startTestNode(t, addr)
+		dialer = crypto.GeneratePrivateKey()
+		relay  = crypto.GeneratePrivateKey()
+		nonce  = newNonce()
+	)
+	defer victim.Stop()
+
+	// the relay is dialed with nonce, passes it on to the victim as its own
+	// and hands the victim's answer back to claim the victim's node id
+	stream := openStream(t, addr)
+	v := testVersion("relay")
+	v.NodeId = relay.Public().Bytes()
+	v.Nonce = nonce
+	require.Nil(t, stream.Send(versionMsg(v)))
+	msg, err := stream.Recv()
+	require.Nil(t, err)
+	answer := msg.GetVersion()
+	require.Nil(t, stream.CloseSend())
+
+	hs := &handshake{
+		dialerID:      dialer.Public().Bytes(),
+		dialerNonce:   nonce,
+		listenerID:    answer.NodeId,
+		listenerNonce: answer.Nonce,
+	}
+	assert.ErrorIs(t, hs.verify(roleListener, answer.Signature), errBadIdentity)
+}
+
+func TestPeersDedupedByNodeID(t *testing.T) {
+	var (
+		addrA = freeAddr(t)
+		addrB = freeAddr(t)
+		a     = startTestNode(t, addrA)
+		b     = startTestNode(t, addrB, addrA)
+	)
+	defer a.Stop()
+	defer b.Stop()
+	require.Eventually(t, connectedTo(b, addrA), time.Second*5, 10*time.Millisecond)
+
+	// the same node under another address
+	_, port, _ := net.SplitHostPort(addrA)
+	require.Nil(t, b.connect(net.JoinHostPort("localhost", port)))
+	assert.Len(t, b.getPeers(), 1)
+
+	// dialing ourselves fails the handshake
+	assert.NotNil(t, b.connect(addrB))
+	assert.Len(t, b.getPeers(), 1)
+}
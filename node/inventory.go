@@ -0,0 +1,338 @@
+package node
+
+import (
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/LDM-A/GoBlocker/proto"
+	"github.com/LDM-A/GoBlocker/types"
+)
+
+const (
+	// maxKnownInventory bounds the number of hashes remembered per peer.
+	maxKnownInventory = 5000
+	// maxInvItems bounds the items of a single Announce or GetData message.
+	maxInvItems = 1000
+	// maxPeerRequests bounds the items being fetched from a single peer.
+	maxPeerRequests = 1000
+	// maxAnnouncers bounds the other announcers of an item remembered to
+	// retry its request with.
+	maxAnnouncers  = 8
+	requestTimeout = time.Second * 30
+)
+
+var (
+	errOversizedInv   = errors.New("too many inventory items")
+	errRequestTimeout = errors.New("requested inventory not delivered")
+)
+
+// inventoryRequest is an item being fetched from a peer.
+type inventoryRequest struct {
+	item *proto.InvItem
+	peer *remotePeer
+	at   time.Time
+	// announcers are other peers that announced the item. They are asked in
+	// turn when peer does not deliver it in time.
+	announcers []*remotePeer
+}
+
+// knownInventory is the set of transactions and blocks a peer is known to
+// have, either because it announced them or because we sent them. When full
+// the oldest hashes are forgotten first.
+type knownInventory struct {
+	lock   sync.Mutex
+	hashes map[string]bool
+	ring   []string
+	next   int
+}
+
+func newKnownInventory() *knownInventory {
+	return &knownInventory{
+		hashes: make(map[string]bool),
+		ring:   make([]string, 0, maxKnownInventory),
+	}
+}
+
+// add marks hash as known and reports whether it was new.
+func (k *knownInventory) add(hash string) bool {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	if k.hashes[hash] {
+		return false
+	}
+	if len(k.ring) < maxKnownInventory {
+		k.ring = append(k.ring, hash)
+	} else {
+		delete(k.hashes, k.ring[k.next])
+		k.ring[k.next] = hash
+		k.next = (k.next + 1) % maxKnownInventory
+	}
+	k.hashes[hash] = true
+	return true
+}
+
+func (k *knownInventory) has(hash string) bool {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	return k.hashes[hash]
+}
+
+func txInv(tx *proto.Transaction) *proto.InvItem {
+	return &proto.InvItem{Type: proto.InvType_INV_TX, Hash: types.HashTransaction(tx)}
+}
+
+func blockInv(b *proto.Block) *proto.InvItem {
+	return &proto.InvItem{Type: proto.InvType_INV_BLOCK, Hash: types.HashBlock(b)}
+}
+
+// handleAnnounce requests the announced items we do not have yet.
+func (n *Node) handleAnnounce(p *remotePeer, inv *proto.Inventory) {
+	if len(inv.Items) > maxInvItems {
+		n.misbehaving(p.banKey(), misbehaviorOversizedInv, errOversizedInv)
+		return
+	}
+	missing := []*proto.InvItem{}
+	for _, item := range inv.Items {
+		p.known.add(hex.EncodeToString(item.Hash))
+		if !n.haveInventory(item) && n.startRequest(p, item) {
+			missing = append(missing, item)
+		}
+	}
+	if len(missing) > 0 {
+		p.send(&proto.PeerMessage{Payload: &proto.PeerMessage_GetData{GetData: &proto.Inventory{Items: missing}}})
+	}
+}
+
+// handleGetData sends p the requested items we have.
+func (n *Node) handleGetData(p *remotePeer, inv *proto.Inventory) {
+	if len(inv.Items) > maxInvItems {
+		n.misbehaving(p.banKey(), misbehaviorOversizedInv, errOversizedInv)
+		return
+	}
+	p.send(&proto.PeerMessage{Payload: &proto.PeerMessage_InventoryData{InventoryData: n.getData(inv)}})
+}
+
+// getData collects the requested items we have.
+func (n *Node) getData(inv *proto.Inventory) *proto.InventoryData {
+	data := &proto.InventoryData{}
+	for _, item := range inv.Items {
+		hash := hex.EncodeToString(item.Hash)
+		switch item.Type {
+		case proto.InvType_INV_TX:
+			if tx, ok := n.mempool.Get(hash); ok {
+				data.Transactions = append(data.Transactions, tx)
+			} else if tx, err := n.chain.txStore.Get(hash); err == nil {
+				data.Transactions = append(data.Transactions, tx)
+			}
+		case proto.InvType_INV_BLOCK:
+			if b, err := n.chain.GetBlockByHash(item.Hash); err == nil {
+				data.Blocks = append(data.Blocks, b)
+			}
+		}
+	}
+	return data
+}
+
+// handleData processes the transactions and blocks a peer sent in answer to
+// our requests. Items we did not request from p are ignored.
+func (n *Node) handleData(p *remotePeer, data *proto.InventoryData) {
+	for _, b := range data.Blocks {
+		hash := hex.EncodeToString(types.HashBlock(b))
+		p.known.add(hash)
+		if !n.finishRequest(p, hash) {
+			n.logger.Debugw("ignored unrequested block", "from", p.addr(), "hash", hash)
+			continue
+		}
+		fresh := !n.haveInventory(blockInv(b))
+		err := n.acceptBlock(b)
+		if errors.Is(err, ErrOrphanBlock) {
+			n.orphanBlocks.Add(b)
+			n.requestParent(p, b)
+			continue
+		}
+		if err != nil {
+			n.logger.Debugw("rejected block", "from", p.addr(), "hash", hash, "err", err)
+			n.misbehaving(p.banKey(), blockMisbehavior(err), err)
+		} else if fresh {
+			n.markUseful(p)
+		}
+	}
+	for _, tx := range data.Transactions {
+		hash := hex.EncodeToString(types.HashTransaction(tx))
+		p.known.add(hash)
+		if !n.finishRequest(p, hash) {
+			n.logger.Debugw("ignored unrequested tx", "from", p.addr(), "hash", hash)
+			continue
+		}
+		fresh := !n.haveInventory(txInv(tx))
+		err := n.acceptTransaction(tx, p.banKey())
+		if err != nil {
+			n.misbehaving(p.banKey(), txMisbehavior(err), err)
+		} else if fresh {
+			n.markUseful(p)
+		}
+	}
+}
+
+// requestParent asks p, which sent us the orphan block b, for its parent.
+func (n *Node) requestParent(p *remotePeer, b *proto.Block) {
+	item := &proto.InvItem{Type: proto.InvType_INV_BLOCK, Hash: b.Header.PreviousHash}
+	if n.haveInventory(item) || !n.startRequest(p, item) {
+		return
+	}
+	n.logger.Debugw("requesting parent of orphan block", "we", n.ListenAddr, "peer", p.addr(), "parent", hex.EncodeToString(item.Hash))
+	p.send(&proto.PeerMessage{Payload: &proto.PeerMessage_GetData{GetData: &proto.Inventory{Items: []*proto.InvItem{item}}}})
+}
+
+// markUseful records that p just sent us something new, which protects it
+// from eviction.
+func (n *Node) markUseful(p *remotePeer) {
+	n.peerLock.Lock()
+	defer n.peerLock.Unlock()
+	p.lastUseful = time.Now()
+}
+
+// relay announces item to every peer not known to have it.
+func (n *Node) relay(item *proto.InvItem) {
+	hash := hex.EncodeToString(item.Hash)
+	for _, p := range n.getPeers() {
+		if !p.supports(FeatureInventory) || !p.known.add(hash) {
+			continue
+		}
+		inv := &proto.Inventory{Items: []*proto.InvItem{item}}
+		if !p.send(&proto.PeerMessage{Payload: &proto.PeerMessage_Announce{Announce: inv}}) {
+			n.logger.Debugw("send queue full, dropping message", "we", n.ListenAddr, "peer", p.addr())
+		}
+	}
+}
+
+func (n *Node) haveInventory(item *proto.InvItem) bool {
+	hash := hex.EncodeToString(item.Hash)
+	switch item.Type {
+	case proto.InvType_INV_TX:
+		if _, ok := n.mempool.Get(hash); ok || n.orphans.Has(hash) {
+			return true
+		}
+		_, err := n.chain.GetTransactionLocation(hash)
+		return err == nil
+	case proto.InvType_INV_BLOCK:
+		return n.chain.HasBlock(hash) || n.orphanBlocks.Has(hash)
+	}
+	return true
+}
+
+// startRequest reports whether item, announced by p, should be requested
+// from p now. Every item is only fetched from one peer at a time, the other
+// announcers are remembered to retry with when that peer does not deliver.
+func (n *Node) startRequest(p *remotePeer, item *proto.InvItem) bool {
+	hash := hex.EncodeToString(item.Hash)
+	n.requestLock.Lock()
+	defer n.requestLock.Unlock()
+
+	if r, ok := n.requested[hash]; ok {
+		if r.peer != p && len(r.announcers) < maxAnnouncers && !containsPeer(r.announcers, p) {
+			r.announcers = append(r.announcers, p)
+		}
+		return false
+	}
+	if len(p.requested) >= maxPeerRequests {
+		return false
+	}
+	n.requested[hash] = &inventoryRequest{item: item, peer: p, at: time.Now()}
+	p.requested[hash] = true
+	return true
+}
+
+// finishRequest reports whether hash was requested from p and forgets the
+// request if so.
+func (n *Node) finishRequest(p *remotePeer, hash string) bool {
+	n.requestLock.Lock()
+	defer n.requestLock.Unlock()
+	r, ok := n.requested[hash]
+	if !ok || r.peer != p {
+		return false
+	}
+	delete(n.requested, hash)
+	delete(p.requested, hash)
+	return true
+}
+
+// expireRequests penalizes the peers that left requests unanswered for
+// requestTimeout and asks the next announcer of those items instead.
+func (n *Node) expireRequests(now time.Time) {
+	var (
+		timedOut = map[*remotePeer]bool{}
+		retries  = map[*remotePeer][]*proto.InvItem{}
+	)
+	n.requestLock.Lock()
+	for hash, r := range n.requested {
+		if now.Sub(r.at) < requestTimeout {
+			continue
+		}
+		timedOut[r.peer] = true
+		delete(r.peer.requested, hash)
+		if next := n.reassignRequest(hash, r, now); next != nil {
+			retries[next] = append(retries[next], r.item)
+		}
+	}
+	n.requestLock.Unlock()
+
+	for p := range timedOut {
+		n.logger.Debugw("peer left requests unanswered", "we", n.ListenAddr, "peer", p.addr())
+		n.misbehaving(p.banKey(), misbehaviorUnansweredRequest, errRequestTimeout)
+	}
+	n.sendRequests(retries)
+}
+
+// dropRequests hands the requests still pending with p, which disconnected,
+// to the next announcers of those items.
+func (n *Node) dropRequests(p *remotePeer) {
+	retries := map[*remotePeer][]*proto.InvItem{}
+	n.requestLock.Lock()
+	for hash := range p.requested {
+		r := n.requested[hash]
+		delete(p.requested, hash)
+		if next := n.reassignRequest(hash, r, time.Now()); next != nil {
+			retries[next] = append(retries[next], r.item)
+		}
+	}
+	n.requestLock.Unlock()
+	n.sendRequests(retries)
+}
+
+// reassignRequest moves the request for hash to its next connected announcer
+// with room for it and returns that peer. The request is forgotten when
+// there is none. The caller must hold requestLock.
+func (n *Node) reassignRequest(hash string, r *inventoryRequest, now time.Time) *remotePeer {
+	for len(r.announcers) > 0 {
+		next := r.announcers[0]
+		r.announcers = r.announcers[1:]
+		if next.closed() || len(next.requested) >= maxPeerRequests {
+			continue
+		}
+		r.peer = next
+		r.at = now
+		next.requested[hash] = true
+		return next
+	}
+	delete(n.requested, hash)
+	return nil
+}
+
+func (n *Node) sendRequests(requests map[*remotePeer][]*proto.InvItem) {
+	for p, items := range requests {
+		p.send(&proto.PeerMessage{Payload: &proto.PeerMessage_GetData{GetData: &proto.Inventory{Items: items}}})
+	}
+}
+
+func containsPeer(peers []*remotePeer, p *remotePeer) bool {
+	for _, other := range peers {
+		if other == p {
+			return true
+		}
+	}
+	return false
+}
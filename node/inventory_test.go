@@ -0,0 +1,200 @@
+package node
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/LDM-A/GoBlocker/crypto"
+	"github.com/LDM-A/GoBlocker/proto"
+	"github.com/LDM-A/GoBlocker/types"
+	"github.com/LDM-A/GoBlocker/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKnownInventory(t *testing.T) {
+	k := newKnownInventory()
+	assert.True(t, k.add("a"))
+	assert.False(t, k.add("a"))
+	assert.True(t, k.has("a"))
+
+	for i := 0; i < maxKnownInventory; i++ {
+		k.add(fmt.Sprint(i))
+	}
+	assert.False(t, k.has("a"))
+	assert.True(t, k.has("0"))
+	assert.Equal(t, maxKnownInventory, len(k.hashes))
+}
+
+func TestInventoryGossip(t *testing.T) {
+	var (
+		addrA = freeAddr(t)
+		addrB = freeAddr(t)
+		a     = startTestNode(t, addrA)
+		b     = startTestNode(t, addrB, addrA)
+	)
+	defer a.Stop()
+	defer b.Stop()
+	require.Eventually(t, connectedTo(b, addrA), time.Second*5, 10*time.Millisecond)
+	require.Eventually(t, connectedTo(a, addrB), time.Second*5, 10*time.Millisecond)
+
+	tx := makeGenesisSpend(t, a.chain, 400)
+	hash := hex.EncodeToString(types.HashTransaction(tx))
+	_, err := a.HandleTransaction(testContext(), tx)
+	require.Nil(t, err)
+	require.Eventually(t, func() bool { return b.mempool.Has(tx) }, time.Second*5, 10*time.Millisecond)
+
+	// both sides know the other has the transaction, so it is not echoed back
+	assert.True(t, peerByAddr(a, addrB).known.has(hash))
+	assert.True(t, peerByAddr(b, addrA).known.has(hash))
+
+	block := blockOn(genesisBlock(t, a.chain), tx)
+	require.Nil(t, a.acceptBlock(block))
+	require.Eventually(t, func() bool { return b.chain.Height() == 1 }, time.Second*5, 10*time.Millisecond)
+	assert.False(t, b.mempool.Has(tx))
+	tip, err := b.chain.GetBlockByHeight(1)
+	require.Nil(t, err)
+	assert.Equal(t, types.HashBlock(block), types.HashBlock(tip))
+}
+
+// requestRecorder returns a send function of a fake peer collecting the
+// items it is asked for.
+func requestRecorder() (func(*proto.PeerMessage) error, chan []*proto.InvItem) {
+	requests := make(chan []*proto.InvItem, 10)
+	return func(msg *proto.PeerMessage) error {
+		if inv := msg.GetGetData(); inv != nil {
+			requests <- inv.Items
+		}
+		return nil
+	}, requests
+}
+
+func TestHandleDataIgnoresUnrequestedItems(t *testing.T) {
+	var (
+		n              = newTestNode(t, ServerConfig{Version: "Blocker-1"})
+		send, requests = requestRecorder()
+		p              = addFakePeer(t, n, "peer", send)
+		block          = blockOn(genesisBlock(t, n.chain))
+		announce       = &proto.Inventory{Items: []*proto.InvItem{blockInv(block)}}
+	)
+	n.handleData(p, &proto.InventoryData{Blocks: []*proto.Block{block}})
+	assert.Equal(t, 0, n.chain.Height())
+	assert.True(t, p.lastUseful.IsZero())
+
+	n.handleAnnounce(p, announce)
+	select {
+	case items := <-requests:
+		assert.Equal(t, announce.Items, items)
+	case <-time.After(time.Second):
+		t.Fatal("announced block was not requested")
+	}
+	n.handleData(p, &proto.InventoryData{Blocks: []*proto.Block{block}})
+	assert.Equal(t, 1, n.chain.Height())
+	assert.Empty(t, n.requested)
+	assert.Empty(t, p.requested)
+}
+
+func TestOrphanBlockRequestsParent(t *testing.T) {
+	var (
+		n              = newTestNode(t, ServerConfig{Version: "Blocker-1"})
+		send, requests = requestRecorder()
+		p              = addFakePeer(t, n, "peer", send)
+		b1             = blockOn(genesisBlock(t, n.chain))
+		b2             = blockOn(b1)
+		b3             = blockOn(b2)
+	)
+	// we missed b1 and b2 and only hear about b3
+	require.True(t, n.startRequest(p, blockInv(b3)))
+	n.handleData(p, &proto.InventoryData{Blocks: []*proto.Block{b3}})
+	for _, b := range []*proto.Block{b2, b1} {
+		select {
+		case items := <-requests:
+			assert.Equal(t, []*proto.InvItem{blockInv(b)}, items)
+		case <-time.After(time.Second):
+			t.Fatal("parent of orphan block was not requested")
+		}
+		n.handleData(p, &proto.InventoryData{Blocks: []*proto.Block{b}})
+	}
+	assert.Equal(t, 3, n.chain.Height())
+	assert.Equal(t, 0, n.orphanBlocks.Len())
+	assert.Empty(t, n.requested)
+}
+
+func TestOrphansCountAgainstPeerHost(t *testing.T) {
+	var (
+		n       = newTestNode(t, ServerConfig{Version: "Blocker-1"})
+		send, _ = requestRecorder()
+		stream  = &fakeStream{send: send, closed: make(chan struct{})}
+		p       = newRemotePeer(stream, testVersion("claimed:3000"), false, "10.0.0.7")
+		privKey = crypto.GeneratePrivateKey()
+		orphan  = &proto.Transaction{
+			Version: 1,
+			Inputs:  []*proto.TxInput{{PrevTxHash: util.RandomHash(), PublicKey: privKey.Public().Bytes()}},
+			Outputs: []*proto.TxOutput{{Amount: 1, Address: privKey.Public().Address().Bytes()}},
+		}
+	)
+	t.Cleanup(func() { close(stream.closed) })
+	require.Nil(t, n.addPeer(p))
+	orphan.Inputs[0].Signature = types.SignTransaction(privKey, orphan).Bytes()
+
+	require.True(t, n.startRequest(p, txInv(orphan)))
+	n.handleData(p, &proto.InventoryData{Transactions: []*proto.Transaction{orphan}})
+	assert.Equal(t, 1, n.orphans.perPeer["10.0.0.7"])
+	assert.Equal(t, 0, n.orphans.perPeer["claimed:3000"])
+}
+
+func TestRequestTimeoutAsksNextAnnouncer(t *testing.T) {
+	var (
+		n              = newTestNode(t, ServerConfig{Version: "Blocker-1"})
+		fakeSend, _    = requestRecorder()
+		send, requests = requestRecorder()
+		fake           = addFakePeer(t, n, "fake", fakeSend)
+		honest         = addFakePeer(t, n, "honest", send)
+		tx             = makeGenesisSpend(t, n.chain, 400)
+		announce       = &proto.Inventory{Items: []*proto.InvItem{txInv(tx)}}
+	)
+	n.handleAnnounce(fake, announce)
+	n.handleAnnounce(honest, announce)
+	assert.Len(t, fake.requested, 1)
+	assert.Empty(t, honest.requested)
+
+	n.expireRequests(time.Now().Add(requestTimeout))
+	assert.Empty(t, fake.requested)
+	assert.Equal(t, misbehaviorUnansweredRequest, n.bans.scores[fake.banKey()])
+	select {
+	case items := <-requests:
+		assert.Equal(t, announce.Items, items)
+	case <-time.After(time.Second):
+		t.Fatal("item was not requested from the other announcer")
+	}
+
+	// the late answer of the first announcer is ignored
+	n.handleData(fake, &proto.InventoryData{Transactions: []*proto.Transaction{tx}})
+	assert.False(t, n.mempool.Has(tx))
+	n.handleData(honest, &proto.InventoryData{Transactions: []*proto.Transaction{tx}})
+	assert.True(t, n.mempool.Has(tx))
+}
+
+func TestAnnounceLimits(t *testing.T) {
+	var (
+		n              = newTestNode(t, ServerConfig{Version: "Blocker-1"})
+		send, requests = requestRecorder()
+		p              = addFakePeer(t, n, "peer", send)
+		inv            = &proto.Inventory{}
+	)
+	for i := 0; i < maxInvItems+1; i++ {
+		inv.Items = append(inv.Items, txInv(randomPoolTx()))
+	}
+	n.handleAnnounce(p, inv)
+	assert.Empty(t, p.requested)
+	assert.Equal(t, misbehaviorOversizedInv, n.bans.scores[p.banKey()])
+
+	// requests to a single peer are bounded
+	n.handleAnnounce(p, &proto.Inventory{Items: inv.Items[:maxPeerRequests]})
+	assert.Len(t, <-requests, maxPeerRequests)
+	n.handleAnnounce(p, &proto.Inventory{Items: inv.Items[maxPeerRequests:]})
+	assert.Len(t, p.requested, maxPeerRequests)
+	assert.Empty(t, requests)
+}
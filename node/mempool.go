@@ -0,0 +1,847 @@
+package node
+
+import (
+	"container/heap"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/LDM-A/GoBlocker/proto"
+	"github.com/LDM-A/GoBlocker/types"
+	"github.com/LDM-A/GoBlocker/util"
+
+	pb "github.com/golang/protobuf/proto"
+)
+
+const (
+	// maxReplacements caps how many pending transactions, descendants
+	// included, a single replacement may evict.
+	maxReplacements = 100
+	// maxAncestors caps the number of unconfirmed ancestors a pending
+	// transaction may have.
+	maxAncestors = 25
+)
+
+var (
+	ErrMempoolConflict  = errors.New("conflicts with pending transaction")
+	ErrMempoolFull      = errors.New("mempool full")
+	ErrFeeTooLow        = errors.New("fee too low")
+	ErrTooManyAncestors = errors.New("too many unconfirmed ancestors")
+)
+
+type MempoolConfig struct {
+	// MaxTxs and MaxBytes cap the number and the total serialized size of
+	// pending transactions.
+	MaxTxs   int
+	MaxBytes int
+	// MaxAge is how long a transaction may stay pending before it expires.
+	MaxAge time.Duration
+	// MinRelayFeeRate is the fee per byte required while the pool is empty.
+	// It rises as the pool fills up, see Mempool.MinFeeRate.
+	MinRelayFeeRate float64
+}
+
+func DefaultMempoolConfig() MempoolConfig {
+	return MempoolConfig{
+		MaxTxs:          50_000,
+		MaxBytes:        64 << 20,
+		MaxAge:          time.Hour * 24,
+		MinRelayFeeRate: 1,
+	}
+}
+
+// withDefaults returns c with every unset field set to its default.
+func (c MempoolConfig) withDefaults() MempoolConfig {
+	defaults := DefaultMempoolConfig()
+	if c.MaxTxs == 0 {
+		c.MaxTxs = defaults.MaxTxs
+	}
+	if c.MaxBytes == 0 {
+		c.MaxBytes = defaults.MaxBytes
+	}
+	if c.MaxAge == 0 {
+		c.MaxAge = defaults.MaxAge
+	}
+	if c.MinRelayFeeRate == 0 {
+		c.MinRelayFeeRate = defaults.MinRelayFeeRate
+	}
+	return c
+}
+
+type mempoolEntry struct {
+	tx    *proto.Transaction
+	hash  string
+	fee   int64
+	size  int
+	added time.Time
+}
+
+func (e *mempoolEntry) feeRate() float64 {
+	return float64(e.fee) / float64(e.size)
+}
+
+type Mempool struct {
+	lock   sync.RWMutex
+	config MempoolConfig
+	txx    map[string]*mempoolEntry
+	// spends maps every outpoint spent by a pending transaction to the hash
+	// of that transaction.
+	spends map[string]string
+	bytes  int
+	// onDrop is called for transactions leaving the pool unconfirmed.
+	onDrop func(hash string)
+}
+
+func NewMemPool() *Mempool {
+	return NewMemPoolWithConfig(DefaultMempoolConfig())
+}
+
+func NewMemPoolWithConfig(cfg MempoolConfig) *Mempool {
+	return &Mempool{
+		config: cfg,
+		txx:    make(map[string]*mempoolEntry),
+		spends: make(map[string]string),
+	}
+}
+
+// SetDropHandler registers fn to be called with the hash of every
+// transaction that leaves the pool without being confirmed: replaced,
+// evicted, expired, conflicting with a block or failing revalidation. It is
+// called with the pool lock held.
+func (pool *Mempool) SetDropHandler(fn func(hash string)) {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	pool.onDrop = fn
+}
+
+func (pool *Mempool) Clear() []*proto.Transaction {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	txx := make([]*proto.Transaction, len(pool.txx))
+	it := 0
+	for k, v := range pool.txx {
+		delete(pool.txx, k)
+		txx[it] = v.tx
+		it++
+	}
+	pool.spends = make(map[string]string)
+	pool.bytes = 0
+
+	return txx
+}
+
+func (pool *Mempool) Len() int {
+	pool.lock.RLock()
+	defer pool.lock.RUnlock()
+	return len(pool.txx)
+}
+
+// Get returns the pending transaction with the given hex encoded hash.
+func (pool *Mempool) Get(hash string) (*proto.Transaction, bool) {
+	pool.lock.RLock()
+	defer pool.lock.RUnlock()
+	e, ok := pool.txx[hash]
+	if !ok {
+		return nil, false
+	}
+	return e.tx, true
+}
+
+// Hashes returns the hex encoded hashes of all pending transactions, highest
+// fee rate first.
+func (pool *Mempool) Hashes() []string {
+	pool.lock.RLock()
+	defer pool.lock.RUnlock()
+	entries := pool.entriesByFeeRate()
+	hashes := make([]string, len(entries))
+	for i, e := range entries {
+		hashes[i] = e.hash
+	}
+	return hashes
+}
+
+// feeHistogramBounds are the lower fee rate bounds of the buckets reported
+// by Mempool.Stats.
+var feeHistogramBounds = []float64{0, 1, 2, 5, 10, 20, 50, 100, 200, 500, 1000}
+
+type FeeRateBucket struct {
+	MinFeeRate float64
+	Count      int
+	Bytes      int
+}
+
+type MempoolStats struct {
+	Count      int
+	Bytes      int
+	MinFeeRate float64
+	// FeeHistogram holds one bucket per entry of feeHistogramBounds, lowest
+	// fee rate first.
+	FeeHistogram []FeeRateBucket
+}
+
+func (pool *Mempool) Stats() MempoolStats {
+	pool.lock.RLock()
+	defer pool.lock.RUnlock()
+
+	stats := MempoolStats{
+		Count:        len(pool.txx),
+		Bytes:        pool.bytes,
+		MinFeeRate:   pool.minFeeRate(),
+		FeeHistogram: make([]FeeRateBucket, len(feeHistogramBounds)),
+	}
+	for i, bound := range feeHistogramBounds {
+		stats.FeeHistogram[i].MinFeeRate = bound
+	}
+	for _, e := range pool.txx {
+		rate := e.feeRate()
+		i := sort.Search(len(feeHistogramBounds), func(i int) bool {
+			return feeHistogramBounds[i] > rate
+		}) - 1
+		stats.FeeHistogram[i].Count++
+		stats.FeeHistogram[i].Bytes += e.size
+	}
+	return stats
+}
+
+func (pool *Mempool) Has(tx *proto.Transaction) bool {
+	pool.lock.RLock()
+	defer pool.lock.RUnlock()
+	hash := hex.EncodeToString(types.HashTransaction(tx))
+	_, ok := pool.txx[hash]
+	return ok
+}
+
+// MinFeeRate is the fee per byte a new transaction has to pay to get in. It
+// starts at the configured minimum relay fee and grows quadratically with
+// how full the pool is, up to ten times the minimum.
+func (pool *Mempool) MinFeeRate() float64 {
+	pool.lock.RLock()
+	defer pool.lock.RUnlock()
+	return pool.minFeeRate()
+}
+
+func (pool *Mempool) minFeeRate() float64 {
+	fill := 0.0
+	if pool.config.MaxTxs > 0 {
+		fill = float64(len(pool.txx)) / float64(pool.config.MaxTxs)
+	}
+	if pool.config.MaxBytes > 0 {
+		if byteFill := float64(pool.bytes) / float64(pool.config.MaxBytes); byteFill > fill {
+			fill = byteFill
+		}
+	}
+	if fill > 1 {
+		fill = 1
+	}
+	return pool.config.MinRelayFeeRate * (1 + 9*fill*fill)
+}
+
+// Add adds tx paying fee to the pool. It returns false when tx is already
+// pending. When the pool is full the transactions with the lowest fee rate
+// are evicted to make room, unless tx itself pays the lowest fee rate.
+//
+// A transaction spending the same outputs as pending transactions replaces
+// them, and their descendants, if it follows the replace-by-fee rules, see
+// checkReplacement.
+func (pool *Mempool) Add(tx *proto.Transaction, fee int64) (bool, error) {
+	return pool.add(tx, fee, time.Now())
+}
+
+func (pool *Mempool) add(tx *proto.Transaction, fee int64, added time.Time) (bool, error) {
+	return pool.admit(newMempoolEntry(tx, fee, added), true)
+}
+
+// Check runs the policy checks of Add for tx paying fee without changing the
+// pool. A transaction that is already pending passes.
+func (pool *Mempool) Check(tx *proto.Transaction, fee int64) error {
+	_, err := pool.admit(newMempoolEntry(tx, fee, time.Now()), false)
+	return err
+}
+
+func newMempoolEntry(tx *proto.Transaction, fee int64, added time.Time) *mempoolEntry {
+	return &mempoolEntry{
+		tx:    tx,
+		hash:  hex.EncodeToString(types.HashTransaction(tx)),
+		fee:   fee,
+		size:  pb.Size(tx),
+		added: added,
+	}
+}
+
+// AddTransaction validates tx against chain and adds it like Add, with the
+// fee it pays, which it returns. tx may spend outputs of pending
+// transactions. They are looked up under the same lock that adds tx, so they
+// cannot be removed in between.
+func (pool *Mempool) AddTransaction(tx *proto.Transaction, chain *Chain) (bool, int64, error) {
+	return pool.addTransaction(tx, chain, time.Now(), true)
+}
+
+// TestTransaction runs the checks of AddTransaction without changing the
+// pool and returns the fee tx pays.
+func (pool *Mempool) TestTransaction(tx *proto.Transaction, chain *Chain) (int64, error) {
+	_, fee, err := pool.addTransaction(tx, chain, time.Now(), false)
+	return fee, err
+}
+
+func (pool *Mempool) addTransaction(tx *proto.Transaction, chain *Chain, added time.Time, commit bool) (bool, int64, error) {
+	// signatures are checked first, without blocking the pool
+	if !chain.VerifyTransaction(tx) {
+		return false, 0, ErrInvalidSignature
+	}
+
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	fee, err := chain.checkPendingInputs(tx, pool)
+	if err != nil {
+		return false, 0, err
+	}
+	ok, err := pool.admitLocked(newMempoolEntry(tx, fee, added), commit)
+	return ok, fee, err
+}
+
+// admit checks entry against the pool policy and, when commit is set, adds
+// it, replacing and evicting pending transactions as needed.
+func (pool *Mempool) admit(entry *mempoolEntry, commit bool) (bool, error) {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	return pool.admitLocked(entry, commit)
+}
+
+// admitLocked is admit for callers holding the lock.
+func (pool *Mempool) admitLocked(entry *mempoolEntry, commit bool) (bool, error) {
+	if _, ok := pool.txx[entry.hash]; ok {
+		return false, nil
+	}
+	// every input takes some bytes, so the fee rate below is well defined
+	if len(entry.tx.Inputs) == 0 {
+		return false, ErrNoInputs
+	}
+	if minRate := pool.minFeeRate(); entry.feeRate() < minRate {
+		return false, fmt.Errorf("%w: fee rate %.4f below minimum %.4f", ErrFeeTooLow, entry.feeRate(), minRate)
+	}
+	if pool.config.MaxBytes > 0 && entry.size > pool.config.MaxBytes {
+		return false, fmt.Errorf("%w: transaction of %d bytes exceeds pool size", ErrMempoolFull, entry.size)
+	}
+
+	if ancestors := pool.ancestors(entry); len(ancestors) > maxAncestors {
+		return false, fmt.Errorf("%w: %d", ErrTooManyAncestors, len(ancestors))
+	}
+
+	replaced, err := pool.checkReplacement(entry)
+	if err != nil {
+		return false, err
+	}
+	for _, e := range replaced {
+		pool.remove(e.hash)
+	}
+
+	evict, ok := pool.evictionCandidates(entry)
+	if !ok {
+		for _, r := range replaced {
+			pool.insert(r)
+		}
+		return false, fmt.Errorf("%w: fee rate %.4f too low to evict pending transactions", ErrMempoolFull, entry.feeRate())
+	}
+	if !commit {
+		for _, r := range replaced {
+			pool.insert(r)
+		}
+		return false, nil
+	}
+	for _, e := range replaced {
+		pool.dropped(e.hash)
+	}
+	for _, e := range evict {
+		pool.remove(e.hash)
+		pool.dropped(e.hash)
+	}
+
+	pool.insert(entry)
+
+	return true, nil
+}
+
+// checkReplacement returns the pending transactions entry would replace,
+// following rules similar to BIP125:
+//   - it pays a strictly higher fee rate than every transaction it directly
+//     conflicts with
+//   - its absolute fee covers the fees of all replaced transactions, their
+//     descendants included, plus the minimum relay fee for its own size
+//   - it replaces at most maxReplacements transactions
+//   - it does not spend outputs of the transactions it replaces
+func (pool *Mempool) checkReplacement(entry *mempoolEntry) ([]*mempoolEntry, error) {
+	conflicts := map[string]*mempoolEntry{}
+	for _, input := range entry.tx.Inputs {
+		if hash, ok := pool.spends[outpointKey(input)]; ok {
+			conflicts[hash] = pool.txx[hash]
+		}
+	}
+	if len(conflicts) == 0 {
+		return nil, nil
+	}
+
+	replaced := map[string]*mempoolEntry{}
+	for hash, e := range conflicts {
+		if entry.feeRate() <= e.feeRate() {
+			return nil, fmt.Errorf("%w %s: replacement fee rate %.4f not above %.4f", ErrMempoolConflict, hash, entry.feeRate(), e.feeRate())
+		}
+		replaced[hash] = e
+		for _, d := range pool.descendants(hash) {
+			replaced[d.hash] = d
+		}
+	}
+	if len(replaced) > maxReplacements {
+		return nil, fmt.Errorf("%w: replacement would evict %d transactions", ErrMempoolConflict, len(replaced))
+	}
+	for _, a := range pool.ancestors(entry) {
+		if _, ok := replaced[a.hash]; ok {
+			return nil, fmt.Errorf("%w: replacement spends outputs of %s, which it replaces", ErrMempoolConflict, a.hash)
+		}
+	}
+
+	var replacedFee int64
+	for _, e := range replaced {
+		replacedFee += e.fee
+	}
+	relayFee := int64(pool.config.MinRelayFeeRate * float64(entry.size))
+	if entry.fee < replacedFee+relayFee {
+		return nil, fmt.Errorf("%w: replacement fee %d must be at least %d", ErrMempoolConflict, entry.fee, replacedFee+relayFee)
+	}
+
+	entries := make([]*mempoolEntry, 0, len(replaced))
+	for _, e := range replaced {
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// descendants returns all pending transactions that spend outputs of the
+// transaction with the given hash, directly or through other pending
+// transactions.
+func (pool *Mempool) descendants(hash string) []*mempoolEntry {
+	var (
+		result  = []*mempoolEntry{}
+		seen    = map[string]bool{hash: true}
+		pending = []string{hash}
+	)
+	for len(pending) > 0 {
+		current := pool.txx[pending[0]]
+		pending = pending[1:]
+		if current == nil {
+			continue
+		}
+		for i := range current.tx.Outputs {
+			child, ok := pool.spends[fmt.Sprintf("%s_%d", current.hash, i)]
+			if !ok || seen[child] {
+				continue
+			}
+			seen[child] = true
+			result = append(result, pool.txx[child])
+			pending = append(pending, child)
+		}
+	}
+	return result
+}
+
+func (pool *Mempool) insert(e *mempoolEntry) {
+	pool.txx[e.hash] = e
+	pool.bytes += e.size
+	for _, input := range e.tx.Inputs {
+		pool.spends[outpointKey(input)] = e.hash
+	}
+}
+
+// evictionCandidates returns the cheapest entries that have to go to make
+// room for entry. An entry is always evicted together with its descendants,
+// and only if the package as a whole pays a lower fee rate than entry. It
+// returns false if entry cannot make enough room.
+func (pool *Mempool) evictionCandidates(entry *mempoolEntry) ([]*mempoolEntry, bool) {
+	var (
+		count = len(pool.txx) + 1
+		bytes = pool.bytes + entry.size
+	)
+	if !pool.overLimit(count, bytes) {
+		return nil, true
+	}
+
+	var (
+		entries = pool.entriesByFeeRate()
+		evicted = map[string]bool{}
+		evict   = []*mempoolEntry{}
+	)
+	for i := len(entries) - 1; i >= 0 && pool.overLimit(count, bytes); i-- {
+		if evicted[entries[i].hash] {
+			continue
+		}
+		pkg := append([]*mempoolEntry{entries[i]}, pool.descendants(entries[i].hash)...)
+		if packageFeeRate(pkg) >= entry.feeRate() {
+			return nil, false
+		}
+		for _, e := range pkg {
+			if evicted[e.hash] {
+				continue
+			}
+			evicted[e.hash] = true
+			evict = append(evict, e)
+			count--
+			bytes -= e.size
+		}
+	}
+	return evict, !pool.overLimit(count, bytes)
+}
+
+func (pool *Mempool) overLimit(count, bytes int) bool {
+	return (pool.config.MaxTxs > 0 && count > pool.config.MaxTxs) ||
+		(pool.config.MaxBytes > 0 && bytes > pool.config.MaxBytes)
+}
+
+// entriesByFeeRate returns all entries, highest fee rate first.
+func (pool *Mempool) entriesByFeeRate() []*mempoolEntry {
+	entries := make([]*mempoolEntry, 0, len(pool.txx))
+	for _, e := range pool.txx {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].feeRate() > entries[j].feeRate()
+	})
+	return entries
+}
+
+// Expire removes and returns the transactions that have been pending for
+// longer than the configured maximum age.
+func (pool *Mempool) Expire(now time.Time) []*proto.Transaction {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	expired := []*proto.Transaction{}
+	if pool.config.MaxAge <= 0 {
+		return expired
+	}
+	for hash, e := range pool.txx {
+		if now.Sub(e.added) <= pool.config.MaxAge {
+			continue
+		}
+		// descendants cannot stay without their parent
+		for _, d := range append(pool.descendants(hash), e) {
+			if _, ok := pool.txx[d.hash]; !ok {
+				continue
+			}
+			pool.remove(d.hash)
+			pool.dropped(d.hash)
+			expired = append(expired, d.tx)
+		}
+	}
+	return expired
+}
+
+func (pool *Mempool) remove(hash string) {
+	e, ok := pool.txx[hash]
+	if !ok {
+		return
+	}
+	delete(pool.txx, hash)
+	pool.bytes -= e.size
+	for _, input := range e.tx.Inputs {
+		delete(pool.spends, outpointKey(input))
+	}
+}
+
+// dropped reports an unconfirmed transaction removed from the pool to the
+// drop handler.
+func (pool *Mempool) dropped(hash string) {
+	if pool.onDrop != nil {
+		pool.onDrop(hash)
+	}
+}
+
+// pendingOutput returns the output spent by input if it was created by a
+// pending transaction. The caller must hold the lock.
+func (pool *Mempool) pendingOutput(input *proto.TxInput) (*UTXO, bool) {
+	e, ok := pool.txx[hex.EncodeToString(input.PrevTxHash)]
+	if !ok || int(input.PrevOutIndex) >= len(e.tx.Outputs) {
+		return nil, false
+	}
+	return outputUTXOs(e.tx)[input.PrevOutIndex], true
+}
+
+// ancestors returns all pending transactions entry depends on, directly or
+// through other pending transactions.
+func (pool *Mempool) ancestors(entry *mempoolEntry) []*mempoolEntry {
+	var (
+		result  = []*mempoolEntry{}
+		seen    = map[string]bool{entry.hash: true}
+		pending = []*mempoolEntry{entry}
+	)
+	for len(pending) > 0 {
+		current := pending[0]
+		pending = pending[1:]
+		for _, input := range current.tx.Inputs {
+			parentHash := hex.EncodeToString(input.PrevTxHash)
+			parent, ok := pool.txx[parentHash]
+			if !ok || seen[parentHash] {
+				continue
+			}
+			seen[parentHash] = true
+			result = append(result, parent)
+			pending = append(pending, parent)
+		}
+	}
+	return result
+}
+
+func packageFeeRate(pkg []*mempoolEntry) float64 {
+	var (
+		fee  int64
+		size int
+	)
+	for _, e := range pkg {
+		fee += e.fee
+		size += e.size
+	}
+	return float64(fee) / float64(size)
+}
+
+// SelectTransactions picks up to max pending transactions for the next block.
+// Transactions are chosen as packages with their unconfirmed ancestors, best
+// combined ancestor fee rate first, so a child paying a high fee pulls in its
+// cheap parent. The result is ordered so parents come before their children.
+//
+// The ancestors of every transaction are collected once. When a package is
+// selected, the fee and size totals of the transactions depending on it are
+// updated in place, and a heap keeps the best remaining package on top.
+func (pool *Mempool) SelectTransactions(max int) []*proto.Transaction {
+	pool.lock.RLock()
+	defer pool.lock.RUnlock()
+
+	var (
+		candidates  = make(map[string]*selectionCandidate, len(pool.txx))
+		descendants = make(map[string][]*selectionCandidate, len(pool.txx))
+		queue       = make(selectionQueue, 0, len(pool.txx))
+	)
+	for hash, e := range pool.txx {
+		c := &selectionCandidate{
+			entry:     e,
+			ancestors: make(map[string]*mempoolEntry),
+			fee:       e.fee,
+			size:      e.size,
+		}
+		for _, a := range pool.ancestors(e) {
+			c.ancestors[a.hash] = a
+			c.fee += a.fee
+			c.size += a.size
+		}
+		c.depth = len(c.ancestors)
+		c.index = len(queue)
+		candidates[hash] = c
+		queue = append(queue, c)
+	}
+	for _, c := range candidates {
+		for hash := range c.ancestors {
+			descendants[hash] = append(descendants[hash], c)
+		}
+	}
+	heap.Init(&queue)
+
+	result := []*proto.Transaction{}
+	for len(result) < max && queue.Len() > 0 {
+		best := heap.Pop(&queue).(*selectionCandidate)
+		if len(result)+len(best.ancestors)+1 > max {
+			continue
+		}
+
+		pkg := []*selectionCandidate{best}
+		for hash := range best.ancestors {
+			pkg = append(pkg, candidates[hash])
+		}
+		// a parent always has fewer ancestors than any of its children
+		sort.Slice(pkg, func(i, j int) bool {
+			return pkg[i].depth < pkg[j].depth
+		})
+		for _, c := range pkg {
+			// ancestors popped before for not fitting are no longer queued
+			if c != best && c.index >= 0 {
+				heap.Remove(&queue, c.index)
+			}
+			result = append(result, c.entry.tx)
+			for _, d := range descendants[c.entry.hash] {
+				if _, ok := d.ancestors[c.entry.hash]; !ok {
+					continue
+				}
+				delete(d.ancestors, c.entry.hash)
+				d.fee -= c.entry.fee
+				d.size -= c.entry.size
+				if d.index >= 0 {
+					heap.Fix(&queue, d.index)
+				}
+			}
+		}
+	}
+	return result
+}
+
+// selectionCandidate is a pending transaction with the totals of the package
+// it forms with its ancestors that are not selected yet.
+type selectionCandidate struct {
+	entry     *mempoolEntry
+	ancestors map[string]*mempoolEntry
+	fee       int64
+	size      int
+	// depth is the number of pending ancestors.
+	depth int
+	// index is the position in the selectionQueue, -1 once popped.
+	index int
+}
+
+func (c *selectionCandidate) feeRate() float64 {
+	return float64(c.fee) / float64(c.size)
+}
+
+// selectionQueue is a max heap of candidates by package fee rate, ties
+// broken by hash so the selection is deterministic.
+type selectionQueue []*selectionCandidate
+
+func (q selectionQueue) Len() int { return len(q) }
+
+func (q selectionQueue) Less(i, j int) bool {
+	ri, rj := q[i].feeRate(), q[j].feeRate()
+	if ri != rj {
+		return ri > rj
+	}
+	return q[i].entry.hash < q[j].entry.hash
+}
+
+func (q selectionQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *selectionQueue) Push(x interface{}) {
+	c := x.(*selectionCandidate)
+	c.index = len(*q)
+	*q = append(*q, c)
+}
+
+func (q *selectionQueue) Pop() interface{} {
+	old := *q
+	c := old[len(old)-1]
+	old[len(old)-1] = nil
+	c.index = -1
+	*q = old[:len(old)-1]
+	return c
+}
+
+// RemoveConfirmed removes transactions included in a block from the pool,
+// together with pending transactions that conflict with them and their
+// descendants.
+func (pool *Mempool) RemoveConfirmed(txx []*proto.Transaction) {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	for _, tx := range txx {
+		hash := hex.EncodeToString(types.HashTransaction(tx))
+		if _, ok := pool.txx[hash]; ok {
+			pool.remove(hash)
+			continue
+		}
+		for _, input := range tx.Inputs {
+			conflict, ok := pool.spends[outpointKey(input)]
+			if !ok {
+				continue
+			}
+			for _, d := range pool.descendants(conflict) {
+				pool.remove(d.hash)
+				pool.dropped(d.hash)
+			}
+			pool.remove(conflict)
+			pool.dropped(conflict)
+		}
+	}
+}
+
+// Revalidate checks all pending transactions with check, parents first, and
+// removes the ones that fail together with their descendants. It returns the
+// removed transactions.
+func (pool *Mempool) Revalidate(check func(*proto.Transaction) error) []*proto.Transaction {
+	pool.lock.RLock()
+	entries := pool.entriesByDepth()
+	pool.lock.RUnlock()
+
+	removed := []*proto.Transaction{}
+	for _, e := range entries {
+		if err := check(e.tx); err == nil {
+			continue
+		}
+		pool.lock.Lock()
+		for _, d := range append(pool.descendants(e.hash), e) {
+			if _, ok := pool.txx[d.hash]; !ok {
+				continue
+			}
+			pool.remove(d.hash)
+			pool.dropped(d.hash)
+			removed = append(removed, d.tx)
+		}
+		pool.lock.Unlock()
+	}
+	return removed
+}
+
+// entriesByDepth returns all entries ordered by their number of pending
+// ancestors, so parents come before their children.
+func (pool *Mempool) entriesByDepth() []*mempoolEntry {
+	entries := make([]*mempoolEntry, 0, len(pool.txx))
+	depth := make(map[string]int, len(pool.txx))
+	for _, e := range pool.txx {
+		entries = append(entries, e)
+		depth[e.hash] = len(pool.ancestors(e))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return depth[entries[i].hash] < depth[entries[j].hash]
+	})
+	return entries
+}
+
+// Save writes all pending transactions to path, parents before children, so
+// they can be restored with LoadMempoolSnapshot after a restart.
+func (pool *Mempool) Save(path string) error {
+	pool.lock.RLock()
+	entries := pool.entriesByDepth()
+	pool.lock.RUnlock()
+
+	snapshot := &proto.MempoolSnapshot{}
+	for _, e := range entries {
+		snapshot.Entries = append(snapshot.Entries, &proto.MempoolEntry{
+			Transaction: e.tx,
+			AddedAt:     e.added.UnixNano(),
+		})
+	}
+
+	b, err := pb.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(path, b, 0644)
+}
+
+// LoadMempoolSnapshot reads the transactions saved by Mempool.Save. A missing
+// file is not an error and yields no entries.
+func LoadMempoolSnapshot(path string) ([]*proto.MempoolEntry, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &proto.MempoolSnapshot{}
+	if err := pb.Unmarshal(b, snapshot); err != nil {
+		return nil, fmt.Errorf("corrupt mempool file %s: %w", path, err)
+	}
+	return snapshot.Entries, nil
+}
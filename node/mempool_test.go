@@ -0,0 +1,444 @@
+package node
+
+import (
+	"encoding/hex"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/LDM-A/GoBlocker/proto"
+	"github.com/LDM-A/GoBlocker/types"
+	"github.com/LDM-A/GoBlocker/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pb "github.com/golang/protobuf/proto"
+)
+
+// newFreePool returns a pool without limits or a minimum fee, for the tests
+// of the pool mechanics.
+func newFreePool() *Mempool {
+	return NewMemPoolWithConfig(MempoolConfig{})
+}
+
+func TestMempoolConfigDefaults(t *testing.T) {
+	n := newTestNode(t, ServerConfig{Version: "Blocker-1", Mempool: MempoolConfig{MaxTxs: 10}})
+
+	defaults := DefaultMempoolConfig()
+	assert.Equal(t, 10, n.mempool.config.MaxTxs)
+	assert.Equal(t, defaults.MaxBytes, n.mempool.config.MaxBytes)
+	assert.Equal(t, defaults.MaxAge, n.mempool.config.MaxAge)
+	assert.Equal(t, defaults.MinRelayFeeRate, n.mempool.config.MinRelayFeeRate)
+	assert.True(t, defaults.MinRelayFeeRate > 0)
+}
+
+func TestMempoolConflictingSpends(t *testing.T) {
+	var (
+		pool     = newFreePool()
+		prevHash = util.RandomHash()
+		tx       = &proto.Transaction{
+			Version: 1,
+			Inputs:  []*proto.TxInput{{PrevTxHash: prevHash, PrevOutIndex: 1}},
+		}
+		conflicting = &proto.Transaction{
+			Version: 2,
+			Inputs:  []*proto.TxInput{{PrevTxHash: prevHash, PrevOutIndex: 1}},
+		}
+		other = &proto.Transaction{
+			Version: 1,
+			Inputs:  []*proto.TxInput{{PrevTxHash: prevHash, PrevOutIndex: 0}},
+		}
+	)
+
+	added, err := pool.Add(tx, 0)
+	require.Nil(t, err)
+	assert.True(t, added)
+
+	added, err = pool.Add(tx, 0)
+	require.Nil(t, err)
+	assert.False(t, added)
+
+	_, err = pool.Add(conflicting, 0)
+	assert.True(t, errors.Is(err, ErrMempoolConflict))
+
+	added, err = pool.Add(other, 0)
+	require.Nil(t, err)
+	assert.True(t, added)
+
+	assert.Equal(t, 2, len(pool.Clear()))
+
+	// once cleared the outpoint is free again
+	added, err = pool.Add(conflicting, 0)
+	require.Nil(t, err)
+	assert.True(t, added)
+}
+
+func randomPoolTx() *proto.Transaction {
+	return &proto.Transaction{
+		Version: 1,
+		Inputs:  []*proto.TxInput{{PrevTxHash: util.RandomHash()}},
+		Outputs: []*proto.TxOutput{{Amount: 1, Address: util.RandomHash()[:20]}},
+	}
+}
+
+func TestMempoolRejectsTransactionWithoutInputs(t *testing.T) {
+	pool := newFreePool()
+
+	for _, tx := range []*proto.Transaction{{}, {Version: 1, Outputs: []*proto.TxOutput{{}}}} {
+		_, err := pool.Add(tx, 0)
+		assert.True(t, errors.Is(err, ErrNoInputs))
+	}
+	assert.Equal(t, 0, pool.Len())
+}
+
+func TestMempoolEvictsLowestFeeRate(t *testing.T) {
+	pool := NewMemPoolWithConfig(MempoolConfig{MaxTxs: 3})
+	dropped := []string{}
+	pool.SetDropHandler(func(hash string) { dropped = append(dropped, hash) })
+
+	var (
+		cheap  = randomPoolTx()
+		medium = randomPoolTx()
+		rich   = randomPoolTx()
+	)
+	for fee, tx := range map[int64]*proto.Transaction{10: cheap, 50: medium, 100: rich} {
+		added, err := pool.Add(tx, fee)
+		require.Nil(t, err)
+		require.True(t, added)
+	}
+
+	// paying less than everything pending does not get in
+	_, err := pool.Add(randomPoolTx(), 5)
+	assert.True(t, errors.Is(err, ErrMempoolFull))
+
+	added, err := pool.Add(randomPoolTx(), 75)
+	require.Nil(t, err)
+	assert.True(t, added)
+	assert.Equal(t, 3, len(pool.txx))
+	assert.False(t, pool.Has(cheap))
+	assert.True(t, pool.Has(medium))
+	assert.True(t, pool.Has(rich))
+	assert.Equal(t, []string{hex.EncodeToString(types.HashTransaction(cheap))}, dropped)
+}
+
+func TestMempoolMaxBytes(t *testing.T) {
+	size := pb.Size(randomPoolTx())
+	pool := NewMemPoolWithConfig(MempoolConfig{MaxBytes: 2 * size})
+
+	first := randomPoolTx()
+	_, err := pool.Add(first, 1)
+	require.Nil(t, err)
+	_, err = pool.Add(randomPoolTx(), 2)
+	require.Nil(t, err)
+	_, err = pool.Add(randomPoolTx(), 3)
+	require.Nil(t, err)
+
+	assert.Equal(t, 2, len(pool.txx))
+	assert.Equal(t, 2*size, pool.bytes)
+	assert.False(t, pool.Has(first))
+}
+
+func TestMempoolMinFeeRateRises(t *testing.T) {
+	pool := NewMemPoolWithConfig(MempoolConfig{MaxTxs: 2, MinRelayFeeRate: 1})
+	assert.Equal(t, 1.0, pool.MinFeeRate())
+
+	tx := randomPoolTx()
+	size := int64(pb.Size(tx))
+	_, err := pool.Add(tx, size-1)
+	assert.True(t, errors.Is(err, ErrFeeTooLow))
+
+	_, err = pool.Add(tx, size)
+	require.Nil(t, err)
+	assert.Equal(t, 1+9*0.25, pool.MinFeeRate())
+
+	_, err = pool.Add(randomPoolTx(), size*2)
+	assert.True(t, errors.Is(err, ErrFeeTooLow))
+}
+
+func TestMempoolExpire(t *testing.T) {
+	pool := NewMemPoolWithConfig(MempoolConfig{MaxAge: time.Minute})
+	var (
+		old   = randomPoolTx()
+		fresh = randomPoolTx()
+	)
+	_, err := pool.Add(old, 0)
+	require.Nil(t, err)
+	pool.txx[hex.EncodeToString(types.HashTransaction(old))].added = time.Now().Add(-time.Hour)
+	_, err = pool.Add(fresh, 0)
+	require.Nil(t, err)
+
+	expired := pool.Expire(time.Now())
+	assert.Equal(t, []*proto.Transaction{old}, expired)
+	assert.False(t, pool.Has(old))
+	assert.True(t, pool.Has(fresh))
+	assert.Equal(t, 0, len(pool.spends[outpointKey(old.Inputs[0])]))
+}
+
+func spendingTx(prevTx *proto.Transaction, index uint32, version int32) *proto.Transaction {
+	return &proto.Transaction{
+		Version: version,
+		Inputs: []*proto.TxInput{
+			{PrevTxHash: types.HashTransaction(prevTx), PrevOutIndex: index},
+		},
+		Outputs: []*proto.TxOutput{{Amount: 1, Address: util.RandomHash()[:20]}},
+	}
+}
+
+func TestMempoolReplaceByFee(t *testing.T) {
+	var (
+		pool     = newFreePool()
+		prevTx   = randomPoolTx()
+		original = spendingTx(prevTx, 0, 1)
+		cheaper  = spendingTx(prevTx, 0, 2)
+		better   = spendingTx(prevTx, 0, 3)
+	)
+	_, err := pool.Add(original, 100)
+	require.Nil(t, err)
+
+	_, err = pool.Add(cheaper, 100)
+	assert.True(t, errors.Is(err, ErrMempoolConflict))
+	assert.True(t, pool.Has(original))
+
+	added, err := pool.Add(better, 101)
+	require.Nil(t, err)
+	assert.True(t, added)
+	assert.False(t, pool.Has(original))
+	assert.True(t, pool.Has(better))
+	assert.Equal(t, hex.EncodeToString(types.HashTransaction(better)), pool.spends[outpointKey(better.Inputs[0])])
+}
+
+func TestMempoolReplaceByFeeWithDescendants(t *testing.T) {
+	var (
+		pool        = newFreePool()
+		prevTx      = randomPoolTx()
+		parent      = spendingTx(prevTx, 0, 1)
+		child       = spendingTx(parent, 0, 1)
+		grandChild  = spendingTx(child, 0, 1)
+		replacement = spendingTx(prevTx, 0, 2)
+	)
+	for _, tx := range []*proto.Transaction{parent, child, grandChild} {
+		_, err := pool.Add(tx, 100)
+		require.Nil(t, err)
+	}
+
+	// a higher fee rate alone is not enough, the descendants' fees count too
+	_, err := pool.Add(replacement, 250)
+	assert.True(t, errors.Is(err, ErrMempoolConflict))
+	assert.Equal(t, 3, len(pool.txx))
+
+	added, err := pool.Add(replacement, 300)
+	require.Nil(t, err)
+	assert.True(t, added)
+	assert.Equal(t, 1, len(pool.txx))
+	assert.True(t, pool.Has(replacement))
+	assert.False(t, pool.Has(child))
+	assert.False(t, pool.Has(grandChild))
+}
+
+func TestMempoolReplacementCannotSpendReplaced(t *testing.T) {
+	var (
+		pool     = newFreePool()
+		prevTx   = randomPoolTx()
+		original = spendingTx(prevTx, 0, 1)
+	)
+	_, err := pool.Add(original, 100)
+	require.Nil(t, err)
+
+	// conflicts with original, but also spends its output, which would be
+	// gone once original is replaced
+	replacement := spendingTx(prevTx, 0, 2)
+	replacement.Inputs = append(replacement.Inputs, spendingTx(original, 0, 1).Inputs[0])
+	_, err = pool.Add(replacement, 1000)
+	assert.True(t, errors.Is(err, ErrMempoolConflict))
+	assert.True(t, pool.Has(original))
+	assert.False(t, pool.Has(replacement))
+}
+
+func TestMempoolReplaceByFeePaysRelayFee(t *testing.T) {
+	var (
+		pool        = NewMemPoolWithConfig(MempoolConfig{MinRelayFeeRate: 1})
+		prevTx      = randomPoolTx()
+		original    = spendingTx(prevTx, 0, 1)
+		replacement = spendingTx(prevTx, 0, 2)
+		size        = int64(pb.Size(original))
+	)
+	_, err := pool.Add(original, size)
+	require.Nil(t, err)
+
+	_, err = pool.Add(replacement, size+1)
+	assert.True(t, errors.Is(err, ErrMempoolConflict))
+
+	_, err = pool.Add(replacement, 2*size)
+	assert.Nil(t, err)
+}
+
+func TestMempoolSelectTransactionsByAncestorFeeRate(t *testing.T) {
+	var (
+		pool   = newFreePool()
+		parent = spendingTx(randomPoolTx(), 0, 1)
+		child  = spendingTx(parent, 0, 1)
+		medium = randomPoolTx()
+		cheap  = randomPoolTx()
+	)
+	for tx, fee := range map[*proto.Transaction]int64{parent: 1, child: 300, medium: 100, cheap: 10} {
+		_, err := pool.Add(tx, fee)
+		require.Nil(t, err)
+	}
+
+	assert.Equal(t, []*proto.Transaction{parent, child}, pool.SelectTransactions(2))
+	assert.Equal(t, []*proto.Transaction{parent, child, medium}, pool.SelectTransactions(3))
+	assert.Equal(t, []*proto.Transaction{medium}, pool.SelectTransactions(1))
+	assert.Equal(t, 4, len(pool.SelectTransactions(10)))
+}
+
+func TestMempoolSelectTransactionsUpdatesDescendants(t *testing.T) {
+	pool := newFreePool()
+	parent := randomPoolTx()
+	parent.Outputs = append(parent.Outputs, &proto.TxOutput{Amount: 1, Address: util.RandomHash()[:20]})
+	var (
+		first     = spendingTx(parent, 0, 1)
+		second    = spendingTx(parent, 1, 1)
+		unrelated = randomPoolTx()
+	)
+	for tx, fee := range map[*proto.Transaction]int64{parent: 1, first: 500, second: 300, unrelated: 200} {
+		_, err := pool.Add(tx, fee)
+		require.Nil(t, err)
+	}
+
+	// once the parent is in, second no longer has to pay for it and beats
+	// the unrelated transaction
+	assert.Equal(t, []*proto.Transaction{parent, first, second}, pool.SelectTransactions(3))
+}
+
+func TestMempoolEvictsDescendantsWithParent(t *testing.T) {
+	var (
+		pool   = NewMemPoolWithConfig(MempoolConfig{MaxTxs: 3})
+		parent = spendingTx(randomPoolTx(), 0, 1)
+		child  = spendingTx(parent, 0, 1)
+		other  = randomPoolTx()
+	)
+	for tx, fee := range map[*proto.Transaction]int64{parent: 1, child: 2, other: 50} {
+		_, err := pool.Add(tx, fee)
+		require.Nil(t, err)
+	}
+
+	_, err := pool.Add(randomPoolTx(), 10)
+	require.Nil(t, err)
+	assert.Equal(t, 2, len(pool.txx))
+	assert.False(t, pool.Has(parent))
+	assert.False(t, pool.Has(child))
+	assert.True(t, pool.Has(other))
+}
+
+func TestMempoolRemoveConfirmed(t *testing.T) {
+	var (
+		pool      = newFreePool()
+		prevTx    = randomPoolTx()
+		parent    = spendingTx(prevTx, 0, 1)
+		child     = spendingTx(parent, 0, 1)
+		pending   = spendingTx(prevTx, 1, 1)
+		conflict  = spendingTx(prevTx, 1, 2)
+		dependent = spendingTx(pending, 0, 1)
+	)
+	for _, tx := range []*proto.Transaction{parent, child, pending, dependent} {
+		_, err := pool.Add(tx, 10)
+		require.Nil(t, err)
+	}
+
+	pool.RemoveConfirmed([]*proto.Transaction{parent, conflict})
+	assert.Equal(t, 1, len(pool.txx))
+	assert.True(t, pool.Has(child))
+	assert.Equal(t, 1, len(pool.spends))
+}
+
+func TestMempoolSaveKeepsParentsFirst(t *testing.T) {
+	var (
+		file   = filepath.Join(t.TempDir(), "mempool.dat")
+		pool   = newFreePool()
+		parent = spendingTx(randomPoolTx(), 0, 1)
+		child  = spendingTx(parent, 0, 1)
+	)
+	_, err := pool.Add(parent, 1)
+	require.Nil(t, err)
+	_, err = pool.Add(child, 1)
+	require.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		_, err := pool.Add(randomPoolTx(), 1)
+		require.Nil(t, err)
+	}
+	require.Nil(t, pool.Save(file))
+
+	entries, err := LoadMempoolSnapshot(file)
+	require.Nil(t, err)
+	assert.Equal(t, 12, len(entries))
+
+	index := map[string]int{}
+	for i, e := range entries {
+		index[hex.EncodeToString(types.HashTransaction(e.Transaction))] = i
+		assert.NotZero(t, e.AddedAt)
+	}
+	assert.Less(t,
+		index[hex.EncodeToString(types.HashTransaction(parent))],
+		index[hex.EncodeToString(types.HashTransaction(child))])
+
+	missing, err := LoadMempoolSnapshot(filepath.Join(t.TempDir(), "missing.dat"))
+	assert.Nil(t, err)
+	assert.Nil(t, missing)
+}
+
+func TestMempoolStats(t *testing.T) {
+	var (
+		pool  = newFreePool()
+		cheap = randomPoolTx()
+		mid   = randomPoolTx()
+		rich  = randomPoolTx()
+	)
+	_, err := pool.Add(cheap, 0)
+	require.Nil(t, err)
+	_, err = pool.Add(mid, int64(pb.Size(mid))*3)
+	require.Nil(t, err)
+	_, err = pool.Add(rich, int64(pb.Size(rich))*5000)
+	require.Nil(t, err)
+
+	assert.Equal(t, 3, pool.Len())
+	assert.Equal(t, []string{
+		hex.EncodeToString(types.HashTransaction(rich)),
+		hex.EncodeToString(types.HashTransaction(mid)),
+		hex.EncodeToString(types.HashTransaction(cheap)),
+	}, pool.Hashes())
+
+	got, ok := pool.Get(hex.EncodeToString(types.HashTransaction(mid)))
+	assert.True(t, ok)
+	assert.Equal(t, mid, got)
+	_, ok = pool.Get(hex.EncodeToString(util.RandomHash()))
+	assert.False(t, ok)
+
+	stats := pool.Stats()
+	assert.Equal(t, 3, stats.Count)
+	assert.Equal(t, pb.Size(cheap)+pb.Size(mid)+pb.Size(rich), stats.Bytes)
+	require.Equal(t, len(feeHistogramBounds), len(stats.FeeHistogram))
+	counts := make(map[float64]int)
+	for _, b := range stats.FeeHistogram {
+		counts[b.MinFeeRate] = b.Count
+	}
+	assert.Equal(t, map[float64]int{0: 1, 1: 0, 2: 1, 5: 0, 10: 0, 20: 0, 50: 0, 100: 0, 200: 0, 500: 0, 1000: 1}, counts)
+}
+
+func TestMempoolCheckLeavesPoolUnchanged(t *testing.T) {
+	var (
+		pool     = newFreePool()
+		prevTx   = randomPoolTx()
+		original = spendingTx(prevTx, 0, 1)
+		better   = spendingTx(prevTx, 0, 2)
+	)
+	_, err := pool.Add(original, 100)
+	require.Nil(t, err)
+
+	assert.True(t, errors.Is(pool.Check(better, 100), ErrMempoolConflict))
+	assert.Nil(t, pool.Check(better, 200))
+	assert.True(t, pool.Has(original))
+	assert.False(t, pool.Has(better))
+	assert.Equal(t, hex.EncodeToString(types.HashTransaction(original)), pool.spends[outpointKey(original.Inputs[0])])
+	assert.Equal(t, pb.Size(original), pool.bytes)
+}
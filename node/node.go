@@ -1,8 +1,12 @@
 package node
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"net"
 	"sync"
 	"time"
@@ -12,260 +16,810 @@ import (
 	"github.com/LDM-A/GoBlocker/types"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/peer"
-)
-
-type Mempool struct {
-	lock sync.RWMutex
-	txx  map[string]*proto.Transaction
-}
-
-func NewMemPool() *Mempool {
-	return &Mempool{
-		txx: make(map[string]*proto.Transaction),
-	}
-}
-
-func (pool *Mempool) Clear() []*proto.Transaction {
-	pool.lock.Lock()
-	defer pool.lock.Unlock()
-
-	txx := make([]*proto.Transaction, len(pool.txx))
-	it := 0
-	for k, v := range pool.txx {
-		delete(pool.txx, k)
-		txx[it] = v
-		it++
-	}
-
-	return txx
-}
-
-func (pool *Mempool) Len() int {
-	pool.lock.RLock()
-	defer pool.lock.Unlock()
-	return len(pool.txx)
-}
+	"google.golang.org/grpc/status"
 
-func (pool *Mempool) Has(tx *proto.Transaction) bool {
-	pool.lock.RLock()
-	defer pool.lock.RUnlock()
-	hash := hex.EncodeToString(types.HashTransaction(tx))
-	_, ok := pool.txx[hash]
-	return ok
-}
-
-func (pool *Mempool) Add(tx *proto.Transaction) bool {
-	if pool.Has(tx) {
-		return false
-	}
-	pool.lock.Lock()
-	defer pool.lock.Unlock()
-	hash := hex.EncodeToString(types.HashTransaction(tx))
-	pool.txx[hash] = tx
-
-	return true
-}
+	pb "github.com/golang/protobuf/proto"
+)
 
 type ServerConfig struct {
 	Version    string
 	ListenAddr string
 	PrivateKey *crypto.PrivateKey
+	// Signer seals the blocks this node produces. When it is nil and a
+	// PrivateKey is given, the key is used directly.
+	Signer types.Signer
+	// Threshold seals the blocks with a threshold group key held by
+	// participant daemons. It is used when Signer is nil.
+	Threshold *ThresholdConfig
+	// Validators are the keys allowed to seal blocks. Blocks sealed by any
+	// key are accepted when empty, which is only meant for development.
+	Validators []*crypto.PublicKey
+	// Mempool holds the mempool limits, the defaults are used for the
+	// fields left zero.
+	Mempool MempoolConfig
+	// ChainFile is where the main chain is saved on Stop and restored from
+	// on Start. The chain is only kept in memory, so without it a restarted
+	// node starts over from genesis and drops the saved transactions that
+	// spend outputs of the lost blocks.
+	ChainFile string
+	// MempoolFile is where pending transactions are saved on Stop and
+	// restored from on Start. Persistence is disabled when empty.
+	MempoolFile string
+	// FeeEstimatesFile is where the fee estimator state is saved on Stop and
+	// restored from on Start. Persistence is disabled when empty.
+	FeeEstimatesFile string
+	// AddressBookFile is where the addresses of known nodes are saved on
+	// Stop and restored from on Start. Persistence is disabled when empty.
+	AddressBookFile string
+	// MaxInbound and MaxOutbound limit the number of peers connecting to us
+	// and the ones we dial. The defaults are used when zero.
+	MaxInbound  int
+	MaxOutbound int
+	// BanListFile is where banned hosts are saved on Stop and restored from
+	// on Start. Persistence is disabled when empty.
+	BanListFile string
+	// BanDuration is how long misbehaving hosts are banned, the default is
+	// used when zero.
+	BanDuration time.Duration
+	// NodeKeyFile holds the key identifying the node to its peers. It is
+	// created on Start when missing. A new identity is used on every run
+	// when empty.
+	NodeKeyFile string
+	// TLS enables TLS for all connections. They are unencrypted when nil.
+	TLS *TLSConfig
+	// AdminSocket is the unix socket serving the Admin service, which
+	// manages the bans. Only local users allowed to open the socket can use
+	// it. The service is disabled when empty.
+	AdminSocket string
 }
 type Node struct {
 	ServerConfig
 	logger   *zap.SugaredLogger
 	peerLock sync.RWMutex
-	peers    map[proto.NodeClient]*proto.Version
-	mempool  *Mempool
+	// nodeKey proves our identity to peers, which are keyed by their node
+	// id.
+	nodeKey *crypto.PrivateKey
+	peers   map[string]*remotePeer
+	// bootstrapAddrs are the peers given to Start, which are dialed again
+	// when the connection is lost. reconnecting holds the ones being dialed.
+	bootstrapAddrs map[string]bool
+	reconnecting   map[string]bool
+	// dialch wakes addrLoop up to dial new addresses.
+	dialch   chan struct{}
+	addrBook *AddressBook
+	bans     *BanList
+
+	// requested holds the inventory being fetched from peers.
+	requestLock sync.Mutex
+	requested   map[string]*inventoryRequest
+	timers      peerTimers
+
+	mempool *Mempool
+	orphans *OrphanPool
+	// orphanBlocks wait for their ancestors, requested from the peers
+	// that sent them.
+	orphanBlocks *OrphanBlockPool
+	chain        *Chain
+	fees         *FeeEstimator
+
+	// pending is the last block built by the validator loop, kept until it
+	// is added to the chain. It is not sealed yet if the signer failed.
+	pending *proto.Block
+
+	serverLock  sync.Mutex
+	grpcServer  *grpc.Server
+	adminServer *grpc.Server
+	quitch      chan struct{}
+	stopOnce    sync.Once
+	// serverTLS and clientTLS are used to serve and to dial peers when TLS
+	// is enabled.
+	serverTLS *tls.Config
+	clientTLS *tls.Config
 	proto.UnimplementedNodeServer
 }
 
-func NewNode(cfg ServerConfig) *Node {
+// NewNode creates a node for cfg. The node key, the TLS configuration and
+// the threshold signer are loaded here, so they never change once the node
+// runs.
+func NewNode(cfg ServerConfig) (*Node, error) {
 	loggerConfig := zap.NewDevelopmentConfig()
 	loggerConfig.EncoderConfig.TimeKey = ""
 	logger, _ := loggerConfig.Build()
-	return &Node{
-		ServerConfig: cfg,
-		peers:        make(map[proto.NodeClient]*proto.Version),
-		logger:       logger.Sugar(),
-		mempool:      NewMemPool(),
+	if cfg.Signer == nil && cfg.PrivateKey != nil {
+		cfg.Signer = types.NewLocalSigner(cfg.PrivateKey)
+	}
+	cfg.Mempool = cfg.Mempool.withDefaults()
+	if cfg.MaxInbound == 0 {
+		cfg.MaxInbound = defaultMaxInbound
+	}
+	if cfg.MaxOutbound == 0 {
+		cfg.MaxOutbound = defaultMaxOutbound
+	}
+	if cfg.BanDuration == 0 {
+		cfg.BanDuration = defaultBanDuration
+	}
+	chain := NewChain(NewMemoryBlockStore(), newMemoryTXStore())
+	chain.SetValidators(cfg.Validators)
+	n := &Node{
+		ServerConfig:   cfg,
+		nodeKey:        crypto.GeneratePrivateKey(),
+		peers:          make(map[string]*remotePeer),
+		bootstrapAddrs: make(map[string]bool),
+		reconnecting:   make(map[string]bool),
+		dialch:         make(chan struct{}, 1),
+		addrBook:       NewAddressBook(),
+		bans:           NewBanList(),
+		requested:      make(map[string]*inventoryRequest),
+		timers:         defaultPeerTimers(),
+		logger:         logger.Sugar(),
+		mempool:        NewMemPoolWithConfig(cfg.Mempool),
+		orphans:        NewOrphanPool(),
+		orphanBlocks:   NewOrphanBlockPool(),
+		fees:           NewFeeEstimator(),
+		chain:          chain,
+		quitch:         make(chan struct{}),
+	}
+	n.mempool.SetDropHandler(func(hash string) {
+		n.fees.Forget(hash)
+	})
+
+	if n.NodeKeyFile != "" {
+		key, err := LoadKeyFile(n.NodeKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		n.nodeKey = key
 	}
+	if n.TLS != nil {
+		serverTLS, clientTLS, err := n.TLS.load()
+		if err != nil {
+			return nil, err
+		}
+		n.serverTLS = serverTLS
+		n.clientTLS = clientTLS
+	}
+	if n.Signer == nil && n.Threshold != nil {
+		signer, err := n.thresholdSigner()
+		if err != nil {
+			return nil, err
+		}
+		n.Signer = signer
+	}
+	return n, nil
 }
 
 func (n *Node) Start(listenAddr string, boostrapNodes []string) error {
 	n.ListenAddr = listenAddr
 
-	var (
-		opts       = []grpc.ServerOption{}
-		grpcServer = grpc.NewServer(opts...)
-	)
+	opts := []grpc.ServerOption{}
+	if n.serverTLS != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(n.serverTLS)))
+	}
+	if len(n.Validators) == 0 {
+		n.logger.Warnw("no validator set configured, accepting blocks sealed by any key", "we", listenAddr)
+	}
+
+	if n.FeeEstimatesFile != "" {
+		fees, err := LoadFeeEstimator(n.FeeEstimatesFile)
+		if err != nil {
+			n.logger.Warnw("discarding saved fee estimates", "file", n.FeeEstimatesFile, "err", err)
+		} else {
+			n.fees = fees
+		}
+	}
+	if n.AddressBookFile != "" {
+		addrBook, err := LoadAddressBook(n.AddressBookFile)
+		if err != nil {
+			n.logger.Warnw("discarding saved addresses", "file", n.AddressBookFile, "err", err)
+		} else {
+			n.addrBook = addrBook
+		}
+	}
+	if n.BanListFile != "" {
+		bans, err := LoadBanList(n.BanListFile)
+		if err != nil {
+			n.logger.Warnw("discarding saved bans", "file", n.BanListFile, "err", err)
+		} else {
+			n.bans = bans
+		}
+	}
+	if n.ChainFile != "" {
+		if err := n.loadChain(); err != nil {
+			return err
+		}
+	}
+	if n.MempoolFile != "" {
+		if err := n.loadMempool(); err != nil {
+			return err
+		}
+	}
+
+	// the persisted state is in place before anything can query it
 	ln, err := net.Listen("tcp", listenAddr)
 	if err != nil {
 		return err
 	}
+	if n.AdminSocket != "" {
+		if err := n.serveAdmin(n.AdminSocket); err != nil {
+			ln.Close()
+			return err
+		}
+	}
+	grpcServer := grpc.NewServer(opts...)
 	proto.RegisterNodeServer(grpcServer, n)
+	n.serverLock.Lock()
+	n.grpcServer = grpcServer
+	n.serverLock.Unlock()
 
 	n.logger.Infow("node started...", "port", n.ListenAddr)
 
-	// bootstrap the network with already known remote nodes in the network
-	if len(boostrapNodes) > 0 {
-		go n.bootstrapNetwork(boostrapNodes)
+	n.peerLock.Lock()
+	for _, addr := range boostrapNodes {
+		n.bootstrapAddrs[addr] = true
 	}
-	if n.PrivateKey != nil {
+	n.peerLock.Unlock()
+	go n.startNetwork(boostrapNodes)
+	if n.Signer != nil {
 		go n.validatorLoop()
 	}
-	return grpcServer.Serve(ln)
+	go n.mempoolLoop()
+	go n.heartbeatLoop()
+	go n.addrLoop()
+	if err := grpcServer.Serve(ln); err != nil {
+		n.stopAdmin()
+		return err
+	}
+	return nil
 }
 
-func (n *Node) Handshake(ctx context.Context, v *proto.Version) (*proto.Version, error) {
-	c, err := makeNodeClient(v.ListenAddr)
-	if err != nil {
-		return nil, err
+// Stop shuts the node down gracefully, letting in-flight requests finish,
+// and saves the chain, mempool, fee estimates, address book and bans if
+// persistence is enabled. Only the first call does anything.
+func (n *Node) Stop() error {
+	var err error
+	n.stopOnce.Do(func() {
+		err = n.stop()
+	})
+	return err
+}
+
+func (n *Node) stop() error {
+	close(n.quitch)
+	// peer streams are closed first, GracefulStop waits for them otherwise
+	for _, p := range n.getPeers() {
+		p.close()
+	}
+	n.serverLock.Lock()
+	grpcServer, adminServer := n.grpcServer, n.adminServer
+	n.serverLock.Unlock()
+	if grpcServer != nil {
+		grpcServer.GracefulStop()
+	}
+	if adminServer != nil {
+		adminServer.GracefulStop()
+	}
+	// every file is saved even if an earlier one fails
+	var errs []error
+	if n.ChainFile != "" {
+		errs = append(errs, n.chain.Save(n.ChainFile))
+	}
+	if n.FeeEstimatesFile != "" {
+		errs = append(errs, n.fees.Save(n.FeeEstimatesFile))
+	}
+	if n.AddressBookFile != "" {
+		errs = append(errs, n.addrBook.Save(n.AddressBookFile))
 	}
+	if n.BanListFile != "" {
+		errs = append(errs, n.bans.Save(n.BanListFile))
+	}
+	if n.MempoolFile != "" {
+		n.logger.Infow("saving mempool", "file", n.MempoolFile, "count", n.mempool.Len())
+		errs = append(errs, n.mempool.Save(n.MempoolFile))
+	}
+	return errors.Join(errs...)
+}
 
-	n.addPeer(c, v)
+// loadChain restores the blocks saved on the last shutdown. They are
+// validated again, and the chain stops at the first one that fails.
+func (n *Node) loadChain() error {
+	blocks, err := LoadChainSnapshot(n.ChainFile)
+	if err != nil {
+		return err
+	}
+	for _, b := range blocks {
+		if err := n.chain.AddBlock(b); err != nil {
+			n.logger.Warnw("dropped saved blocks", "file", n.ChainFile, "height", b.Header.Height, "err", err)
+			break
+		}
+	}
+	n.logger.Infow("restored chain", "file", n.ChainFile, "height", n.chain.Height())
+	return nil
+}
 
-	return n.getVersion(), nil
+// loadMempool restores the transactions saved on the last shutdown. Each one
+// is validated again against the current chain and dropped if it no longer
+// fits.
+func (n *Node) loadMempool() error {
+	entries, err := LoadMempoolSnapshot(n.MempoolFile)
+	if err != nil {
+		return err
+	}
+	restored := 0
+	for _, e := range entries {
+		added := time.Unix(0, e.AddedAt)
+		if n.Mempool.MaxAge > 0 && time.Since(added) > n.Mempool.MaxAge {
+			continue
+		}
+		ok, fee, err := n.mempool.addTransaction(e.Transaction, n.chain, added, true)
+		if err != nil {
+			n.logger.Debugw("dropped saved tx", "hash", hex.EncodeToString(types.HashTransaction(e.Transaction)), "err", err)
+			continue
+		}
+		if ok {
+			n.trackFee(e.Transaction, fee)
+			restored++
+		}
+	}
+	n.logger.Infow("restored mempool", "file", n.MempoolFile, "restored", restored, "saved", len(entries))
+	return nil
 }
 
 func (n *Node) HandleTransaction(ctx context.Context, tx *proto.Transaction) (*proto.Ack, error) {
-	peer, _ := peer.FromContext(ctx)
-	hash := hex.EncodeToString(types.HashTransaction(tx))
-
-	if n.mempool.Add(tx) {
-		n.logger.Debugw("Received tx", "from", peer.Addr, "hash", hash, "we", n.ListenAddr)
-		go func() {
-			if err := n.broadcast(tx); err != nil {
-				n.logger.Errorw("broadcast error", "err", err)
-			}
-		}()
+	from := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		from = peerHost(p.Addr)
+	}
+	// local clients like wallets are trusted, only remote ones are scored
+	local := isLoopback(from)
+	if !local && n.bans.IsBanned(from) {
+		return nil, status.Error(codes.PermissionDenied, errBanned.Error())
 	}
 
+	if err := n.acceptTransaction(tx, from); err != nil {
+		if !local {
+			n.misbehaving(from, txMisbehavior(err), err)
+		}
+		return nil, rejectStatus(err)
+	}
 	return &proto.Ack{}, nil
 }
 
-const blockTime = time.Second * 5
+func (n *Node) GetMempool(ctx context.Context, _ *proto.Ack) (*proto.TxHashes, error) {
+	resp := &proto.TxHashes{}
+	for _, hash := range n.mempool.Hashes() {
+		b, _ := hex.DecodeString(hash)
+		resp.Hashes = append(resp.Hashes, b)
+	}
+	return resp, nil
+}
 
-func (n *Node) validatorLoop() {
-	n.logger.Infow("starting validator loop", "pubkey", n.PrivateKey.Public(), "blocktime", blockTime)
-	ticker := time.NewTicker(blockTime)
-	for {
+func (n *Node) GetMempoolTransaction(ctx context.Context, h *proto.TxHash) (*proto.Transaction, error) {
+	tx, ok := n.mempool.Get(hex.EncodeToString(h.Hash))
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "transaction %x is not pending", h.Hash)
+	}
+	return tx, nil
+}
 
-		<-ticker.C
+// GetSigCacheStats reports how well the signature cache saves block
+// validation from verifying signatures again.
+func (n *Node) GetSigCacheStats(ctx context.Context, _ *proto.Ack) (*proto.SigCacheStats, error) {
+	stats := n.chain.SigCacheStats()
+	return &proto.SigCacheStats{
+		Size:    int32(stats.Size),
+		Hits:    stats.Hits,
+		Misses:  stats.Misses,
+		HitRate: stats.HitRate(),
+	}, nil
+}
 
-		txx := n.mempool.Clear()
+func (n *Node) GetMempoolStats(ctx context.Context, _ *proto.Ack) (*proto.MempoolStats, error) {
+	stats := n.mempool.Stats()
+	resp := &proto.MempoolStats{
+		Count:      int32(stats.Count),
+		Bytes:      int64(stats.Bytes),
+		MinFeeRate: stats.MinFeeRate,
+	}
+	for _, b := range stats.FeeHistogram {
+		resp.FeeHistogram = append(resp.FeeHistogram, &proto.FeeRateBucket{
+			MinFeeRate: b.MinFeeRate,
+			Count:      int32(b.Count),
+			Bytes:      int64(b.Bytes),
+		})
+	}
+	return resp, nil
+}
 
-		n.logger.Debugw("creating new block", "lenTx", len(txx))
+func (n *Node) IsPending(ctx context.Context, h *proto.TxHash) (*proto.PendingStatus, error) {
+	_, ok := n.mempool.Get(hex.EncodeToString(h.Hash))
+	return &proto.PendingStatus{Pending: ok}, nil
+}
+
+// TestTransaction runs the checks a transaction submitted to
+// HandleTransaction goes through, against the chain and the mempool policy,
+// without admitting or relaying it.
+func (n *Node) TestTransaction(ctx context.Context, tx *proto.Transaction) (*proto.TestResult, error) {
+	if n.mempool.Has(tx) {
+		return &proto.TestResult{Accepted: true, Pending: true}, nil
 	}
+	fee, err := n.mempool.TestTransaction(tx, n.chain)
+	if err != nil {
+		return &proto.TestResult{
+			Reason:  rejectReason(err),
+			Message: err.Error(),
+		}, nil
+	}
+	return &proto.TestResult{Accepted: true, Fee: fee}, nil
 }
 
-func (n *Node) broadcast(msg any) error {
-	for peer := range n.peers {
-		switch v := msg.(type) {
-		case *proto.Transaction:
-			_, err := peer.HandleTransaction(context.Background(), v)
-			if err != nil {
-				return err
-			}
+// GetTransactionStatus tells whether a transaction is pending or confirmed,
+// and how deep in the chain it is buried.
+func (n *Node) GetTransactionStatus(ctx context.Context, h *proto.TxHash) (*proto.TransactionStatus, error) {
+	hash := hex.EncodeToString(h.Hash)
+	if loc, err := n.chain.GetTransactionLocation(hash); err == nil {
+		blockHash, _ := hex.DecodeString(loc.BlockHash)
+		return &proto.TransactionStatus{
+			State:         proto.TxState_CONFIRMED,
+			BlockHash:     blockHash,
+			BlockHeight:   int32(loc.Height),
+			Confirmations: int32(n.chain.Height() - loc.Height + 1),
+		}, nil
+	}
+	if _, ok := n.mempool.Get(hash); ok {
+		return &proto.TransactionStatus{State: proto.TxState_PENDING}, nil
+	}
+	return &proto.TransactionStatus{State: proto.TxState_UNKNOWN}, nil
+}
+
+// EstimateFee returns the fee per byte a transaction should pay to confirm
+// within the requested number of blocks. It is never below what the mempool
+// currently requires.
+func (n *Node) EstimateFee(ctx context.Context, req *proto.FeeEstimateRequest) (*proto.FeeEstimate, error) {
+	rate, err := n.fees.EstimateFee(int(req.TargetBlocks))
+	if errors.Is(err, ErrNoFeeEstimate) {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if min := n.mempool.MinFeeRate(); rate < min {
+		rate = min
+	}
+	return &proto.FeeEstimate{FeeRate: rate, TargetBlocks: req.TargetBlocks}, nil
+}
+
+// acceptTransaction validates tx, adds it to the mempool and relays it. A
+// transaction spending unknown outputs is kept in the orphan pool instead.
+// Once a transaction is accepted, the orphans waiting on it are retried.
+func (n *Node) acceptTransaction(tx *proto.Transaction, from string) error {
+	hash := hex.EncodeToString(types.HashTransaction(tx))
+
+	if n.mempool.Has(tx) || n.orphans.Has(hash) {
+		return nil
+	}
+	added, fee, err := n.mempool.AddTransaction(tx, n.chain)
+	if errors.Is(err, ErrMissingInput) {
+		if err := n.orphans.Add(tx, from); err != nil {
+			n.logger.Debugw("rejected orphan tx", "from", from, "hash", hash, "err", err)
+			return err
 		}
+		n.logger.Debugw("stored orphan tx", "from", from, "hash", hash)
+		return nil
 	}
+	if err != nil {
+		n.logger.Debugw("rejected tx", "from", from, "hash", hash, "err", err)
+		return err
+	}
+	if added {
+		n.trackFee(tx, fee)
+		n.logger.Debugw("Received tx", "from", from, "hash", hash, "we", n.ListenAddr)
+		n.relay(txInv(tx))
+		n.processOrphans(hash)
+	}
+
 	return nil
 }
 
-func (n *Node) addPeer(c proto.NodeClient, v *proto.Version) {
-	n.peerLock.Lock()
-	defer n.peerLock.Unlock()
+// trackFee lets the fee estimator follow tx, which just entered the mempool
+// paying fee.
+func (n *Node) trackFee(tx *proto.Transaction, fee int64) {
+	hash := hex.EncodeToString(types.HashTransaction(tx))
+	n.fees.Track(hash, float64(fee)/float64(pb.Size(tx)), n.chain.Height())
+}
+
+// processOrphans retries the orphans waiting on the transaction with the
+// given hash, which just made it into the mempool or a block.
+func (n *Node) processOrphans(parentHash string) {
+	txx, peers := n.orphans.TakeChildren(parentHash)
+	for i, tx := range txx {
+		if err := n.acceptTransaction(tx, peers[i]); err != nil {
+			n.logger.Debugw("dropped orphan tx", "hash", hex.EncodeToString(types.HashTransaction(tx)), "err", err)
+		}
+	}
+}
 
-	n.peers[c] = v
-	if len(v.PeerList) > 0 {
-		go n.bootstrapNetwork(v.PeerList)
+// peerHost returns the host of a remote address, so all connections from
+// the same machine count as one peer.
+func peerHost(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
 	}
-	n.logger.Debugw("new peer successfully connected",
-		"we", n.ListenAddr,
-		"remote node", v.ListenAddr,
-		"height", v.Height)
+	return host
+}
 
+// rejectStatus maps a transaction validation error to the gRPC status
+// returned to the submitter.
+func rejectStatus(err error) error {
+	switch {
+	case errors.Is(err, ErrInvalidSignature), errors.Is(err, ErrNotOwner), errors.Is(err, ErrInsufficientFunds),
+		errors.Is(err, ErrNoInputs), errors.Is(err, ErrNegativeAmount), errors.Is(err, ErrAmountOverflow):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrMissingInput), errors.Is(err, ErrSpentInput):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, ErrMempoolConflict):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, ErrFeeTooLow), errors.Is(err, ErrTooManyAncestors):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, ErrMempoolFull), errors.Is(err, ErrOrphanLimit):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
 }
 
-func (n *Node) deletePeer(c proto.NodeClient) {
-	n.peerLock.Lock()
-	defer n.peerLock.Unlock()
-	delete(n.peers, c)
+// rejectReason maps a transaction validation error to the reason reported
+// by TestTransaction.
+func rejectReason(err error) proto.RejectReason {
+	switch {
+	case errors.Is(err, ErrInvalidSignature), errors.Is(err, ErrNotOwner):
+		return proto.RejectReason_BAD_SIGNATURE
+	case errors.Is(err, ErrNoInputs), errors.Is(err, ErrNegativeAmount), errors.Is(err, ErrAmountOverflow):
+		return proto.RejectReason_MALFORMED
+	case errors.Is(err, ErrMissingInput):
+		return proto.RejectReason_MISSING_INPUT
+	case errors.Is(err, ErrSpentInput):
+		return proto.RejectReason_SPENT_INPUT
+	case errors.Is(err, ErrInsufficientFunds):
+		return proto.RejectReason_INSUFFICIENT_FUNDS
+	case errors.Is(err, ErrFeeTooLow):
+		return proto.RejectReason_FEE_TOO_LOW
+	case errors.Is(err, ErrMempoolConflict):
+		return proto.RejectReason_MEMPOOL_CONFLICT
+	case errors.Is(err, ErrTooManyAncestors):
+		return proto.RejectReason_TOO_MANY_ANCESTORS
+	case errors.Is(err, ErrMempoolFull):
+		return proto.RejectReason_MEMPOOL_FULL
+	default:
+		return proto.RejectReason_OTHER
+	}
 }
 
-func (n *Node) bootstrapNetwork(addrs []string) error {
+const (
+	blockTime          = time.Second * 5
+	maxBlockTxs        = 1000
+	mempoolExpiryCheck = time.Minute
+)
 
-	for _, addr := range addrs {
-		if !n.canConnectWith(addr) {
-			continue
+func (n *Node) mempoolLoop() {
+	ticker := time.NewTicker(mempoolExpiryCheck)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-n.quitch:
+			return
 		}
-		n.logger.Debugw("dialing peer", "we", n.ListenAddr, "peer", addr)
-		c, v, err := n.dialRemoteNode(addr)
-		if err != nil {
-			return err
+
+		if expired := n.mempool.Expire(time.Now()); len(expired) > 0 {
+			n.logger.Debugw("expired mempool transactions", "count", len(expired))
+		}
+		if expired := n.orphans.Expire(time.Now()); expired > 0 {
+			n.logger.Debugw("expired orphan transactions", "count", expired)
+		}
+		if expired := n.orphanBlocks.Expire(time.Now()); expired > 0 {
+			n.logger.Debugw("expired orphan blocks", "count", expired)
 		}
-		n.addPeer(c, v)
 	}
-
-	return nil
 }
 
-func (n *Node) dialRemoteNode(addr string) (proto.NodeClient, *proto.Version, error) {
+func (n *Node) validatorLoop() {
+	n.logger.Infow("starting validator loop", "pubkey", n.Signer.Public(), "blocktime", blockTime)
+	ticker := time.NewTicker(blockTime)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-n.quitch:
+			return
+		}
 
-	c, err := makeNodeClient(addr)
-	if err != nil {
-		return nil, nil, err
+		if err := n.produceBlock(); err != nil {
+			n.logger.Errorw("failed to produce block", "err", err)
+		}
 	}
+}
 
-	v, err := c.Handshake(context.Background(), n.getVersion())
+// produceBlock seals the next block and adds it to the chain.
+func (n *Node) produceBlock() error {
+	block, err := n.nextBlock()
 	if err != nil {
+		return err
+	}
+	if err := n.acceptBlock(block); err != nil {
+		// Only a block that lost the race for the tip may still be added
+		// later, one that failed on top of its parent fails again.
+		if n.isTip(block.Header.PreviousHash) {
+			n.pending = nil
+		}
+		return err
+	}
+	n.pending = nil
+	n.logger.Infow("new block", "height", block.Header.Height, "hash", hex.EncodeToString(types.HashBlock(block)))
+	return nil
+}
+
+// isTip reports whether hash is the hash of the current tip.
+func (n *Node) isTip(hash []byte) bool {
+	tip, err := n.chain.GetBlockByHeight(n.chain.Height())
+	return err == nil && bytes.Equal(hash, types.HashBlock(tip))
+}
 
-		return nil, nil, err
+// nextBlock returns the block to produce on top of the current tip. A block
+// built earlier for the same parent that was not added is proposed again
+// with the same header, since signers refuse to sign a second header for a
+// height. Its transactions are checked before it is sealed, so a pending
+// transaction that no longer fits the chain cannot get a block refused.
+func (n *Node) nextBlock() (*proto.Block, error) {
+	if n.pending == nil || !n.isTip(n.pending.Header.PreviousHash) {
+		txx := n.mempool.SelectTransactions(maxBlockTxs)
+		n.logger.Debugw("creating new block", "lenTx", len(txx))
+		if err := n.chain.CheckBlockTransactions(txx); err != nil {
+			removed := n.mempool.Revalidate(func(tx *proto.Transaction) error {
+				_, err := n.chain.CheckPendingTransaction(tx, n.mempool)
+				return err
+			})
+			return nil, fmt.Errorf("dropped %d invalid pending transactions: %w", len(removed), err)
+		}
+		block, err := n.newBlock(txx)
+		if err != nil {
+			return nil, err
+		}
+		n.pending = block
 	}
-	return c, v, nil
+	if n.pending.Signature == nil {
+		if _, err := types.SignBlockWith(n.Signer, n.pending); err != nil {
+			return nil, err
+		}
+	}
+	return n.pending, nil
 }
 
-func (n *Node) getVersion() *proto.Version {
-	return &proto.Version{
-		Version:    "v0.1",
-		Height:     0,
-		ListenAddr: n.ListenAddr,
-		PeerList:   n.getPeerList(),
+// acceptBlock adds b to the chain and announces it to the peers, followed by
+// the orphan blocks that were waiting on it.
+func (n *Node) acceptBlock(b *proto.Block) error {
+	if err := n.processBlock(b); err != nil {
+		return err
 	}
+	n.relay(blockInv(b))
+	n.processOrphanBlocks(hex.EncodeToString(types.HashBlock(b)))
+	return nil
 }
 
-func (n *Node) canConnectWith(addr string) bool {
-	if n.ListenAddr == addr {
-		return false
+// processOrphanBlocks adds the orphan blocks built on the block with the
+// given hash, and then the ones built on those.
+func (n *Node) processOrphanBlocks(parentHash string) {
+	for queue := []string{parentHash}; len(queue) > 0; queue = queue[1:] {
+		for _, b := range n.orphanBlocks.TakeChildren(queue[0]) {
+			hash := hex.EncodeToString(types.HashBlock(b))
+			if err := n.processBlock(b); err != nil {
+				n.logger.Debugw("dropped orphan block", "hash", hash, "err", err)
+				continue
+			}
+			n.relay(blockInv(b))
+			queue = append(queue, hash)
+		}
 	}
+}
 
-	connectedPeers := n.getPeerList()
+// processBlock adds b to the chain and brings the mempool in line with the
+// resulting main chain.
+func (n *Node) processBlock(b *proto.Block) error {
+	update, err := n.chain.ProcessBlock(b)
+	if err != nil {
+		return err
+	}
+	n.updateMempool(update)
+	return nil
+}
 
-	for _, connectedAddr := range connectedPeers {
-		if addr == connectedAddr {
-			return false
+// updateMempool removes the transactions confirmed by the connected blocks
+// from the mempool, together with the ones conflicting with them. On a reorg
+// the transactions of the abandoned branch that are not part of the new one
+// return to the mempool, and pending transactions left without their inputs
+// are dropped.
+func (n *Node) updateMempool(update *ChainUpdate) {
+	var (
+		confirmed = make(map[string]bool)
+		height    = n.chain.Height() - len(update.Connected)
+	)
+	for i, b := range update.Connected {
+		n.fees.ProcessBlock(height+i+1, b.Transactions)
+		n.mempool.RemoveConfirmed(b.Transactions)
+		for _, tx := range b.Transactions {
+			confirmed[hex.EncodeToString(types.HashTransaction(tx))] = true
 		}
 	}
-	return true
-}
 
-func (n *Node) getPeerList() []string {
-	n.peerLock.RLock()
-	defer n.peerLock.RUnlock()
+	if len(update.Disconnected) > 0 {
+		resurrected := 0
+		// oldest block first, so parents go back before their children
+		for i := len(update.Disconnected) - 1; i >= 0; i-- {
+			for _, tx := range update.Disconnected[i].Transactions {
+				hash := hex.EncodeToString(types.HashTransaction(tx))
+				if confirmed[hash] {
+					continue
+				}
+				added, fee, err := n.mempool.AddTransaction(tx, n.chain)
+				if err != nil {
+					n.logger.Debugw("dropped disconnected tx", "hash", hash, "err", err)
+					continue
+				}
+				if added {
+					n.trackFee(tx, fee)
+				}
+				resurrected++
+			}
+		}
+		removed := n.mempool.Revalidate(func(tx *proto.Transaction) error {
+			_, err := n.chain.CheckPendingTransaction(tx, n.mempool)
+			return err
+		})
+		n.logger.Infow("chain reorganized",
+			"disconnected", len(update.Disconnected),
+			"connected", len(update.Connected),
+			"resurrected", resurrected,
+			"removed", len(removed),
+		)
+	}
 
-	peers := []string{}
+	for _, b := range update.Connected {
+		for _, tx := range b.Transactions {
+			n.processOrphans(hex.EncodeToString(types.HashTransaction(tx)))
+		}
+	}
+}
 
-	for _, version := range n.peers {
-		peers = append(peers, version.ListenAddr)
+func (n *Node) createBlock(txx []*proto.Transaction) (*proto.Block, error) {
+	block, err := n.newBlock(txx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := types.SignBlockWith(n.Signer, block); err != nil {
+		return nil, err
 	}
-	return peers
+	return block, nil
 }
 
-func makeNodeClient(listenAddr string) (proto.NodeClient, error) {
-	c, err := grpc.Dial(listenAddr, grpc.WithInsecure())
+// newBlock builds an unsealed block with txx on top of the current tip.
+func (n *Node) newBlock(txx []*proto.Transaction) (*proto.Block, error) {
+	prevBlock, err := n.chain.GetBlockByHeight(n.chain.Height())
 	if err != nil {
 		return nil, err
 	}
-	return proto.NewNodeClient(c), nil
+	return &proto.Block{
+		Header: &proto.Header{
+			Version:      1,
+			Height:       int32(n.chain.Height() + 1),
+			PreviousHash: types.HashBlock(prevBlock),
+			TimeStamp:    time.Now().UnixNano(),
+		},
+		Transactions: txx,
+	}, nil
 }
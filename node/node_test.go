@@ -1 +1,612 @@
 package node
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/LDM-A/GoBlocker/crypto"
+	"github.com/LDM-A/GoBlocker/proto"
+	"github.com/LDM-A/GoBlocker/types"
+	"github.com/LDM-A/GoBlocker/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/golang/protobuf/proto"
+)
+
+const genesisTxHash = "8ada2924e739ee52ea194129ccc96ba93e9a87cbe465b912f381334cd7b939d0"
+
+// makeGenesisSpend returns a signed transaction spending the genesis output,
+// paying amount to a fresh address and the rest back to the genesis key.
+func makeGenesisSpend(t *testing.T, chain *Chain, amount int64) *proto.Transaction {
+	privKey := crypto.NewPrivateKeyFromSeedStr(seed)
+	prevTx, err := chain.txStore.Get(genesisTxHash)
+	require.Nil(t, err)
+
+	tx := &proto.Transaction{
+		Version: 1,
+		Inputs: []*proto.TxInput{
+			{
+				PrevTxHash:   types.HashTransaction(prevTx),
+				PrevOutIndex: 0,
+				PublicKey:    privKey.Public().Bytes(),
+			},
+		},
+		Outputs: []*proto.TxOutput{
+			{
+				Amount:  amount,
+				Address: crypto.GeneratePrivateKey().Public().Address().Bytes(),
+			},
+		},
+	}
+	tx.Inputs[0].Signature = types.SignTransaction(privKey, tx).Bytes()
+	return tx
+}
+
+// makeGenesisSpendTo is like makeGenesisSpend but pays to the address of key.
+func makeGenesisSpendTo(t *testing.T, chain *Chain, amount int64, key *crypto.PrivateKey) *proto.Transaction {
+	tx := makeGenesisSpend(t, chain, amount)
+	tx.Outputs[0].Address = key.Public().Address().Bytes()
+	tx.Inputs[0].Signature = types.SignTransaction(crypto.NewPrivateKeyFromSeedStr(seed), tx).Bytes()
+	return tx
+}
+
+func genesisBlock(t *testing.T, chain *Chain) *proto.Block {
+	b, err := chain.GetBlockByHeight(0)
+	require.Nil(t, err)
+	return b
+}
+
+// newTestNode creates a node, failing the test when cfg is invalid.
+func newTestNode(t *testing.T, cfg ServerConfig) *Node {
+	n, err := NewNode(cfg)
+	require.Nil(t, err)
+	return n
+}
+
+func testContext() context.Context {
+	return remoteContext("127.0.0.1")
+}
+
+// remoteContext is the context of an RPC call from host.
+func remoteContext(host string) context.Context {
+	return peer.NewContext(context.Background(), &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.ParseIP(host), Port: 9999},
+	})
+}
+
+func TestHandleTransactionValidates(t *testing.T) {
+	n := newTestNode(t, ServerConfig{Version: "Blocker-1"})
+
+	tx := makeGenesisSpend(t, n.chain, 400)
+	_, err := n.HandleTransaction(testContext(), tx)
+	require.Nil(t, err)
+	assert.True(t, n.mempool.Has(tx))
+
+	// resubmitting a pending transaction is fine
+	_, err = n.HandleTransaction(testContext(), tx)
+	assert.Nil(t, err)
+
+	conflicting := makeGenesisSpend(t, n.chain, 500)
+	_, err = n.HandleTransaction(testContext(), conflicting)
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	assert.False(t, n.mempool.Has(conflicting))
+
+	tooMuch := makeGenesisSpend(t, n.chain, 1001)
+	_, err = n.HandleTransaction(testContext(), tooMuch)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	badSig := makeGenesisSpend(t, n.chain, 10)
+	badSig.Outputs[0].Amount = 20
+	_, err = n.HandleTransaction(testContext(), badSig)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	privKey := crypto.GeneratePrivateKey()
+	missing := &proto.Transaction{
+		Version: 1,
+		Inputs: []*proto.TxInput{
+			{
+				PrevTxHash: util.RandomHash(),
+				PublicKey:  privKey.Public().Bytes(),
+			},
+		},
+	}
+	missing.Inputs[0].Signature = types.SignTransaction(privKey, missing).Bytes()
+	_, err = n.HandleTransaction(testContext(), missing)
+	assert.Nil(t, err)
+	assert.False(t, n.mempool.Has(missing))
+	assert.Equal(t, 1, n.orphans.Len())
+}
+
+func TestHandleTransactionReplaceByFee(t *testing.T) {
+	n := newTestNode(t, ServerConfig{Version: "Blocker-1"})
+
+	original := makeGenesisSpend(t, n.chain, 400)
+	_, err := n.HandleTransaction(testContext(), original)
+	require.Nil(t, err)
+
+	bumped := makeGenesisSpend(t, n.chain, 200)
+	_, err = n.HandleTransaction(testContext(), bumped)
+	require.Nil(t, err)
+	assert.False(t, n.mempool.Has(original))
+	assert.True(t, n.mempool.Has(bumped))
+	assert.NotContains(t, n.fees.tracked, hex.EncodeToString(types.HashTransaction(original)))
+	assert.Contains(t, n.fees.tracked, hex.EncodeToString(types.HashTransaction(bumped)))
+}
+
+func TestHandleTransactionSpendsPendingOutput(t *testing.T) {
+	var (
+		privKey = crypto.NewPrivateKeyFromSeedStr(seed)
+		n       = newTestNode(t, ServerConfig{Version: "Blocker-1", PrivateKey: privKey})
+		parent  = makeGenesisSpend(t, n.chain, 800)
+	)
+	// send the payment back to the genesis key so it can spend it again
+	parent.Outputs[0].Address = privKey.Public().Address().Bytes()
+	parent.Inputs[0].Signature = types.SignTransaction(privKey, parent).Bytes()
+
+	child := &proto.Transaction{
+		Version: 1,
+		Inputs: []*proto.TxInput{
+			{
+				PrevTxHash:   types.HashTransaction(parent),
+				PrevOutIndex: 0,
+				PublicKey:    privKey.Public().Bytes(),
+			},
+		},
+		Outputs: []*proto.TxOutput{{Amount: 500, Address: privKey.Public().Address().Bytes()}},
+	}
+	child.Inputs[0].Signature = types.SignTransaction(privKey, child).Bytes()
+
+	// the child arrives first and waits in the orphan pool for its parent
+	_, err := n.HandleTransaction(testContext(), child)
+	require.Nil(t, err)
+	assert.Equal(t, 1, n.orphans.Len())
+	assert.False(t, n.mempool.Has(child))
+
+	_, err = n.HandleTransaction(testContext(), parent)
+	require.Nil(t, err)
+	assert.Equal(t, 0, n.orphans.Len())
+	assert.True(t, n.mempool.Has(child))
+
+	txx := n.mempool.SelectTransactions(maxBlockTxs)
+	assert.Equal(t, []*proto.Transaction{parent, child}, txx)
+
+	block, err := n.createBlock(txx)
+	require.Nil(t, err)
+	require.Nil(t, n.chain.AddBlock(block))
+	n.mempool.RemoveConfirmed(block.Transactions)
+	assert.Equal(t, 0, len(n.mempool.txx))
+}
+
+// countingSigner counts the headers it signs.
+type countingSigner struct {
+	types.Signer
+	signed int
+}
+
+func (s *countingSigner) SignHeader(h *proto.Header) (*crypto.Signature, error) {
+	s.signed++
+	return s.Signer.SignHeader(h)
+}
+
+func TestNextBlockReusesPendingBlock(t *testing.T) {
+	var (
+		signer = &countingSigner{Signer: types.NewLocalSigner(crypto.GeneratePrivateKey())}
+		n      = newTestNode(t, ServerConfig{Version: "Blocker-1", Signer: signer})
+	)
+	block, err := n.nextBlock()
+	require.Nil(t, err)
+
+	// the block was not added, so the same header is proposed again without
+	// asking the signer for a second one at that height
+	again, err := n.nextBlock()
+	require.Nil(t, err)
+	assert.Equal(t, block, again)
+	assert.Equal(t, 1, signer.signed)
+
+	require.Nil(t, n.chain.AddBlock(block))
+	next, err := n.nextBlock()
+	require.Nil(t, err)
+	assert.Equal(t, block.Header.Height+1, next.Header.Height)
+	assert.Equal(t, 2, signer.signed)
+}
+
+// lossySigner signs every header but loses the first reply.
+type lossySigner struct {
+	types.Signer
+	signed [][]byte
+}
+
+func (s *lossySigner) SignHeader(h *proto.Header) (*crypto.Signature, error) {
+	sig, err := s.Signer.SignHeader(h)
+	s.signed = append(s.signed, types.HashHeader(h))
+	if len(s.signed) == 1 {
+		return nil, errors.New("reply lost")
+	}
+	return sig, err
+}
+
+func TestNextBlockResendsHeaderAfterLostSignature(t *testing.T) {
+	var (
+		signer = &lossySigner{Signer: types.NewLocalSigner(crypto.GeneratePrivateKey())}
+		n      = newTestNode(t, ServerConfig{Version: "Blocker-1", Signer: signer})
+	)
+	_, err := n.nextBlock()
+	require.NotNil(t, err)
+
+	block, err := n.nextBlock()
+	require.Nil(t, err)
+	require.Equal(t, 2, len(signer.signed))
+	assert.Equal(t, signer.signed[0], signer.signed[1])
+	assert.Equal(t, signer.signed[0], types.HashHeader(block.Header))
+}
+
+// invalidSpend returns a signed transaction spending an output the genesis
+// transaction does not have.
+func invalidSpend(t *testing.T, chain *Chain) *proto.Transaction {
+	tx := makeGenesisSpend(t, chain, 100)
+	tx.Inputs[0].PrevOutIndex = 5
+	tx.Inputs[0].Signature = types.SignTransaction(crypto.NewPrivateKeyFromSeedStr(seed), tx).Bytes()
+	return tx
+}
+
+func TestNextBlockDropsInvalidPendingTransactions(t *testing.T) {
+	n := newTestNode(t, ServerConfig{Version: "Blocker-1", PrivateKey: crypto.GeneratePrivateKey()})
+	_, err := n.mempool.Add(invalidSpend(t, n.chain), 1000)
+	require.Nil(t, err)
+
+	_, err = n.nextBlock()
+	assert.True(t, errors.Is(err, ErrMissingInput))
+	assert.Equal(t, 0, n.mempool.Len())
+
+	block, err := n.nextBlock()
+	require.Nil(t, err)
+	assert.Nil(t, n.acceptBlock(block))
+}
+
+func TestProduceBlockDropsInvalidBlock(t *testing.T) {
+	n := newTestNode(t, ServerConfig{Version: "Blocker-1", PrivateKey: crypto.GeneratePrivateKey()})
+	block, err := n.createBlock([]*proto.Transaction{invalidSpend(t, n.chain)})
+	require.Nil(t, err)
+	n.pending = block
+
+	assert.NotNil(t, n.produceBlock())
+	assert.Nil(t, n.pending)
+	assert.Nil(t, n.produceBlock())
+	assert.Equal(t, 1, n.chain.Height())
+}
+
+func TestMempoolPersistence(t *testing.T) {
+	var (
+		file    = filepath.Join(t.TempDir(), "mempool.dat")
+		privKey = crypto.NewPrivateKeyFromSeedStr(seed)
+		n       = newTestNode(t, ServerConfig{Version: "Blocker-1", MempoolFile: file})
+		tx      = makeGenesisSpend(t, n.chain, 400)
+	)
+	_, err := n.HandleTransaction(testContext(), tx)
+	require.Nil(t, err)
+	require.Nil(t, n.Stop())
+
+	restarted := newTestNode(t, ServerConfig{Version: "Blocker-1", MempoolFile: file})
+	require.Nil(t, restarted.loadMempool())
+	assert.True(t, restarted.mempool.Has(tx))
+	assert.Contains(t, restarted.fees.tracked, hex.EncodeToString(types.HashTransaction(tx)))
+
+	// the genesis output got spent by another transaction while we were down
+	moved := newTestNode(t, ServerConfig{Version: "Blocker-1", MempoolFile: file})
+	block := RandomBlock(t, moved.chain)
+	block.Transactions = append(block.Transactions, makeGenesisSpend(t, moved.chain, 100))
+	types.SignBlock(privKey, block)
+	require.Nil(t, moved.chain.AddBlock(block))
+
+	require.Nil(t, moved.loadMempool())
+	assert.False(t, moved.mempool.Has(tx))
+}
+
+func TestChainPersistence(t *testing.T) {
+	var (
+		dir     = t.TempDir()
+		cfg     = ServerConfig{Version: "Blocker-1", ChainFile: filepath.Join(dir, "chain.dat"), MempoolFile: filepath.Join(dir, "mempool.dat")}
+		n       = newTestNode(t, cfg)
+		privKey = crypto.GeneratePrivateKey()
+		spend   = makeGenesisSpendTo(t, n.chain, 800, privKey)
+		child   = &proto.Transaction{
+			Version: 1,
+			Inputs: []*proto.TxInput{
+				{
+					PrevTxHash:   types.HashTransaction(spend),
+					PrevOutIndex: 0,
+					PublicKey:    privKey.Public().Bytes(),
+				},
+			},
+			Outputs: []*proto.TxOutput{{Amount: 500, Address: privKey.Public().Address().Bytes()}},
+		}
+	)
+	child.Inputs[0].Signature = types.SignTransaction(privKey, child).Bytes()
+
+	require.Nil(t, n.processBlock(blockOn(genesisBlock(t, n.chain), spend)))
+	_, err := n.HandleTransaction(testContext(), child)
+	require.Nil(t, err)
+	require.Nil(t, n.Stop())
+	// stopping twice is harmless
+	require.Nil(t, n.Stop())
+
+	// the pending child spends an output of a block of the last run
+	restarted := newTestNode(t, cfg)
+	require.Nil(t, restarted.loadChain())
+	require.Nil(t, restarted.loadMempool())
+	assert.Equal(t, 1, restarted.chain.Height())
+	assert.True(t, restarted.mempool.Has(child))
+}
+
+func TestStopSavesEverythingDespiteErrors(t *testing.T) {
+	var (
+		dir = t.TempDir()
+		cfg = ServerConfig{
+			Version:          "Blocker-1",
+			ChainFile:        filepath.Join(dir, "missing", "chain.dat"),
+			FeeEstimatesFile: filepath.Join(dir, "fees.dat"),
+			AddressBookFile:  filepath.Join(dir, "missing", "addrs.dat"),
+			BanListFile:      filepath.Join(dir, "bans.dat"),
+			MempoolFile:      filepath.Join(dir, "mempool.dat"),
+		}
+		n = newTestNode(t, cfg)
+	)
+	err := n.Stop()
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "chain.dat")
+	assert.Contains(t, err.Error(), "addrs.dat")
+	for _, file := range []string{cfg.FeeEstimatesFile, cfg.BanListFile, cfg.MempoolFile} {
+		_, err := os.Stat(file)
+		assert.Nil(t, err, file)
+	}
+}
+
+func TestReorgResurrectsTransactions(t *testing.T) {
+	var (
+		n          = newTestNode(t, ServerConfig{Version: "Blocker-1"})
+		genesis, _ = n.chain.GetBlockByHeight(0)
+		privKey    = crypto.GeneratePrivateKey()
+		spend      = makeGenesisSpendTo(t, n.chain, 400, privKey)
+		child      = &proto.Transaction{
+			Version: 1,
+			Inputs: []*proto.TxInput{
+				{
+					PrevTxHash:   types.HashTransaction(spend),
+					PrevOutIndex: 0,
+					PublicKey:    privKey.Public().Bytes(),
+				},
+			},
+			Outputs: []*proto.TxOutput{{Amount: 100, Address: privKey.Public().Address().Bytes()}},
+		}
+		b1 = blockOn(genesis)
+	)
+	child.Inputs[0].Signature = types.SignTransaction(privKey, child).Bytes()
+
+	require.Nil(t, n.processBlock(blockOn(genesis, spend)))
+	_, err := n.HandleTransaction(testContext(), child)
+	require.Nil(t, err)
+
+	require.Nil(t, n.processBlock(b1))
+	require.Nil(t, n.processBlock(blockOn(b1)))
+	assert.True(t, n.mempool.Has(spend))
+	assert.True(t, n.mempool.Has(child))
+	assert.Contains(t, n.fees.tracked, hex.EncodeToString(types.HashTransaction(spend)))
+	assert.Equal(t, []*proto.Transaction{spend, child}, n.mempool.SelectTransactions(maxBlockTxs))
+}
+
+func TestReorgRemovesConflicts(t *testing.T) {
+	var (
+		n          = newTestNode(t, ServerConfig{Version: "Blocker-1"})
+		genesis, _ = n.chain.GetBlockByHeight(0)
+		privKey    = crypto.GeneratePrivateKey()
+		spend      = makeGenesisSpendTo(t, n.chain, 400, privKey)
+		double     = makeGenesisSpend(t, n.chain, 300)
+		child      = &proto.Transaction{
+			Version: 1,
+			Inputs: []*proto.TxInput{
+				{
+					PrevTxHash:   types.HashTransaction(spend),
+					PrevOutIndex: 0,
+					PublicKey:    privKey.Public().Bytes(),
+				},
+			},
+			Outputs: []*proto.TxOutput{{Amount: 100, Address: privKey.Public().Address().Bytes()}},
+		}
+		b1 = blockOn(genesis, double)
+	)
+	child.Inputs[0].Signature = types.SignTransaction(privKey, child).Bytes()
+
+	require.Nil(t, n.processBlock(blockOn(genesis, spend)))
+	_, err := n.HandleTransaction(testContext(), child)
+	require.Nil(t, err)
+
+	// the new branch spends the genesis output differently, so neither spend
+	// nor its pending child survive
+	require.Nil(t, n.processBlock(b1))
+	require.Nil(t, n.processBlock(blockOn(b1)))
+	assert.False(t, n.mempool.Has(spend))
+	assert.False(t, n.mempool.Has(child))
+	assert.Equal(t, 0, len(n.mempool.txx))
+}
+
+func TestMempoolQueries(t *testing.T) {
+	var (
+		n    = newTestNode(t, ServerConfig{Version: "Blocker-1"})
+		tx   = makeGenesisSpend(t, n.chain, 400)
+		hash = types.HashTransaction(tx)
+		ctx  = context.Background()
+	)
+	_, err := n.HandleTransaction(testContext(), tx)
+	require.Nil(t, err)
+
+	hashes, err := n.GetMempool(ctx, &proto.Ack{})
+	require.Nil(t, err)
+	assert.Equal(t, [][]byte{hash}, hashes.Hashes)
+
+	got, err := n.GetMempoolTransaction(ctx, &proto.TxHash{Hash: hash})
+	require.Nil(t, err)
+	assert.Equal(t, tx, got)
+	_, err = n.GetMempoolTransaction(ctx, &proto.TxHash{Hash: util.RandomHash()})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	pending, err := n.IsPending(ctx, &proto.TxHash{Hash: hash})
+	require.Nil(t, err)
+	assert.True(t, pending.Pending)
+	pending, err = n.IsPending(ctx, &proto.TxHash{Hash: util.RandomHash()})
+	require.Nil(t, err)
+	assert.False(t, pending.Pending)
+
+	stats, err := n.GetMempoolStats(ctx, &proto.Ack{})
+	require.Nil(t, err)
+	assert.Equal(t, int32(1), stats.Count)
+	assert.Equal(t, int64(pb.Size(tx)), stats.Bytes)
+	assert.Equal(t, len(feeHistogramBounds), len(stats.FeeHistogram))
+}
+
+func TestGetSigCacheStats(t *testing.T) {
+	var (
+		n       = newTestNode(t, ServerConfig{Version: "Blocker-1"})
+		privKey = crypto.NewPrivateKeyFromSeedStr(seed)
+		tx      = makeGenesisSpend(t, n.chain, 400)
+	)
+	_, err := n.HandleTransaction(testContext(), tx)
+	require.Nil(t, err)
+
+	block := RandomBlock(t, n.chain)
+	block.Transactions = append(block.Transactions, tx)
+	types.SignBlock(privKey, block)
+	require.Nil(t, n.processBlock(block))
+
+	stats, err := n.GetSigCacheStats(context.Background(), &proto.Ack{})
+	require.Nil(t, err)
+	assert.Equal(t, uint64(1), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.Equal(t, 0.5, stats.HitRate)
+}
+
+func TestTestTransaction(t *testing.T) {
+	var (
+		cfg = MempoolConfig{MaxTxs: 10, MinRelayFeeRate: 1}
+		n   = newTestNode(t, ServerConfig{Version: "Blocker-1", Mempool: cfg})
+		ctx = context.Background()
+		tx  = makeGenesisSpend(t, n.chain, 400)
+	)
+	badSig := makeGenesisSpend(t, n.chain, 10)
+	badSig.Outputs[0].Amount = 20
+	privKey := crypto.GeneratePrivateKey()
+	missing := &proto.Transaction{
+		Version: 1,
+		Inputs:  []*proto.TxInput{{PrevTxHash: util.RandomHash(), PublicKey: privKey.Public().Bytes()}},
+	}
+	missing.Inputs[0].Signature = types.SignTransaction(privKey, missing).Bytes()
+
+	result, err := n.TestTransaction(ctx, tx)
+	require.Nil(t, err)
+	assert.True(t, result.Accepted)
+	assert.Equal(t, int64(600), result.Fee)
+	// nothing is admitted
+	assert.False(t, n.mempool.Has(tx))
+
+	for _, c := range []struct {
+		tx     *proto.Transaction
+		reason proto.RejectReason
+	}{
+		{badSig, proto.RejectReason_BAD_SIGNATURE},
+		{missing, proto.RejectReason_MISSING_INPUT},
+		{makeGenesisSpend(t, n.chain, 1001), proto.RejectReason_INSUFFICIENT_FUNDS},
+		{makeGenesisSpend(t, n.chain, 999), proto.RejectReason_FEE_TOO_LOW},
+	} {
+		result, err := n.TestTransaction(ctx, c.tx)
+		require.Nil(t, err)
+		assert.False(t, result.Accepted)
+		assert.Equal(t, c.reason, result.Reason, result.Message)
+	}
+	assert.Equal(t, 0, n.orphans.Len())
+
+	_, err = n.HandleTransaction(testContext(), tx)
+	require.Nil(t, err)
+	result, err = n.TestTransaction(ctx, tx)
+	require.Nil(t, err)
+	assert.True(t, result.Accepted)
+	assert.True(t, result.Pending)
+	result, err = n.TestTransaction(ctx, makeGenesisSpend(t, n.chain, 500))
+	require.Nil(t, err)
+	assert.Equal(t, proto.RejectReason_MEMPOOL_CONFLICT, result.Reason)
+	assert.Equal(t, 1, n.mempool.Len())
+
+	require.Nil(t, n.processBlock(blockOn(genesisBlock(t, n.chain), tx)))
+	result, err = n.TestTransaction(ctx, makeGenesisSpend(t, n.chain, 500))
+	require.Nil(t, err)
+	assert.Equal(t, proto.RejectReason_SPENT_INPUT, result.Reason)
+}
+
+func TestGetTransactionStatus(t *testing.T) {
+	var (
+		n       = newTestNode(t, ServerConfig{Version: "Blocker-1"})
+		ctx     = context.Background()
+		genesis = genesisBlock(t, n.chain)
+		tx      = makeGenesisSpend(t, n.chain, 400)
+		hash    = &proto.TxHash{Hash: types.HashTransaction(tx)}
+		a1      = blockOn(genesis, tx)
+		b1      = blockOn(genesis)
+	)
+	txStatus, err := n.GetTransactionStatus(ctx, hash)
+	require.Nil(t, err)
+	assert.Equal(t, proto.TxState_UNKNOWN, txStatus.State)
+
+	_, err = n.HandleTransaction(testContext(), tx)
+	require.Nil(t, err)
+	txStatus, err = n.GetTransactionStatus(ctx, hash)
+	require.Nil(t, err)
+	assert.Equal(t, proto.TxState_PENDING, txStatus.State)
+
+	require.Nil(t, n.processBlock(a1))
+	txStatus, err = n.GetTransactionStatus(ctx, hash)
+	require.Nil(t, err)
+	assert.Equal(t, proto.TxState_CONFIRMED, txStatus.State)
+	assert.Equal(t, types.HashBlock(a1), txStatus.BlockHash)
+	assert.Equal(t, int32(1), txStatus.BlockHeight)
+	assert.Equal(t, int32(1), txStatus.Confirmations)
+
+	require.Nil(t, n.processBlock(blockOn(a1)))
+	txStatus, err = n.GetTransactionStatus(ctx, hash)
+	require.Nil(t, err)
+	assert.Equal(t, int32(2), txStatus.Confirmations)
+
+	// once its block is reorganized away the transaction is pending again
+	require.Nil(t, n.processBlock(b1))
+	b2 := blockOn(b1)
+	require.Nil(t, n.processBlock(b2))
+	require.Nil(t, n.processBlock(blockOn(b2)))
+	txStatus, err = n.GetTransactionStatus(ctx, hash)
+	require.Nil(t, err)
+	assert.Equal(t, proto.TxState_PENDING, txStatus.State)
+}
+
+func TestEstimateFee(t *testing.T) {
+	var (
+		n   = newTestNode(t, ServerConfig{Version: "Blocker-1"})
+		ctx = context.Background()
+	)
+	_, err := n.EstimateFee(ctx, &proto.FeeEstimateRequest{TargetBlocks: 2})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	_, err = n.EstimateFee(ctx, &proto.FeeEstimateRequest{TargetBlocks: 0})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	for height := 0; height < 10; height++ {
+		n.fees.ProcessBlock(height+1, trackConfirmed(n.fees, 1, 4, height))
+	}
+	estimate, err := n.EstimateFee(ctx, &proto.FeeEstimateRequest{TargetBlocks: 2})
+	require.Nil(t, err)
+	assert.Equal(t, n.fees.bounds[n.fees.bucket(4)], estimate.FeeRate)
+	assert.Equal(t, int32(2), estimate.TargetBlocks)
+}
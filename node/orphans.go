@@ -0,0 +1,273 @@
+package node
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/LDM-A/GoBlocker/proto"
+	"github.com/LDM-A/GoBlocker/types"
+
+	pb "github.com/golang/protobuf/proto"
+)
+
+const (
+	maxOrphans        = 100
+	maxOrphansPerPeer = 10
+	maxOrphanSize     = 100_000
+	orphanMaxAge      = time.Minute * 20
+	// maxOrphanBlocks bounds the blocks kept while their ancestors are
+	// fetched, which is how far a node catches up in one go.
+	maxOrphanBlocks = 500
+)
+
+var ErrOrphanLimit = errors.New("orphan limit reached")
+
+type orphanEntry struct {
+	tx    *proto.Transaction
+	hash  string
+	peer  string
+	added time.Time
+}
+
+// OrphanPool holds transactions spending outputs we have not seen yet until
+// their parents show up in the mempool or in a block.
+type OrphanPool struct {
+	lock    sync.Mutex
+	orphans map[string]*orphanEntry
+	// byParent maps the hash of a missing parent to the orphans waiting on it.
+	byParent map[string]map[string]bool
+	perPeer  map[string]int
+}
+
+func NewOrphanPool() *OrphanPool {
+	return &OrphanPool{
+		orphans:  make(map[string]*orphanEntry),
+		byParent: make(map[string]map[string]bool),
+		perPeer:  make(map[string]int),
+	}
+}
+
+func (p *OrphanPool) Len() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return len(p.orphans)
+}
+
+func (p *OrphanPool) Has(hash string) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	_, ok := p.orphans[hash]
+	return ok
+}
+
+// Add stores tx received from peer. Each peer may only have a handful of
+// orphans pending, and when the pool is full the oldest orphan makes room.
+func (p *OrphanPool) Add(tx *proto.Transaction, peer string) error {
+	if size := pb.Size(tx); size > maxOrphanSize {
+		return fmt.Errorf("%w: orphan of %d bytes too large", ErrOrphanLimit, size)
+	}
+	hash := hex.EncodeToString(types.HashTransaction(tx))
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if _, ok := p.orphans[hash]; ok {
+		return nil
+	}
+	if p.perPeer[peer] >= maxOrphansPerPeer {
+		return fmt.Errorf("%w: peer %s has %d orphans", ErrOrphanLimit, peer, p.perPeer[peer])
+	}
+	if len(p.orphans) >= maxOrphans {
+		var oldest *orphanEntry
+		for _, e := range p.orphans {
+			if oldest == nil || e.added.Before(oldest.added) {
+				oldest = e
+			}
+		}
+		p.remove(oldest.hash)
+	}
+
+	e := &orphanEntry{
+		tx:    tx,
+		hash:  hash,
+		peer:  peer,
+		added: time.Now(),
+	}
+	p.orphans[hash] = e
+	p.perPeer[peer]++
+	for _, input := range tx.Inputs {
+		parent := hex.EncodeToString(input.PrevTxHash)
+		if p.byParent[parent] == nil {
+			p.byParent[parent] = make(map[string]bool)
+		}
+		p.byParent[parent][hash] = true
+	}
+	return nil
+}
+
+// TakeChildren removes and returns the orphans spending outputs of the
+// transaction with the given hash, along with the peers they came from.
+func (p *OrphanPool) TakeChildren(parentHash string) ([]*proto.Transaction, []string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var (
+		txx   = []*proto.Transaction{}
+		peers = []string{}
+	)
+	for hash := range p.byParent[parentHash] {
+		e := p.orphans[hash]
+		txx = append(txx, e.tx)
+		peers = append(peers, e.peer)
+		p.remove(hash)
+	}
+	return txx, peers
+}
+
+// Expire drops orphans older than the maximum orphan age and returns how many
+// were dropped.
+func (p *OrphanPool) Expire(now time.Time) int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	expired := 0
+	for hash, e := range p.orphans {
+		if now.Sub(e.added) > orphanMaxAge {
+			p.remove(hash)
+			expired++
+		}
+	}
+	return expired
+}
+
+func (p *OrphanPool) remove(hash string) {
+	e, ok := p.orphans[hash]
+	if !ok {
+		return
+	}
+	delete(p.orphans, hash)
+	if p.perPeer[e.peer]--; p.perPeer[e.peer] <= 0 {
+		delete(p.perPeer, e.peer)
+	}
+	for _, input := range e.tx.Inputs {
+		parent := hex.EncodeToString(input.PrevTxHash)
+		delete(p.byParent[parent], hash)
+		if len(p.byParent[parent]) == 0 {
+			delete(p.byParent, parent)
+		}
+	}
+}
+
+type orphanBlock struct {
+	block  *proto.Block
+	hash   string
+	parent string
+	added  time.Time
+}
+
+// OrphanBlockPool holds blocks whose parent we have not seen yet until the
+// parent is added to the chain.
+type OrphanBlockPool struct {
+	lock   sync.Mutex
+	blocks map[string]*orphanBlock
+	// byParent maps the hash of a missing parent to the blocks built on it.
+	byParent map[string]map[string]bool
+}
+
+func NewOrphanBlockPool() *OrphanBlockPool {
+	return &OrphanBlockPool{
+		blocks:   make(map[string]*orphanBlock),
+		byParent: make(map[string]map[string]bool),
+	}
+}
+
+func (p *OrphanBlockPool) Len() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return len(p.blocks)
+}
+
+func (p *OrphanBlockPool) Has(hash string) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	_, ok := p.blocks[hash]
+	return ok
+}
+
+// Add stores b. When the pool is full the oldest block makes room.
+func (p *OrphanBlockPool) Add(b *proto.Block) {
+	hash := hex.EncodeToString(types.HashBlock(b))
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if _, ok := p.blocks[hash]; ok {
+		return
+	}
+	if len(p.blocks) >= maxOrphanBlocks {
+		var oldest *orphanBlock
+		for _, e := range p.blocks {
+			if oldest == nil || e.added.Before(oldest.added) {
+				oldest = e
+			}
+		}
+		p.remove(oldest.hash)
+	}
+
+	e := &orphanBlock{
+		block:  b,
+		hash:   hash,
+		parent: hex.EncodeToString(b.Header.PreviousHash),
+		added:  time.Now(),
+	}
+	p.blocks[hash] = e
+	if p.byParent[e.parent] == nil {
+		p.byParent[e.parent] = make(map[string]bool)
+	}
+	p.byParent[e.parent][hash] = true
+}
+
+// TakeChildren removes and returns the blocks built on the block with the
+// given hash.
+func (p *OrphanBlockPool) TakeChildren(parentHash string) []*proto.Block {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	blocks := []*proto.Block{}
+	for hash := range p.byParent[parentHash] {
+		blocks = append(blocks, p.blocks[hash].block)
+		p.remove(hash)
+	}
+	return blocks
+}
+
+// Expire drops blocks older than the maximum orphan age and returns how many
+// were dropped.
+func (p *OrphanBlockPool) Expire(now time.Time) int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	expired := 0
+	for hash, e := range p.blocks {
+		if now.Sub(e.added) > orphanMaxAge {
+			p.remove(hash)
+			expired++
+		}
+	}
+	return expired
+}
+
+func (p *OrphanBlockPool) remove(hash string) {
+	e, ok := p.blocks[hash]
+	if !ok {
+		return
+	}
+	delete(p.blocks, hash)
+	delete(p.byParent[e.parent], hash)
+	if len(p.byParent[e.parent]) == 0 {
+		delete(p.byParent, e.parent)
+	}
+}
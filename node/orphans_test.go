@@ -0,0 +1,111 @@
+package node
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/LDM-A/GoBlocker/proto"
+	"github.com/LDM-A/GoBlocker/types"
+	"github.com/LDM-A/GoBlocker/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrphanPoolTakeChildren(t *testing.T) {
+	var (
+		pool   = NewOrphanPool()
+		parent = randomPoolTx()
+		child1 = spendingTx(parent, 0, 1)
+		child2 = spendingTx(parent, 1, 1)
+		other  = spendingTx(randomPoolTx(), 0, 1)
+	)
+	for _, tx := range []*proto.Transaction{child1, child2, other} {
+		require.Nil(t, pool.Add(tx, "peer"))
+	}
+	require.Nil(t, pool.Add(child1, "peer"))
+	assert.Equal(t, 3, pool.Len())
+
+	txx, peers := pool.TakeChildren(hex.EncodeToString(types.HashTransaction(parent)))
+	assert.ElementsMatch(t, []*proto.Transaction{child1, child2}, txx)
+	assert.Equal(t, []string{"peer", "peer"}, peers)
+	assert.Equal(t, 1, pool.Len())
+	assert.Equal(t, 1, pool.perPeer["peer"])
+	assert.Equal(t, 1, len(pool.byParent))
+}
+
+func TestOrphanPoolLimits(t *testing.T) {
+	pool := NewOrphanPool()
+	for i := 0; i < maxOrphansPerPeer; i++ {
+		require.Nil(t, pool.Add(spendingTx(randomPoolTx(), 0, 1), "greedy"))
+	}
+	err := pool.Add(spendingTx(randomPoolTx(), 0, 1), "greedy")
+	assert.True(t, errors.Is(err, ErrOrphanLimit))
+
+	for i := 0; pool.Len() < maxOrphans; i++ {
+		peer := fmt.Sprintf("peer-%d", i/maxOrphansPerPeer)
+		require.Nil(t, pool.Add(spendingTx(randomPoolTx(), 0, 1), peer))
+	}
+
+	// a full pool drops its oldest orphan to make room
+	oldest := pool.orphans[hex.EncodeToString(types.HashTransaction(randomOrphan(pool)))]
+	oldest.added = time.Now().Add(-time.Minute)
+	require.Nil(t, pool.Add(spendingTx(randomPoolTx(), 0, 1), "newcomer"))
+	assert.Equal(t, maxOrphans, pool.Len())
+	assert.False(t, pool.Has(oldest.hash))
+}
+
+func randomOrphan(pool *OrphanPool) *proto.Transaction {
+	for _, e := range pool.orphans {
+		return e.tx
+	}
+	return nil
+}
+
+func TestOrphanPoolExpire(t *testing.T) {
+	var (
+		pool  = NewOrphanPool()
+		old   = spendingTx(randomPoolTx(), 0, 1)
+		fresh = spendingTx(randomPoolTx(), 0, 1)
+	)
+	require.Nil(t, pool.Add(old, "peer"))
+	require.Nil(t, pool.Add(fresh, "peer"))
+	pool.orphans[hex.EncodeToString(types.HashTransaction(old))].added = time.Now().Add(-orphanMaxAge * 2)
+
+	assert.Equal(t, 1, pool.Expire(time.Now()))
+	assert.Equal(t, 1, pool.Len())
+	assert.True(t, pool.Has(hex.EncodeToString(types.HashTransaction(fresh))))
+}
+
+func TestOrphanBlockPool(t *testing.T) {
+	var (
+		pool   = NewOrphanBlockPool()
+		parent = util.RandomBlock()
+		child1 = blockOn(parent)
+		child2 = blockOn(parent)
+		other  = blockOn(util.RandomBlock())
+	)
+	for _, b := range []*proto.Block{child1, child2, other, child1} {
+		pool.Add(b)
+	}
+	assert.Equal(t, 3, pool.Len())
+
+	blocks := pool.TakeChildren(hex.EncodeToString(types.HashBlock(parent)))
+	assert.ElementsMatch(t, []*proto.Block{child1, child2}, blocks)
+	assert.Equal(t, 1, pool.Len())
+	assert.Equal(t, 1, len(pool.byParent))
+
+	for pool.Len() < maxOrphanBlocks {
+		pool.Add(blockOn(util.RandomBlock()))
+	}
+	// a full pool drops its oldest block to make room
+	pool.blocks[hex.EncodeToString(types.HashBlock(other))].added = time.Now().Add(-time.Minute)
+	pool.Add(blockOn(util.RandomBlock()))
+	assert.Equal(t, maxOrphanBlocks, pool.Len())
+	assert.False(t, pool.Has(hex.EncodeToString(types.HashBlock(other))))
+
+	assert.Equal(t, maxOrphanBlocks, pool.Expire(time.Now().Add(orphanMaxAge+time.Second)))
+	assert.Equal(t, 0, len(pool.byParent))
+}
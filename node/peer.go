@@ -0,0 +1,714 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/LDM-A/GoBlocker/crypto"
+	"github.com/LDM-A/GoBlocker/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// maxFailedPings is the number of consecutive unanswered pings after
+	// which a peer is considered dead and dropped.
+	maxFailedPings = 3
+	// sendQueueSize is the number of messages waiting for delivery to a
+	// single peer. Messages to a peer whose queue is full are dropped.
+	sendQueueSize = 256
+)
+
+type peerTimers struct {
+	// pingInterval is how often every peer is pinged. A ping still
+	// unanswered when the next one is due counts as failed.
+	pingInterval time.Duration
+	// handshakeTimeout is how long a new connection may take to exchange
+	// versions.
+	handshakeTimeout time.Duration
+	// reconnectMinDelay and reconnectMaxDelay bound the exponential backoff
+	// between attempts to reconnect to a bootstrap peer.
+	reconnectMinDelay time.Duration
+	reconnectMaxDelay time.Duration
+	// sendTimeout bounds the delivery of a single message to a peer. A peer
+	// that does not take it in time is dropped.
+	sendTimeout time.Duration
+	// addrInterval is how often peers are asked for addresses of other
+	// nodes.
+	addrInterval time.Duration
+}
+
+func defaultPeerTimers() peerTimers {
+	return peerTimers{
+		pingInterval:      time.Second * 10,
+		handshakeTimeout:  time.Second * 5,
+		reconnectMinDelay: time.Second,
+		reconnectMaxDelay: time.Minute * 5,
+		sendTimeout:       time.Second * 5,
+		addrInterval:      time.Minute * 2,
+	}
+}
+
+var (
+	errHandshakeTimeout = errors.New("handshake timed out")
+	errSendTimeout      = errors.New("send timed out")
+)
+
+// peerStream is either end of a Connect stream.
+type peerStream interface {
+	Send(*proto.PeerMessage) error
+	Recv() (*proto.PeerMessage, error)
+}
+
+type remotePeer struct {
+	stream  peerStream
+	version *proto.Version
+	inbound bool
+	// features are the features both sides support.
+	features uint64
+	// host is the address the connection comes from or goes to, as opposed
+	// to the listen address the peer claims in its version.
+	host string
+	// dialAddr is the address we dialed, empty for inbound peers.
+	dialAddr string
+	// conn and cancel belong to the stream of an outbound connection.
+	conn   *grpc.ClientConn
+	cancel context.CancelFunc
+
+	// pingNonce is the nonce of the last ping while it is unanswered.
+	// failedPings counts the consecutive pings the peer did not answer.
+	pingNonce   int64
+	failedPings int
+	lastSeen    time.Time
+	known       *knownInventory
+	connectedAt time.Time
+	// lastUseful is when the peer last sent us a transaction or block we
+	// did not have.
+	lastUseful time.Time
+	// requested holds the items being fetched from the peer, guarded by the
+	// requestLock of the node.
+	requested map[string]bool
+
+	// sendq holds the messages waiting to be delivered by sendLoop.
+	sendq     chan *proto.PeerMessage
+	quitch    chan struct{}
+	closeOnce sync.Once
+}
+
+func newRemotePeer(stream peerStream, v *proto.Version, inbound bool, host string) *remotePeer {
+	return &remotePeer{
+		stream:      stream,
+		version:     v,
+		inbound:     inbound,
+		features:    v.Features & localFeatures,
+		host:        host,
+		lastSeen:    time.Now(),
+		connectedAt: time.Now(),
+		known:       newKnownInventory(),
+		requested:   make(map[string]bool),
+		sendq:       make(chan *proto.PeerMessage, sendQueueSize),
+		quitch:      make(chan struct{}),
+	}
+}
+
+func (p *remotePeer) addr() string {
+	return p.version.ListenAddr
+}
+
+// id returns the hex encoded node id of the peer.
+func (p *remotePeer) id() string {
+	return hex.EncodeToString(p.version.NodeId)
+}
+
+// send queues msg for delivery. It never blocks and reports false when the
+// queue of the peer is full, or the peer does not support the message.
+func (p *remotePeer) send(msg *proto.PeerMessage) bool {
+	if !p.supports(messageFeature(msg)) {
+		return false
+	}
+	select {
+	case p.sendq <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *remotePeer) closed() bool {
+	select {
+	case <-p.quitch:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *remotePeer) close() {
+	p.closeOnce.Do(func() {
+		close(p.quitch)
+		if p.cancel != nil {
+			p.cancel()
+		}
+		if p.conn != nil {
+			p.conn.Close()
+		}
+	})
+}
+
+// Connect serves the inbound end of a peer connection. The stream lives
+// until either side drops the peer.
+func (n *Node) Connect(stream proto.Node_ConnectServer) error {
+	msg, err := recvTimeout(stream, n.timers.handshakeTimeout)
+	if err != nil {
+		return err
+	}
+	v := msg.GetVersion()
+	if v == nil {
+		return status.Error(codes.InvalidArgument, "expected version message")
+	}
+	if len(v.NodeId) != crypto.PubKeyLen || len(v.Nonce) != nonceLen {
+		return status.Error(codes.InvalidArgument, "version lacks node id or nonce")
+	}
+	if bytes.Equal(v.NodeId, n.nodeKey.Public().Bytes()) {
+		return status.Error(codes.InvalidArgument, errSelfConnection.Error())
+	}
+	if err := checkVersion(v); err != nil {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	host := ""
+	if remote, ok := peer.FromContext(stream.Context()); ok {
+		host = peerHost(remote.Addr)
+	}
+	p := newRemotePeer(stream, v, true, host)
+	if n.bans.IsBanned(p.banKey()) {
+		return status.Error(codes.PermissionDenied, errBanned.Error())
+	}
+
+	ours := n.getVersion()
+	ours.Nonce = newNonce()
+	hs := &handshake{
+		dialerID:      v.NodeId,
+		dialerNonce:   v.Nonce,
+		listenerID:    ours.NodeId,
+		listenerNonce: ours.Nonce,
+	}
+	ours.Signature = hs.sign(n.nodeKey, roleListener)
+	if err := stream.Send(versionMsg(ours)); err != nil {
+		return err
+	}
+	msg, err = recvTimeout(stream, n.timers.handshakeTimeout)
+	if err != nil {
+		return err
+	}
+	if err := hs.verify(roleDialer, msg.GetVersionAck().GetSignature()); err != nil {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	if err := n.addPeer(p); errors.Is(err, errDuplicatePeer) {
+		return status.Errorf(codes.AlreadyExists, "already connected to %s", p.id())
+	} else if err != nil {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	n.runPeer(p)
+
+	// Stop may have closed the peers before p was added
+	select {
+	case <-p.quitch:
+	case <-n.quitch:
+		n.deletePeer(p)
+	}
+	return nil
+}
+
+// connect dials addr and adds it as a peer.
+func (n *Node) connect(addr string) error {
+	if n.bans.IsBanned(banKey(hostOf(addr), addr)) {
+		return errBanned
+	}
+	p, err := n.dialRemoteNode(addr)
+	if err != nil {
+		n.addrBook.Failed(addr)
+		return err
+	}
+	n.addrBook.Good(addr)
+	if err := n.addPeer(p); err != nil {
+		p.close()
+		if errors.Is(err, errDuplicatePeer) {
+			return nil
+		}
+		return err
+	}
+	n.runPeer(p)
+	p.send(&proto.PeerMessage{Payload: &proto.PeerMessage_GetPeers{GetPeers: &proto.GetPeers{}}})
+	return nil
+}
+
+func (n *Node) dialRemoteNode(addr string) (*remotePeer, error) {
+	conn, err := grpc.Dial(addr, n.dialOption(addr))
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	fail := func(err error) (*remotePeer, error) {
+		cancel()
+		conn.Close()
+		return nil, err
+	}
+
+	stream, err := proto.NewNodeClient(conn).Connect(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	ours := n.getVersion()
+	ours.Nonce = newNonce()
+	if err := stream.Send(versionMsg(ours)); err != nil {
+		return fail(err)
+	}
+	msg, err := recvTimeout(stream, n.timers.handshakeTimeout)
+	if err != nil {
+		return fail(err)
+	}
+	v := msg.GetVersion()
+	if v == nil {
+		return fail(errors.New("expected version message"))
+	}
+	if err := checkVersion(v); err != nil {
+		return fail(err)
+	}
+	hs := &handshake{
+		dialerID:      ours.NodeId,
+		dialerNonce:   ours.Nonce,
+		listenerID:    v.NodeId,
+		listenerNonce: v.Nonce,
+	}
+	if err := hs.verify(roleListener, v.Signature); err != nil {
+		return fail(err)
+	}
+	if bytes.Equal(v.NodeId, n.nodeKey.Public().Bytes()) {
+		return fail(errSelfConnection)
+	}
+	ack := &proto.VersionAck{Signature: hs.sign(n.nodeKey, roleDialer)}
+	if err := stream.Send(&proto.PeerMessage{Payload: &proto.PeerMessage_VersionAck{VersionAck: ack}}); err != nil {
+		return fail(err)
+	}
+
+	p := newRemotePeer(stream, v, false, hostOf(addr))
+	p.dialAddr = addr
+	p.conn = conn
+	p.cancel = cancel
+	return p, nil
+}
+
+// recvTimeout receives the next message of the stream, giving up after
+// timeout.
+func recvTimeout(stream peerStream, timeout time.Duration) (*proto.PeerMessage, error) {
+	type result struct {
+		msg *proto.PeerMessage
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		msg, err := stream.Recv()
+		ch <- result{msg, err}
+	}()
+	select {
+	case r := <-ch:
+		return r.msg, r.err
+	case <-time.After(timeout):
+		return nil, errHandshakeTimeout
+	}
+}
+
+// addPeer registers p unless a peer with the same node id is already
+// connected or the peer limits do not allow it. The peers p is connected to
+// are added to the address book, only the addresses we dialed ourselves are
+// recorded as good by connect.
+func (n *Node) addPeer(p *remotePeer) error {
+	n.peerLock.Lock()
+	defer n.peerLock.Unlock()
+
+	if _, ok := n.peers[p.id()]; ok {
+		// already connected, e.g. both sides dialed each other at once
+		return errDuplicatePeer
+	}
+	if err := n.checkPeerLimits(p); err != nil {
+		return err
+	}
+	now := time.Now()
+	n.peers[p.id()] = p
+	for _, addr := range p.version.PeerList {
+		if addr != "" && addr != n.ListenAddr {
+			n.addrBook.AddFrom(addr, now, p.banKey())
+		}
+	}
+	if len(p.version.PeerList) > 0 {
+		n.wakeDialer()
+	}
+	n.logger.Debugw("new peer successfully connected",
+		"we", n.ListenAddr,
+		"remote node", p.addr(),
+		"id", p.id(),
+		"inbound", p.inbound,
+		"height", p.version.Height)
+
+	return nil
+}
+
+// runPeer starts exchanging messages with a peer that completed the
+// handshake.
+func (n *Node) runPeer(p *remotePeer) {
+	go n.sendLoop(p)
+	go n.recvLoop(p)
+}
+
+// deletePeer drops the peer and closes its connection. Bootstrap peers are
+// dialed again in the background.
+func (n *Node) deletePeer(p *remotePeer) {
+	n.peerLock.Lock()
+	defer n.peerLock.Unlock()
+	n.removePeer(p)
+}
+
+// removePeer is deletePeer for callers already holding peerLock.
+func (n *Node) removePeer(p *remotePeer) {
+	p.close()
+	if n.peers[p.id()] != p {
+		return
+	}
+	delete(n.peers, p.id())
+	n.dropRequests(p)
+	n.logger.Debugw("peer disconnected", "we", n.ListenAddr, "peer", p.addr())
+	if p.dialAddr != "" {
+		n.scheduleReconnect(p.dialAddr)
+	} else {
+		n.scheduleReconnect(p.addr())
+	}
+}
+
+// scheduleReconnect starts dialing addr again if it is a bootstrap peer. The
+// caller must hold peerLock.
+func (n *Node) scheduleReconnect(addr string) {
+	if n.bootstrapAddrs[addr] && !n.reconnecting[addr] {
+		n.reconnecting[addr] = true
+		go n.reconnect(addr)
+	}
+}
+
+func (n *Node) getPeers() []*remotePeer {
+	n.peerLock.RLock()
+	defer n.peerLock.RUnlock()
+
+	peers := make([]*remotePeer, 0, len(n.peers))
+	for _, p := range n.peers {
+		peers = append(peers, p)
+	}
+	return peers
+}
+
+// sendLoop delivers the queued messages of a peer until it is closed, so a
+// slow or failing peer does not hold up delivery to the others.
+func (n *Node) sendLoop(p *remotePeer) {
+	for {
+		select {
+		case msg := <-p.sendq:
+			if err := sendWithTimeout(p.stream, msg, n.timers.sendTimeout); err != nil {
+				n.logger.Debugw("failed to send message", "we", n.ListenAddr, "peer", p.addr(), "err", err)
+				n.deletePeer(p)
+				return
+			}
+		case <-p.quitch:
+			return
+		}
+	}
+}
+
+func sendWithTimeout(stream peerStream, msg *proto.PeerMessage, timeout time.Duration) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- stream.Send(msg)
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-time.After(timeout):
+		return errSendTimeout
+	}
+}
+
+func (n *Node) recvLoop(p *remotePeer) {
+	for {
+		msg, err := p.stream.Recv()
+		if err != nil {
+			n.logger.Debugw("peer connection closed", "we", n.ListenAddr, "peer", p.addr(), "err", err)
+			n.deletePeer(p)
+			return
+		}
+		n.handleMessage(p, msg)
+	}
+}
+
+func (n *Node) handleMessage(p *remotePeer, msg *proto.PeerMessage) {
+	if !p.supports(messageFeature(msg)) {
+		n.logger.Debugw("message of feature not negotiated", "we", n.ListenAddr, "peer", p.addr(), "type", fmt.Sprintf("%T", msg.Payload))
+		return
+	}
+	switch m := msg.Payload.(type) {
+	case *proto.PeerMessage_Ping:
+		p.send(&proto.PeerMessage{Payload: &proto.PeerMessage_Pong{Pong: &proto.Pong{
+			Nonce:  m.Ping.Nonce,
+			Height: int32(n.chain.Height()),
+		}}})
+	case *proto.PeerMessage_Pong:
+		n.peerLock.Lock()
+		if m.Pong.Nonce == p.pingNonce {
+			p.pingNonce = 0
+			p.failedPings = 0
+			p.lastSeen = time.Now()
+			p.version.Height = m.Pong.Height
+		}
+		n.peerLock.Unlock()
+	case *proto.PeerMessage_Announce:
+		n.handleAnnounce(p, m.Announce)
+	case *proto.PeerMessage_GetData:
+		n.handleGetData(p, m.GetData)
+	case *proto.PeerMessage_InventoryData:
+		n.handleData(p, m.InventoryData)
+	case *proto.PeerMessage_GetPeers:
+		addrs := &proto.PeerAddrs{Addrs: n.addrBook.Addresses(maxAddrsPerMessage)}
+		p.send(&proto.PeerMessage{Payload: &proto.PeerMessage_Addrs{Addrs: addrs}})
+	case *proto.PeerMessage_Addrs:
+		n.handleAddrs(p, m.Addrs)
+	default:
+		n.logger.Debugw("unexpected message", "we", n.ListenAddr, "peer", p.addr(), "type", fmt.Sprintf("%T", msg.Payload))
+	}
+}
+
+// heartbeatLoop pings all peers and drops the ones that stopped answering.
+// It also moves the inventory requests left unanswered to other peers.
+func (n *Node) heartbeatLoop() {
+	ticker := time.NewTicker(n.timers.pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-n.quitch:
+			return
+		}
+		for _, p := range n.getPeers() {
+			n.ping(p)
+		}
+		n.expireRequests(time.Now())
+	}
+}
+
+func (n *Node) ping(p *remotePeer) {
+	n.peerLock.Lock()
+	if p.pingNonce != 0 {
+		p.failedPings++
+	}
+	failed := p.failedPings
+	p.pingNonce = rand.Int63n(1<<62) + 1
+	nonce := p.pingNonce
+	n.peerLock.Unlock()
+
+	if failed >= maxFailedPings {
+		n.logger.Debugw("peer stopped answering pings", "we", n.ListenAddr, "peer", p.addr(), "failed", failed)
+		n.deletePeer(p)
+		return
+	}
+	p.send(&proto.PeerMessage{Payload: &proto.PeerMessage_Ping{Ping: &proto.Ping{Nonce: nonce}}})
+}
+
+// reconnect dials addr until it succeeds, backing off exponentially between
+// attempts.
+func (n *Node) reconnect(addr string) {
+	defer func() {
+		n.peerLock.Lock()
+		delete(n.reconnecting, addr)
+		n.peerLock.Unlock()
+	}()
+
+	delay := n.timers.reconnectMinDelay
+	for {
+		select {
+		case <-time.After(delay):
+		case <-n.quitch:
+			return
+		}
+		if !n.canConnectWith(addr) {
+			return
+		}
+		err := n.connect(addr)
+		if err == nil {
+			return
+		}
+		n.logger.Debugw("reconnect failed", "we", n.ListenAddr, "peer", addr, "retry", delay*2, "err", err)
+		if delay *= 2; delay > n.timers.reconnectMaxDelay {
+			delay = n.timers.reconnectMaxDelay
+		}
+	}
+}
+
+// handleAddrs adds the addresses p shared to the address book.
+func (n *Node) handleAddrs(p *remotePeer, addrs *proto.PeerAddrs) {
+	if len(addrs.Addrs) > maxAddrsPerMessage {
+		addrs.Addrs = addrs.Addrs[:maxAddrsPerMessage]
+	}
+	for _, a := range addrs.Addrs {
+		if a.Addr == "" || a.Addr == n.ListenAddr {
+			continue
+		}
+		n.addrBook.AddFrom(a.Addr, time.Unix(a.LastSeen, 0), p.banKey())
+	}
+}
+
+// addrLoop periodically asks all peers for addresses and dials new ones
+// while the node has fewer than MaxOutbound outbound connections. It also
+// dials whenever wakeDialer is called.
+func (n *Node) addrLoop() {
+	ticker := time.NewTicker(n.timers.addrInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-n.dialch:
+			n.dialAddrBook()
+			continue
+		case <-n.quitch:
+			return
+		}
+		for _, p := range n.getPeers() {
+			p.send(&proto.PeerMessage{Payload: &proto.PeerMessage_GetPeers{GetPeers: &proto.GetPeers{}}})
+		}
+		n.dialAddrBook()
+	}
+}
+
+// wakeDialer makes addrLoop dial new addresses. Calls made while a dial is
+// pending are merged into it.
+func (n *Node) wakeDialer() {
+	select {
+	case n.dialch <- struct{}{}:
+	default:
+	}
+}
+
+// startNetwork connects to the bootstrap nodes, then fills the remaining
+// outbound slots, or all of them when no bootstrap node can be reached, with
+// addresses from the address book.
+func (n *Node) startNetwork(bootstrap []string) {
+	n.bootstrapNetwork(bootstrap)
+	n.dialAddrBook()
+}
+
+// dialAddrBook dials addresses from the address book until the node has
+// MaxOutbound outbound connections or runs out of candidates.
+func (n *Node) dialAddrBook() {
+	missing := n.MaxOutbound - n.countOutbound()
+	if missing <= 0 {
+		return
+	}
+	candidates := n.addrBook.Select(missing, func(addr string) bool {
+		if !n.canConnectWith(addr) || n.bans.IsBanned(banKey(hostOf(addr), addr)) {
+			return true
+		}
+		n.peerLock.RLock()
+		defer n.peerLock.RUnlock()
+		return n.netGroupFull(netGroup(hostOf(addr)), false)
+	})
+	for _, addr := range candidates {
+		if err := n.connect(addr); err != nil {
+			n.logger.Debugw("failed to dial peer", "we", n.ListenAddr, "peer", addr, "err", err)
+		}
+	}
+}
+
+func (n *Node) countOutbound() int {
+	n.peerLock.RLock()
+	defer n.peerLock.RUnlock()
+
+	count := 0
+	for _, p := range n.peers {
+		if !p.inbound {
+			count++
+		}
+	}
+	return count
+}
+
+func (n *Node) bootstrapNetwork(addrs []string) error {
+
+	for _, addr := range addrs {
+		if !n.canConnectWith(addr) {
+			continue
+		}
+		if n.countOutbound() >= n.MaxOutbound {
+			break
+		}
+		n.logger.Debugw("dialing peer", "we", n.ListenAddr, "peer", addr)
+		if err := n.connect(addr); err != nil {
+			n.logger.Debugw("failed to dial peer", "we", n.ListenAddr, "peer", addr, "err", err)
+			n.peerLock.Lock()
+			n.scheduleReconnect(addr)
+			n.peerLock.Unlock()
+		}
+	}
+
+	return nil
+}
+
+func versionMsg(v *proto.Version) *proto.PeerMessage {
+	return &proto.PeerMessage{Payload: &proto.PeerMessage_Version{Version: v}}
+}
+
+func (n *Node) getVersion() *proto.Version {
+	return &proto.Version{
+		Version:         n.Version,
+		Height:          int32(n.chain.Height()),
+		ListenAddr:      n.ListenAddr,
+		PeerList:        n.getPeerList(),
+		NodeId:          n.nodeKey.Public().Bytes(),
+		ProtocolVersion: protocolVersion,
+		Features:        localFeatures,
+	}
+}
+
+// canConnectWith reports whether addr is worth dialing: it is not our own
+// address and we have not dialed it already. The addresses inbound peers
+// claim are not trusted here, dialing a node we are already connected to
+// is caught by its node id in addPeer.
+func (n *Node) canConnectWith(addr string) bool {
+	if addr == "" || n.ListenAddr == addr {
+		return false
+	}
+
+	n.peerLock.RLock()
+	defer n.peerLock.RUnlock()
+	for _, p := range n.peers {
+		if p.dialAddr == addr {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *Node) getPeerList() []string {
+	n.peerLock.RLock()
+	defer n.peerLock.RUnlock()
+
+	peers := []string{}
+
+	for _, p := range n.peers {
+		peers = append(peers, p.addr())
+	}
+	return peers
+}
@@ -0,0 +1,293 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/LDM-A/GoBlocker/crypto"
+	"github.com/LDM-A/GoBlocker/proto"
+	"github.com/LDM-A/GoBlocker/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// startTestNode starts a node with short liveness timers.
+func startTestNode(t *testing.T, addr string, bootstrap ...string) *Node {
+	n := newTestNode(t, ServerConfig{Version: "Blocker-1"})
+	n.timers.pingInterval = 20 * time.Millisecond
+	n.timers.reconnectMinDelay = 20 * time.Millisecond
+	go n.Start(addr, bootstrap)
+	return n
+}
+
+// testVersion returns the version of a peer with a random node id.
+func testVersion(addr string) *proto.Version {
+	return &proto.Version{
+		ListenAddr:      addr,
+		NodeId:          crypto.GeneratePrivateKey().Public().Bytes(),
+		ProtocolVersion: protocolVersion,
+		Features:        localFeatures,
+	}
+}
+
+func connectedTo(n *Node, addr string) func() bool {
+	return func() bool {
+		for _, peer := range n.getPeerList() {
+			if peer == addr {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func peerByAddr(n *Node, addr string) *remotePeer {
+	for _, p := range n.getPeers() {
+		if p.addr() == addr {
+			return p
+		}
+	}
+	return nil
+}
+
+func waitListening(t *testing.T, addr string) {
+	require.Eventually(t, func() bool {
+		c, err := net.Dial("tcp", addr)
+		if err == nil {
+			c.Close()
+		}
+		return err == nil
+	}, time.Second*5, 10*time.Millisecond)
+}
+
+// openStream opens a raw peer stream to the node listening on addr.
+func openStream(t *testing.T, addr string) proto.Node_ConnectClient {
+	waitListening(t, addr)
+	conn, err := grpc.Dial(addr, grpc.WithInsecure())
+	require.Nil(t, err)
+	t.Cleanup(func() { conn.Close() })
+	stream, err := proto.NewNodeClient(conn).Connect(context.Background())
+	require.Nil(t, err)
+	return stream
+}
+
+// fakeStream is a peer stream whose Send is replaced by send. Recv blocks
+// until the stream is closed.
+type fakeStream struct {
+	send   func(*proto.PeerMessage) error
+	closed chan struct{}
+}
+
+func (s *fakeStream) Send(msg *proto.PeerMessage) error {
+	return s.send(msg)
+}
+
+func (s *fakeStream) Recv() (*proto.PeerMessage, error) {
+	<-s.closed
+	return nil, io.EOF
+}
+
+func addFakePeer(t *testing.T, n *Node, addr string, send func(*proto.PeerMessage) error) *remotePeer {
+	stream := &fakeStream{send: send, closed: make(chan struct{})}
+	t.Cleanup(func() { close(stream.closed) })
+	p := newRemotePeer(stream, testVersion(addr), false, "")
+	require.Nil(t, n.addPeer(p))
+	n.runPeer(p)
+	return p
+}
+
+func TestHeartbeatDropsDeadPeerAndReconnects(t *testing.T) {
+	var (
+		addrA = freeAddr(t)
+		addrB = freeAddr(t)
+		a     = startTestNode(t, addrA)
+		b     = startTestNode(t, addrB, addrA)
+	)
+	require.Eventually(t, connectedTo(b, addrA), time.Second*5, 10*time.Millisecond)
+	require.Eventually(t, connectedTo(a, addrB), time.Second*5, 10*time.Millisecond)
+
+	require.Nil(t, a.Stop())
+	assert.Eventually(t, func() bool { return len(b.getPeerList()) == 0 }, time.Second*5, 10*time.Millisecond)
+
+	// the bootstrap peer comes back and is dialed again
+	a = startTestNode(t, addrA)
+	assert.Eventually(t, connectedTo(b, addrA), time.Second*5, 10*time.Millisecond)
+	assert.Eventually(t, connectedTo(a, addrB), time.Second*5, 10*time.Millisecond)
+
+	require.Nil(t, a.Stop())
+	require.Nil(t, b.Stop())
+}
+
+func TestHeartbeatDropsSilentPeer(t *testing.T) {
+	n := newTestNode(t, ServerConfig{Version: "Blocker-1"})
+	// the peer takes our pings but never answers
+	addFakePeer(t, n, "silent", func(*proto.PeerMessage) error { return nil })
+
+	for i := 0; i < maxFailedPings; i++ {
+		n.ping(n.getPeers()[0])
+	}
+	assert.True(t, connectedTo(n, "silent")())
+	n.ping(n.getPeers()[0])
+	assert.False(t, connectedTo(n, "silent")())
+}
+
+func TestRelayIsolatesPeers(t *testing.T) {
+	var (
+		n        = newTestNode(t, ServerConfig{Version: "Blocker-1"})
+		received = make(chan []byte, 10)
+		release  = make(chan struct{})
+		tx1, tx2 = randomPoolTx(), randomPoolTx()
+		relayed  = make(chan struct{})
+	)
+	defer close(release)
+	n.timers.sendTimeout = 50 * time.Millisecond
+	addFakePeer(t, n, "slow", func(*proto.PeerMessage) error {
+		<-release
+		return nil
+	})
+	addFakePeer(t, n, "failing", func(*proto.PeerMessage) error {
+		return errors.New("boom")
+	})
+	addFakePeer(t, n, "good", func(msg *proto.PeerMessage) error {
+		received <- msg.GetAnnounce().Items[0].Hash
+		return nil
+	})
+
+	go func() {
+		n.relay(txInv(tx1))
+		n.relay(txInv(tx2))
+		close(relayed)
+	}()
+	select {
+	case <-relayed:
+	case <-time.After(time.Second):
+		t.Fatal("relay blocked")
+	}
+
+	for _, want := range []*proto.Transaction{tx1, tx2} {
+		select {
+		case got := <-received:
+			assert.Equal(t, types.HashTransaction(want), got)
+		case <-time.After(time.Second):
+			t.Fatal("good peer did not receive the announcement")
+		}
+	}
+	// the failing peer and the one not taking messages in time are dropped
+	assert.Eventually(t, func() bool {
+		return !connectedTo(n, "slow")() && !connectedTo(n, "failing")()
+	}, time.Second, 10*time.Millisecond)
+	assert.True(t, connectedTo(n, "good")())
+}
+
+func TestSendQueueFull(t *testing.T) {
+	var (
+		n       = newTestNode(t, ServerConfig{Version: "Blocker-1"})
+		release = make(chan struct{})
+	)
+	defer close(release)
+	p := addFakePeer(t, n, "stuck", func(*proto.PeerMessage) error {
+		<-release
+		return nil
+	})
+	for i := 0; i < sendQueueSize+1; i++ {
+		p.send(&proto.PeerMessage{})
+	}
+	assert.False(t, p.send(&proto.PeerMessage{}))
+}
+
+func TestPeerExchange(t *testing.T) {
+	var (
+		n     = newTestNode(t, ServerConfig{Version: "Blocker-1", ListenAddr: "self"})
+		addrs = make(chan *proto.PeerAddrs, 1)
+	)
+	n.addrBook.Add("known", time.Now())
+	p := addFakePeer(t, n, "peer", func(msg *proto.PeerMessage) error {
+		if a := msg.GetAddrs(); a != nil {
+			addrs <- a
+		}
+		return nil
+	})
+
+	n.handleMessage(p, &proto.PeerMessage{Payload: &proto.PeerMessage_GetPeers{GetPeers: &proto.GetPeers{}}})
+	select {
+	case got := <-addrs:
+		shared := []string{}
+		for _, a := range got.Addrs {
+			shared = append(shared, a.Addr)
+		}
+		// the address a peer claims is not recorded before we dialed it
+		assert.ElementsMatch(t, []string{"known"}, shared)
+	case <-time.After(time.Second):
+		t.Fatal("peer did not receive addresses")
+	}
+
+	n.handleMessage(p, &proto.PeerMessage{Payload: &proto.PeerMessage_Addrs{Addrs: &proto.PeerAddrs{Addrs: []*proto.PeerAddr{
+		{Addr: "learned", LastSeen: time.Now().Unix()},
+		{Addr: "self", LastSeen: time.Now().Unix()},
+	}}}})
+	assert.Equal(t, 2, n.addrBook.Len())
+	assert.Contains(t, n.addrBook.Select(10, func(string) bool { return false }), "learned")
+}
+
+func TestStartFallsBackToAddressBook(t *testing.T) {
+	var (
+		addrA = freeAddr(t)
+		addrB = freeAddr(t)
+		file  = filepath.Join(t.TempDir(), "peers.dat")
+		b     = startTestNode(t, addrB)
+	)
+	book := NewAddressBook()
+	book.Add(addrB, time.Now())
+	require.Nil(t, book.Save(file))
+
+	// the only bootstrap node is down
+	a := newTestNode(t, ServerConfig{Version: "Blocker-1", AddressBookFile: file})
+	go a.Start(addrA, []string{freeAddr(t)})
+	assert.Eventually(t, connectedTo(a, addrB), time.Second*5, 10*time.Millisecond)
+
+	require.Nil(t, a.Stop())
+	require.Nil(t, b.Stop())
+	saved, err := LoadAddressBook(file)
+	require.Nil(t, err)
+	assert.Equal(t, 1, saved.entries[addrB].successes)
+}
+
+func TestInboundClaimDoesNotBlockDial(t *testing.T) {
+	var (
+		addrA = freeAddr(t)
+		addrB = freeAddr(t)
+		a     = startTestNode(t, addrA)
+		b     = startTestNode(t, addrB)
+	)
+	defer a.Stop()
+	defer b.Stop()
+	waitListening(t, addrB)
+
+	// an inbound peer claims the address of b
+	stream := &fakeStream{send: func(*proto.PeerMessage) error { return nil }, closed: make(chan struct{})}
+	t.Cleanup(func() { close(stream.closed) })
+	v := testVersion(addrB)
+	v.PeerList = []string{""}
+	impostor := newRemotePeer(stream, v, true, "127.0.0.1")
+	require.Nil(t, a.addPeer(impostor))
+	assert.Equal(t, 0, a.addrBook.Len())
+
+	assert.True(t, a.canConnectWith(addrB))
+	require.Nil(t, a.connect(addrB))
+	assert.Len(t, a.getPeers(), 2)
+	assert.False(t, a.canConnectWith(addrB))
+	assert.Equal(t, 1, a.addrBook.entries[addrB].successes)
+}
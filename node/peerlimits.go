@@ -0,0 +1,144 @@
+package node
+
+import (
+	"errors"
+	"net"
+	"sort"
+)
+
+const (
+	defaultMaxInbound  = 32
+	defaultMaxOutbound = 8
+	// maxPeersPerNetGroup is the number of inbound, and separately outbound,
+	// peers allowed from a single network group, so an attacker controlling
+	// a few networks can not take all our connections.
+	maxPeersPerNetGroup = 2
+	// evictProtectUseful and evictProtectOldest are the number of inbound
+	// peers protected from eviction for recently sending us new transactions
+	// or blocks, and for being connected the longest.
+	evictProtectUseful = 4
+	evictProtectOldest = 4
+)
+
+var (
+	errDuplicatePeer = errors.New("already connected")
+	errTooManyPeers  = errors.New("too many peers")
+	errNetGroupFull  = errors.New("too many peers from the same network")
+)
+
+// netGroup returns the network group of a host for the diversity rules: the
+// /16 of IPv4 addresses and the /32 of IPv6 addresses. Other hosts are their
+// own group. Loopback and empty hosts return "" and are not limited, so
+// local networks keep working.
+func netGroup(host string) string {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		if host == "localhost" {
+			return ""
+		}
+		return host
+	}
+	if ip.IsLoopback() || ip.IsUnspecified() {
+		return ""
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(16, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(32, 128)).String()
+}
+
+// hostOf returns the host part of addr.
+func hostOf(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// checkPeerLimits reports whether p may be added, evicting an inbound peer
+// to make room for it when necessary. The caller must hold peerLock.
+func (n *Node) checkPeerLimits(p *remotePeer) error {
+	if n.netGroupFull(netGroup(p.host), p.inbound) {
+		return errNetGroupFull
+	}
+	count := 0
+	for _, other := range n.peers {
+		if other.inbound == p.inbound {
+			count++
+		}
+	}
+	if !p.inbound {
+		if count >= n.MaxOutbound {
+			return errTooManyPeers
+		}
+		return nil
+	}
+	if count < n.MaxInbound {
+		return nil
+	}
+	victim := n.selectEviction()
+	if victim == nil {
+		return errTooManyPeers
+	}
+	n.logger.Debugw("evicting peer", "we", n.ListenAddr, "peer", victim.addr(), "for", p.addr())
+	n.removePeer(victim)
+	return nil
+}
+
+// netGroupFull reports whether the inbound or outbound peers already use up
+// the slots of group. The caller must hold peerLock.
+func (n *Node) netGroupFull(group string, inbound bool) bool {
+	if group == "" {
+		return false
+	}
+	count := 0
+	for _, p := range n.peers {
+		if p.inbound == inbound && netGroup(p.host) == group {
+			count++
+		}
+	}
+	return count >= maxPeersPerNetGroup
+}
+
+// selectEviction picks the inbound peer to drop for a new one. The peers
+// that most recently sent us new transactions or blocks and the ones
+// connected the longest are protected, as neither is cheap to fake. Of the
+// rest, the youngest peer of the network group with the most peers is
+// picked. It returns nil when all peers are protected. The caller must hold
+// peerLock.
+func (n *Node) selectEviction() *remotePeer {
+	candidates := []*remotePeer{}
+	for _, p := range n.peers {
+		if p.inbound {
+			candidates = append(candidates, p)
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].lastUseful.After(candidates[j].lastUseful)
+	})
+	for i := 0; i < evictProtectUseful && len(candidates) > 0 && !candidates[0].lastUseful.IsZero(); i++ {
+		candidates = candidates[1:]
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].connectedAt.Before(candidates[j].connectedAt)
+	})
+	if len(candidates) <= evictProtectOldest {
+		return nil
+	}
+	candidates = candidates[evictProtectOldest:]
+
+	groups := make(map[string][]*remotePeer)
+	largest := ""
+	for _, p := range candidates {
+		group := netGroup(p.host)
+		groups[group] = append(groups[group], p)
+		if len(groups[group]) > len(groups[largest]) {
+			largest = group
+		}
+	}
+	// candidates are sorted oldest first
+	victims := groups[largest]
+	return victims[len(victims)-1]
+}
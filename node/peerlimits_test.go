@@ -0,0 +1,88 @@
+package node
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func limitedPeer(addr, host string, inbound bool) *remotePeer {
+	return newRemotePeer(nil, testVersion(addr), inbound, host)
+}
+
+func TestNetGroup(t *testing.T) {
+	assert.Equal(t, "10.1.0.0", netGroup("10.1.2.3"))
+	assert.Equal(t, netGroup("10.1.200.3"), netGroup("10.1.2.3"))
+	assert.NotEqual(t, netGroup("10.2.2.3"), netGroup("10.1.2.3"))
+	assert.Equal(t, "2001:db8::", netGroup("2001:db8:1::1"))
+	assert.Equal(t, "", netGroup("127.0.0.1"))
+	assert.Equal(t, "", netGroup("::1"))
+	assert.Equal(t, "", netGroup(""))
+	assert.Equal(t, "example.com", netGroup("example.com"))
+}
+
+func TestPeerLimits(t *testing.T) {
+	n := newTestNode(t, ServerConfig{Version: "Blocker-1", MaxInbound: 3, MaxOutbound: 2})
+
+	out1 := limitedPeer("out1", "10.1.0.1", false)
+	require.Nil(t, n.addPeer(out1))
+	// peers are told apart by node id, not by address
+	dup := limitedPeer("elsewhere", "10.9.0.1", false)
+	dup.version.NodeId = out1.version.NodeId
+	assert.ErrorIs(t, n.addPeer(dup), errDuplicatePeer)
+	require.Nil(t, n.addPeer(limitedPeer("out2", "10.2.0.1", false)))
+	assert.ErrorIs(t, n.addPeer(limitedPeer("out3", "10.3.0.1", false)), errTooManyPeers)
+
+	// inbound peers are counted separately, per network group too
+	require.Nil(t, n.addPeer(limitedPeer("in1", "10.1.0.2", true)))
+	require.Nil(t, n.addPeer(limitedPeer("in2", "10.1.0.3", true)))
+	assert.ErrorIs(t, n.addPeer(limitedPeer("in3", "10.1.0.4", true)), errNetGroupFull)
+
+	// local peers are not limited by network group
+	for i := 0; i < maxPeersPerNetGroup+1; i++ {
+		n := newTestNode(t, ServerConfig{Version: "Blocker-1"})
+		require.Nil(t, n.addPeer(limitedPeer(fmt.Sprint("local", i), "127.0.0.1", true)))
+	}
+}
+
+func TestInboundEviction(t *testing.T) {
+	var (
+		maxInbound = evictProtectUseful + evictProtectOldest + 3
+		n          = newTestNode(t, ServerConfig{Version: "Blocker-1", MaxInbound: maxInbound})
+		start      = time.Now().Add(-time.Hour)
+	)
+	add := func(addr, host string, connectedAt, lastUseful time.Time) {
+		p := limitedPeer(addr, host, true)
+		p.connectedAt = connectedAt
+		p.lastUseful = lastUseful
+		require.Nil(t, n.addPeer(p))
+	}
+	for i := 0; i < evictProtectOldest; i++ {
+		add(fmt.Sprint("oldest", i), fmt.Sprintf("10.%d.0.1", i), start, time.Time{})
+	}
+	for i := 0; i < evictProtectUseful; i++ {
+		add(fmt.Sprint("useful", i), fmt.Sprintf("20.%d.0.1", i), time.Now(), time.Now())
+	}
+	add("crowded-old", "30.0.0.1", start.Add(time.Minute), time.Time{})
+	add("crowded-young", "30.0.0.2", time.Now(), time.Time{})
+	add("alone", "40.0.0.1", time.Now(), time.Time{})
+
+	// the youngest peer of the largest unprotected group makes room
+	require.Nil(t, n.addPeer(limitedPeer("new", "50.0.0.1", true)))
+	assert.False(t, connectedTo(n, "crowded-young")())
+	assert.True(t, connectedTo(n, "crowded-old")())
+	assert.True(t, connectedTo(n, "new")())
+	assert.Len(t, n.getPeers(), maxInbound)
+}
+
+func TestInboundEvictionSparesProtectedPeers(t *testing.T) {
+	n := newTestNode(t, ServerConfig{Version: "Blocker-1", MaxInbound: evictProtectOldest})
+	for i := 0; i < evictProtectOldest; i++ {
+		require.Nil(t, n.addPeer(limitedPeer(fmt.Sprint("peer", i), fmt.Sprintf("10.%d.0.1", i), true)))
+	}
+	assert.ErrorIs(t, n.addPeer(limitedPeer("new", "50.0.0.1", true)), errTooManyPeers)
+	assert.Len(t, n.getPeers(), evictProtectOldest)
+}
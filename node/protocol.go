@@ -0,0 +1,57 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/LDM-A/GoBlocker/proto"
+)
+
+const (
+	// protocolVersion is the version of the peer protocol this node speaks.
+	// It goes up whenever the handshake or the required messages change.
+	protocolVersion = 2
+	// minProtocolVersion is the oldest protocol version we still talk to.
+	minProtocolVersion = 2
+)
+
+// Feature bits announce the optional message types a node supports. They
+// are only used with a peer once both sides announced them, so nodes can be
+// upgraded one at a time.
+const (
+	// FeatureInventory covers Announce, GetData and InventoryData.
+	FeatureInventory uint64 = 1 << iota
+	// FeaturePeerExchange covers GetPeers and Addrs.
+	FeaturePeerExchange
+)
+
+// localFeatures are the features this node supports.
+const localFeatures = FeatureInventory | FeaturePeerExchange
+
+var errIncompatibleVersion = errors.New("incompatible protocol version")
+
+// checkVersion reports whether we can talk to a peer that sent v.
+func checkVersion(v *proto.Version) error {
+	if v.ProtocolVersion < minProtocolVersion {
+		return fmt.Errorf("%w: peer speaks protocol version %d, the oldest supported is %d",
+			errIncompatibleVersion, v.ProtocolVersion, minProtocolVersion)
+	}
+	return nil
+}
+
+// supports reports whether the feature was negotiated with the peer.
+func (p *remotePeer) supports(feature uint64) bool {
+	return p.features&feature == feature
+}
+
+// messageFeature returns the feature a message type belongs to, or 0 for
+// the messages every peer supports.
+func messageFeature(msg *proto.PeerMessage) uint64 {
+	switch msg.Payload.(type) {
+	case *proto.PeerMessage_Announce, *proto.PeerMessage_GetData, *proto.PeerMessage_InventoryData:
+		return FeatureInventory
+	case *proto.PeerMessage_GetPeers, *proto.PeerMessage_Addrs:
+		return FeaturePeerExchange
+	}
+	return 0
+}
@@ -0,0 +1,79 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/LDM-A/GoBlocker/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCheckVersion(t *testing.T) {
+	v := testVersion("peer")
+	assert.Nil(t, checkVersion(v))
+	v.ProtocolVersion = protocolVersion + 1
+	assert.Nil(t, checkVersion(v))
+	v.ProtocolVersion = minProtocolVersion - 1
+	assert.ErrorIs(t, checkVersion(v), errIncompatibleVersion)
+}
+
+func TestHandshakeRejectsOldProtocol(t *testing.T) {
+	addr := freeAddr(t)
+	n := startTestNode(t, addr)
+	defer n.Stop()
+
+	stream := openStream(t, addr)
+	v := testVersion("old")
+	v.Nonce = newNonce()
+	v.ProtocolVersion = minProtocolVersion - 1
+	require.Nil(t, stream.Send(versionMsg(v)))
+	_, err := stream.Recv()
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "protocol version")
+}
+
+func TestFeatureGating(t *testing.T) {
+	var (
+		n    = newTestNode(t, ServerConfig{Version: "Blocker-1"})
+		sent = make(chan *proto.PeerMessage, 10)
+		tx   = randomPoolTx()
+	)
+	stream := &fakeStream{
+		send:   func(msg *proto.PeerMessage) error { sent <- msg; return nil },
+		closed: make(chan struct{}),
+	}
+	defer close(stream.closed)
+	// an older node that only speaks inventory gossip
+	v := testVersion("old")
+	v.Features = FeatureInventory | 1<<40
+	p := newRemotePeer(stream, v, false, "")
+	require.Nil(t, n.addPeer(p))
+	n.runPeer(p)
+	assert.Equal(t, FeatureInventory, p.features)
+
+	assert.False(t, p.send(&proto.PeerMessage{Payload: &proto.PeerMessage_GetPeers{GetPeers: &proto.GetPeers{}}}))
+	// addresses it sends anyway are ignored
+	n.handleMessage(p, &proto.PeerMessage{Payload: &proto.PeerMessage_Addrs{Addrs: &proto.PeerAddrs{
+		Addrs: []*proto.PeerAddr{{Addr: "learned", LastSeen: time.Now().Unix()}},
+	}}})
+	assert.Equal(t, 0, n.addrBook.Len())
+
+	n.relay(txInv(tx))
+	select {
+	case msg := <-sent:
+		require.NotNil(t, msg.GetAnnounce())
+	case <-time.After(time.Second):
+		t.Fatal("peer did not receive the announcement")
+	}
+
+	p.features = 0
+	n.relay(txInv(randomPoolTx()))
+	select {
+	case msg := <-sent:
+		t.Fatalf("unexpected message %T", msg.Payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -12,6 +12,7 @@ import (
 type UTXOStorer interface {
 	Put(*UTXO) error
 	Get(string) (*UTXO, error)
+	Delete(string) error
 }
 
 type MemoryUTXOStore struct {
@@ -46,6 +47,14 @@ func (s *MemoryUTXOStore) Put(utxo *UTXO) error {
 	return nil
 }
 
+func (s *MemoryUTXOStore) Delete(key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.data, key)
+	return nil
+}
+
 type TXStorer interface {
 	Put(*proto.Transaction) error
 	Get(string) (*proto.Transaction, error)
@@ -81,9 +90,60 @@ func (s *MemoryTXStore) Put(tx *proto.Transaction) error {
 	return nil
 }
 
+// TXLocation tells which block of the main chain contains a transaction.
+type TXLocation struct {
+	BlockHash string
+	Height    int
+}
+
+type TXIndexStorer interface {
+	Put(hash string, loc *TXLocation) error
+	Get(hash string) (*TXLocation, error)
+	Delete(hash string) error
+}
+
+type MemoryTXIndexStore struct {
+	lock sync.RWMutex
+	data map[string]*TXLocation
+}
+
+func newMemoryTXIndexStore() *MemoryTXIndexStore {
+	return &MemoryTXIndexStore{
+		data: make(map[string]*TXLocation),
+	}
+}
+
+func (s *MemoryTXIndexStore) Get(hash string) (*TXLocation, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	loc, ok := s.data[hash]
+	if !ok {
+		return nil, fmt.Errorf("tx %s is not in the chain", hash)
+	}
+	return loc, nil
+}
+
+func (s *MemoryTXIndexStore) Put(hash string, loc *TXLocation) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.data[hash] = loc
+	return nil
+}
+
+func (s *MemoryTXIndexStore) Delete(hash string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.data, hash)
+	return nil
+}
+
 type BlockStorer interface {
 	Put(*proto.Block) error
 	Get(string) (*proto.Block, error)
+	Delete(string) error
 }
 
 type MemoryBlockStore struct {
@@ -107,6 +167,13 @@ func (s *MemoryBlockStore) Get(hash string) (*proto.Block, error) {
 	return block, nil
 }
 
+func (s *MemoryBlockStore) Delete(hash string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.blocks, hash)
+	return nil
+}
+
 func (s *MemoryBlockStore) Put(b *proto.Block) error {
 	s.lock.Lock()
 	defer s.lock.Unlock()
@@ -0,0 +1,45 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/LDM-A/GoBlocker/crypto"
+	"github.com/LDM-A/GoBlocker/signer"
+	"github.com/LDM-A/GoBlocker/types"
+)
+
+// ThresholdConfig makes the node seal its blocks with a threshold group key
+// whose shares are held by separate participant daemons, so no single
+// machine holds the validator key.
+type ThresholdConfig struct {
+	// GroupFile holds the public description of the signing group as
+	// written by cmd/dealer.
+	GroupFile string
+	// Participants are the addresses of the participant daemons. They are
+	// dialed with the TLS settings of the node.
+	Participants []string
+}
+
+// thresholdSigner returns the signer coordinating the participants of the
+// threshold configuration.
+func (n *Node) thresholdSigner() (*types.ThresholdSigner, error) {
+	b, err := os.ReadFile(n.Threshold.GroupFile)
+	if err != nil {
+		return nil, err
+	}
+	group := &crypto.ThresholdGroup{}
+	if err := json.Unmarshal(b, group); err != nil {
+		return nil, fmt.Errorf("invalid threshold group in %s: %w", n.Threshold.GroupFile, err)
+	}
+	participants := make([]types.Participant, len(n.Threshold.Participants))
+	for i, addr := range n.Threshold.Participants {
+		p, err := signer.NewRemoteParticipant(addr, n.dialOption(addr))
+		if err != nil {
+			return nil, err
+		}
+		participants[i] = p
+	}
+	return types.NewThresholdSigner(group, participants)
+}
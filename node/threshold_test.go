@@ -0,0 +1,52 @@
+package node
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/LDM-A/GoBlocker/crypto"
+	"github.com/LDM-A/GoBlocker/signer"
+	"github.com/LDM-A/GoBlocker/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThresholdSigner(t *testing.T) {
+	group, shares, err := crypto.GenerateThresholdKey(2, 3)
+	require.Nil(t, err)
+
+	groupFile := filepath.Join(t.TempDir(), "group.json")
+	b, err := json.Marshal(group)
+	require.Nil(t, err)
+	require.Nil(t, os.WriteFile(groupFile, b, 0644))
+
+	addrs := []string{}
+	for _, share := range shares[:2] {
+		server, err := signer.NewParticipantServer(share, "")
+		require.Nil(t, err)
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.Nil(t, err)
+		t.Cleanup(func() { ln.Close() })
+		go server.ServeListener(ln)
+		addrs = append(addrs, ln.Addr().String())
+	}
+
+	n := newTestNode(t, ServerConfig{
+		Version:   "Blocker-1",
+		Threshold: &ThresholdConfig{GroupFile: groupFile, Participants: addrs},
+	})
+
+	block, err := n.createBlock(nil)
+	require.Nil(t, err)
+	assert.Equal(t, group.GroupKey.Bytes(), block.PublicKey)
+	assert.True(t, types.VerifyBlock(block))
+
+	_, err = NewNode(ServerConfig{
+		Version:   "Blocker-1",
+		Threshold: &ThresholdConfig{GroupFile: filepath.Join(t.TempDir(), "missing.json"), Participants: addrs},
+	})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,102 @@
+package node
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// TLSConfig enables TLS for the node server and the connections it dials.
+type TLSConfig struct {
+	// CertFile and KeyFile hold the certificate of the node, which also
+	// serves as client certificate when dialing peers.
+	CertFile string
+	KeyFile  string
+	// CAFile holds the CA certificates of the network. The system roots are
+	// used when empty.
+	CAFile string
+	// RequireClientCert enables mutual TLS: only clients with a certificate
+	// signed by a CA of CAFile may connect, for permissioned networks.
+	RequireClientCert bool
+}
+
+// load returns the TLS configuration for the server and the one for dialing.
+func (c *TLSConfig) load() (server, client *tls.Config, err error) {
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading node certificate: %w", err)
+	}
+	var pool *x509.CertPool
+	if c.CAFile != "" {
+		b, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, nil, fmt.Errorf("no certificates found in %s", c.CAFile)
+		}
+	}
+	if c.RequireClientCert && pool == nil {
+		return nil, nil, errors.New("mutual TLS requires a CA file")
+	}
+
+	server = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		MinVersion:   tls.VersionTLS12,
+	}
+	if c.RequireClientCert {
+		server.ClientAuth = tls.RequireAndVerifyClientCert
+	} else if pool != nil {
+		server.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	client = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		MinVersion:   tls.VersionTLS12,
+	}
+	return server, client, nil
+}
+
+// ServerOption returns the gRPC server option serving with c, for daemons
+// that only accept connections from the nodes of the network.
+func (c *TLSConfig) ServerOption() (grpc.ServerOption, error) {
+	server, _, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	return grpc.Creds(credentials.NewTLS(server)), nil
+}
+
+// DialOption returns the transport credentials for RPC clients, like
+// wallets, to dial the node at addr serving with c.
+func (c *TLSConfig) DialOption(addr string) (grpc.DialOption, error) {
+	_, client, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	return tlsDialOption(client, addr), nil
+}
+
+// dialOption returns the transport credentials to dial addr with.
+func (n *Node) dialOption(addr string) grpc.DialOption {
+	if n.clientTLS == nil {
+		return grpc.WithInsecure()
+	}
+	return tlsDialOption(n.clientTLS, addr)
+}
+
+func tlsDialOption(client *tls.Config, addr string) grpc.DialOption {
+	cfg := client.Clone()
+	// addresses like ":3000" name the local machine
+	if cfg.ServerName = hostOf(addr); cfg.ServerName == "" {
+		cfg.ServerName = "localhost"
+	}
+	return grpc.WithTransportCredentials(credentials.NewTLS(cfg))
+}
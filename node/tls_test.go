@@ -0,0 +1,78 @@
+package node
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/LDM-A/GoBlocker/certs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// devTLS writes dev certificates for name to dir and returns the TLS
+// configuration using them.
+func devTLS(t *testing.T, dir, name string, mutual bool) *TLSConfig {
+	require.Nil(t, certs.WriteDevCerts(dir, []string{name}, nil))
+	return &TLSConfig{
+		CertFile:          filepath.Join(dir, name+".crt"),
+		KeyFile:           filepath.Join(dir, name+".key"),
+		CAFile:            filepath.Join(dir, "ca.crt"),
+		RequireClientCert: mutual,
+	}
+}
+
+func startTLSNode(t *testing.T, addr string, cfg *TLSConfig, bootstrap ...string) *Node {
+	n := newTestNode(t, ServerConfig{Version: "Blocker-1", TLS: cfg})
+	n.timers.reconnectMinDelay = 20 * time.Millisecond
+	go n.Start(addr, bootstrap)
+	return n
+}
+
+func TestMutualTLSPeers(t *testing.T) {
+	var (
+		dir   = t.TempDir()
+		addrA = freeAddr(t)
+		addrB = freeAddr(t)
+		a     = startTLSNode(t, addrA, devTLS(t, dir, "a", true))
+		b     = startTLSNode(t, addrB, devTLS(t, dir, "b", true), addrA)
+	)
+	defer a.Stop()
+	defer b.Stop()
+	assert.Eventually(t, connectedTo(b, addrA), time.Second*5, 10*time.Millisecond)
+	assert.Eventually(t, connectedTo(a, addrB), time.Second*5, 10*time.Millisecond)
+}
+
+func TestMutualTLSRejectsUnknownNodes(t *testing.T) {
+	var (
+		addrA = freeAddr(t)
+		a     = startTLSNode(t, addrA, devTLS(t, t.TempDir(), "a", true))
+		// signed by another CA
+		outsider = startTLSNode(t, freeAddr(t), devTLS(t, t.TempDir(), "outsider", false))
+		insecure = startTLSNode(t, freeAddr(t), nil)
+	)
+	defer a.Stop()
+	defer outsider.Stop()
+	defer insecure.Stop()
+	waitListening(t, addrA)
+
+	assert.NotNil(t, outsider.connect(addrA))
+	assert.NotNil(t, insecure.connect(addrA))
+	assert.Empty(t, a.getPeers())
+}
+
+func TestTLSConfigLoad(t *testing.T) {
+	cfg := devTLS(t, t.TempDir(), "a", true)
+	server, client, err := cfg.load()
+	require.Nil(t, err)
+	assert.NotNil(t, server.ClientCAs)
+	assert.Len(t, client.Certificates, 1)
+
+	cfg.CAFile = ""
+	_, _, err = cfg.load()
+	assert.NotNil(t, err)
+
+	cfg.CertFile = filepath.Join(t.TempDir(), "missing.crt")
+	_, _, err = cfg.load()
+	assert.NotNil(t, err)
+}
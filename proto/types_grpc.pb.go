@@ -22,8 +22,21 @@ const _ = grpc.SupportPackageIsVersion7
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type NodeClient interface {
-	Handshake(ctx context.Context, in *Version, opts ...grpc.CallOption) (*Version, error)
+	// Connect carries all messages between two peers over a single stream
+	// opened by the dialing node. Each side starts with its Version.
+	Connect(ctx context.Context, opts ...grpc.CallOption) (Node_ConnectClient, error)
 	HandleTransaction(ctx context.Context, in *Transaction, opts ...grpc.CallOption) (*Ack, error)
+	// Mempool inspection
+	GetMempool(ctx context.Context, in *Ack, opts ...grpc.CallOption) (*TxHashes, error)
+	GetMempoolTransaction(ctx context.Context, in *TxHash, opts ...grpc.CallOption) (*Transaction, error)
+	GetMempoolStats(ctx context.Context, in *Ack, opts ...grpc.CallOption) (*MempoolStats, error)
+	IsPending(ctx context.Context, in *TxHash, opts ...grpc.CallOption) (*PendingStatus, error)
+	// TestTransaction validates a transaction without admitting or relaying it.
+	TestTransaction(ctx context.Context, in *Transaction, opts ...grpc.CallOption) (*TestResult, error)
+	GetTransactionStatus(ctx context.Context, in *TxHash, opts ...grpc.CallOption) (*TransactionStatus, error)
+	EstimateFee(ctx context.Context, in *FeeEstimateRequest, opts ...grpc.CallOption) (*FeeEstimate, error)
+	// Hit rate of the signature cache shared by mempool and block validation
+	GetSigCacheStats(ctx context.Context, in *Ack, opts ...grpc.CallOption) (*SigCacheStats, error)
 }
 
 type nodeClient struct {
@@ -34,13 +47,35 @@ func NewNodeClient(cc grpc.ClientConnInterface) NodeClient {
 	return &nodeClient{cc}
 }
 
-func (c *nodeClient) Handshake(ctx context.Context, in *Version, opts ...grpc.CallOption) (*Version, error) {
-	out := new(Version)
-	err := c.cc.Invoke(ctx, "/Node/Handshake", in, out, opts...)
+func (c *nodeClient) Connect(ctx context.Context, opts ...grpc.CallOption) (Node_ConnectClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Node_ServiceDesc.Streams[0], "/Node/Connect", opts...)
 	if err != nil {
 		return nil, err
 	}
-	return out, nil
+	x := &nodeConnectClient{stream}
+	return x, nil
+}
+
+type Node_ConnectClient interface {
+	Send(*PeerMessage) error
+	Recv() (*PeerMessage, error)
+	grpc.ClientStream
+}
+
+type nodeConnectClient struct {
+	grpc.ClientStream
+}
+
+func (x *nodeConnectClient) Send(m *PeerMessage) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *nodeConnectClient) Recv() (*PeerMessage, error) {
+	m := new(PeerMessage)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
 }
 
 func (c *nodeClient) HandleTransaction(ctx context.Context, in *Transaction, opts ...grpc.CallOption) (*Ack, error) {
@@ -52,12 +87,97 @@ func (c *nodeClient) HandleTransaction(ctx context.Context, in *Transaction, opt
 	return out, nil
 }
 
+func (c *nodeClient) GetMempool(ctx context.Context, in *Ack, opts ...grpc.CallOption) (*TxHashes, error) {
+	out := new(TxHashes)
+	err := c.cc.Invoke(ctx, "/Node/GetMempool", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeClient) GetMempoolTransaction(ctx context.Context, in *TxHash, opts ...grpc.CallOption) (*Transaction, error) {
+	out := new(Transaction)
+	err := c.cc.Invoke(ctx, "/Node/GetMempoolTransaction", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeClient) GetMempoolStats(ctx context.Context, in *Ack, opts ...grpc.CallOption) (*MempoolStats, error) {
+	out := new(MempoolStats)
+	err := c.cc.Invoke(ctx, "/Node/GetMempoolStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeClient) IsPending(ctx context.Context, in *TxHash, opts ...grpc.CallOption) (*PendingStatus, error) {
+	out := new(PendingStatus)
+	err := c.cc.Invoke(ctx, "/Node/IsPending", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeClient) TestTransaction(ctx context.Context, in *Transaction, opts ...grpc.CallOption) (*TestResult, error) {
+	out := new(TestResult)
+	err := c.cc.Invoke(ctx, "/Node/TestTransaction", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeClient) GetTransactionStatus(ctx context.Context, in *TxHash, opts ...grpc.CallOption) (*TransactionStatus, error) {
+	out := new(TransactionStatus)
+	err := c.cc.Invoke(ctx, "/Node/GetTransactionStatus", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeClient) EstimateFee(ctx context.Context, in *FeeEstimateRequest, opts ...grpc.CallOption) (*FeeEstimate, error) {
+	out := new(FeeEstimate)
+	err := c.cc.Invoke(ctx, "/Node/EstimateFee", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeClient) GetSigCacheStats(ctx context.Context, in *Ack, opts ...grpc.CallOption) (*SigCacheStats, error) {
+	out := new(SigCacheStats)
+	err := c.cc.Invoke(ctx, "/Node/GetSigCacheStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // NodeServer is the server API for Node service.
 // All implementations must embed UnimplementedNodeServer
 // for forward compatibility
 type NodeServer interface {
-	Handshake(context.Context, *Version) (*Version, error)
+	// Connect carries all messages between two peers over a single stream
+	// opened by the dialing node. Each side starts with its Version.
+	Connect(Node_ConnectServer) error
 	HandleTransaction(context.Context, *Transaction) (*Ack, error)
+	// Mempool inspection
+	GetMempool(context.Context, *Ack) (*TxHashes, error)
+	GetMempoolTransaction(context.Context, *TxHash) (*Transaction, error)
+	GetMempoolStats(context.Context, *Ack) (*MempoolStats, error)
+	IsPending(context.Context, *TxHash) (*PendingStatus, error)
+	// TestTransaction validates a transaction without admitting or relaying it.
+	TestTransaction(context.Context, *Transaction) (*TestResult, error)
+	GetTransactionStatus(context.Context, *TxHash) (*TransactionStatus, error)
+	EstimateFee(context.Context, *FeeEstimateRequest) (*FeeEstimate, error)
+	// Hit rate of the signature cache shared by mempool and block validation
+	GetSigCacheStats(context.Context, *Ack) (*SigCacheStats, error)
 	mustEmbedUnimplementedNodeServer()
 }
 
@@ -65,12 +185,36 @@ type NodeServer interface {
 type UnimplementedNodeServer struct {
 }
 
-func (UnimplementedNodeServer) Handshake(context.Context, *Version) (*Version, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method Handshake not implemented")
+func (UnimplementedNodeServer) Connect(Node_ConnectServer) error {
+	return status.Errorf(codes.Unimplemented, "method Connect not implemented")
 }
 func (UnimplementedNodeServer) HandleTransaction(context.Context, *Transaction) (*Ack, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method HandleTransaction not implemented")
 }
+func (UnimplementedNodeServer) GetMempool(context.Context, *Ack) (*TxHashes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMempool not implemented")
+}
+func (UnimplementedNodeServer) GetMempoolTransaction(context.Context, *TxHash) (*Transaction, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMempoolTransaction not implemented")
+}
+func (UnimplementedNodeServer) GetMempoolStats(context.Context, *Ack) (*MempoolStats, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMempoolStats not implemented")
+}
+func (UnimplementedNodeServer) IsPending(context.Context, *TxHash) (*PendingStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method IsPending not implemented")
+}
+func (UnimplementedNodeServer) TestTransaction(context.Context, *Transaction) (*TestResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TestTransaction not implemented")
+}
+func (UnimplementedNodeServer) GetTransactionStatus(context.Context, *TxHash) (*TransactionStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTransactionStatus not implemented")
+}
+func (UnimplementedNodeServer) EstimateFee(context.Context, *FeeEstimateRequest) (*FeeEstimate, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EstimateFee not implemented")
+}
+func (UnimplementedNodeServer) GetSigCacheStats(context.Context, *Ack) (*SigCacheStats, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSigCacheStats not implemented")
+}
 func (UnimplementedNodeServer) mustEmbedUnimplementedNodeServer() {}
 
 // UnsafeNodeServer may be embedded to opt out of forward compatibility for this service.
@@ -84,38 +228,190 @@ func RegisterNodeServer(s grpc.ServiceRegistrar, srv NodeServer) {
 	s.RegisterService(&Node_ServiceDesc, srv)
 }
 
-func _Node_Handshake_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(Version)
+func _Node_Connect_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(NodeServer).Connect(&nodeConnectServer{stream})
+}
+
+type Node_ConnectServer interface {
+	Send(*PeerMessage) error
+	Recv() (*PeerMessage, error)
+	grpc.ServerStream
+}
+
+type nodeConnectServer struct {
+	grpc.ServerStream
+}
+
+func (x *nodeConnectServer) Send(m *PeerMessage) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *nodeConnectServer) Recv() (*PeerMessage, error) {
+	m := new(PeerMessage)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Node_HandleTransaction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Transaction)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(NodeServer).Handshake(ctx, in)
+		return srv.(NodeServer).HandleTransaction(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/Node/Handshake",
+		FullMethod: "/Node/HandleTransaction",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(NodeServer).Handshake(ctx, req.(*Version))
+		return srv.(NodeServer).HandleTransaction(ctx, req.(*Transaction))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _Node_HandleTransaction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+func _Node_GetMempool_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ack)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServer).GetMempool(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Node/GetMempool",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServer).GetMempool(ctx, req.(*Ack))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Node_GetMempoolTransaction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TxHash)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServer).GetMempoolTransaction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Node/GetMempoolTransaction",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServer).GetMempoolTransaction(ctx, req.(*TxHash))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Node_GetMempoolStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ack)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServer).GetMempoolStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Node/GetMempoolStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServer).GetMempoolStats(ctx, req.(*Ack))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Node_IsPending_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TxHash)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServer).IsPending(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Node/IsPending",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServer).IsPending(ctx, req.(*TxHash))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Node_TestTransaction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(Transaction)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(NodeServer).HandleTransaction(ctx, in)
+		return srv.(NodeServer).TestTransaction(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/Node/HandleTransaction",
+		FullMethod: "/Node/TestTransaction",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(NodeServer).HandleTransaction(ctx, req.(*Transaction))
+		return srv.(NodeServer).TestTransaction(ctx, req.(*Transaction))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Node_GetTransactionStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TxHash)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServer).GetTransactionStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Node/GetTransactionStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServer).GetTransactionStatus(ctx, req.(*TxHash))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Node_EstimateFee_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FeeEstimateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServer).EstimateFee(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Node/EstimateFee",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServer).EstimateFee(ctx, req.(*FeeEstimateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Node_GetSigCacheStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ack)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServer).GetSigCacheStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Node/GetSigCacheStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServer).GetSigCacheStats(ctx, req.(*Ack))
 	}
 	return interceptor(ctx, in, info, handler)
 }
@@ -127,14 +423,417 @@ var Node_ServiceDesc = grpc.ServiceDesc{
 	ServiceName: "Node",
 	HandlerType: (*NodeServer)(nil),
 	Methods: []grpc.MethodDesc{
-		{
-			MethodName: "Handshake",
-			Handler:    _Node_Handshake_Handler,
-		},
 		{
 			MethodName: "HandleTransaction",
 			Handler:    _Node_HandleTransaction_Handler,
 		},
+		{
+			MethodName: "GetMempool",
+			Handler:    _Node_GetMempool_Handler,
+		},
+		{
+			MethodName: "GetMempoolTransaction",
+			Handler:    _Node_GetMempoolTransaction_Handler,
+		},
+		{
+			MethodName: "GetMempoolStats",
+			Handler:    _Node_GetMempoolStats_Handler,
+		},
+		{
+			MethodName: "IsPending",
+			Handler:    _Node_IsPending_Handler,
+		},
+		{
+			MethodName: "TestTransaction",
+			Handler:    _Node_TestTransaction_Handler,
+		},
+		{
+			MethodName: "GetTransactionStatus",
+			Handler:    _Node_GetTransactionStatus_Handler,
+		},
+		{
+			MethodName: "EstimateFee",
+			Handler:    _Node_EstimateFee_Handler,
+		},
+		{
+			MethodName: "GetSigCacheStats",
+			Handler:    _Node_GetSigCacheStats_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Connect",
+			Handler:       _Node_Connect_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "proto/types.proto",
+}
+
+// AdminClient is the client API for Admin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AdminClient interface {
+	// Hosts banned for misbehaving
+	ListBans(ctx context.Context, in *Ack, opts ...grpc.CallOption) (*BanList, error)
+	ClearBans(ctx context.Context, in *ClearBansRequest, opts ...grpc.CallOption) (*ClearBansResult, error)
+}
+
+type adminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAdminClient(cc grpc.ClientConnInterface) AdminClient {
+	return &adminClient{cc}
+}
+
+func (c *adminClient) ListBans(ctx context.Context, in *Ack, opts ...grpc.CallOption) (*BanList, error) {
+	out := new(BanList)
+	err := c.cc.Invoke(ctx, "/Admin/ListBans", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ClearBans(ctx context.Context, in *ClearBansRequest, opts ...grpc.CallOption) (*ClearBansResult, error) {
+	out := new(ClearBansResult)
+	err := c.cc.Invoke(ctx, "/Admin/ClearBans", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdminServer is the server API for Admin service.
+// All implementations must embed UnimplementedAdminServer
+// for forward compatibility
+type AdminServer interface {
+	// Hosts banned for misbehaving
+	ListBans(context.Context, *Ack) (*BanList, error)
+	ClearBans(context.Context, *ClearBansRequest) (*ClearBansResult, error)
+	mustEmbedUnimplementedAdminServer()
+}
+
+// UnimplementedAdminServer must be embedded to have forward compatible implementations.
+type UnimplementedAdminServer struct {
+}
+
+func (UnimplementedAdminServer) ListBans(context.Context, *Ack) (*BanList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListBans not implemented")
+}
+func (UnimplementedAdminServer) ClearBans(context.Context, *ClearBansRequest) (*ClearBansResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ClearBans not implemented")
+}
+func (UnimplementedAdminServer) mustEmbedUnimplementedAdminServer() {}
+
+// UnsafeAdminServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AdminServer will
+// result in compilation errors.
+type UnsafeAdminServer interface {
+	mustEmbedUnimplementedAdminServer()
+}
+
+func RegisterAdminServer(s grpc.ServiceRegistrar, srv AdminServer) {
+	s.RegisterService(&Admin_ServiceDesc, srv)
+}
+
+func _Admin_ListBans_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ack)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListBans(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Admin/ListBans",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListBans(ctx, req.(*Ack))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ClearBans_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ClearBansRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ClearBans(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Admin/ClearBans",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ClearBans(ctx, req.(*ClearBansRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Admin_ServiceDesc is the grpc.ServiceDesc for Admin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Admin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "Admin",
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListBans",
+			Handler:    _Admin_ListBans_Handler,
+		},
+		{
+			MethodName: "ClearBans",
+			Handler:    _Admin_ClearBans_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "proto/types.proto",
+}
+
+// SignerClient is the client API for Signer service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SignerClient interface {
+	GetPublicKey(ctx context.Context, in *Ack, opts ...grpc.CallOption) (*SignerKey, error)
+	SignHeader(ctx context.Context, in *Header, opts ...grpc.CallOption) (*HeaderSignature, error)
+}
+
+type signerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSignerClient(cc grpc.ClientConnInterface) SignerClient {
+	return &signerClient{cc}
+}
+
+func (c *signerClient) GetPublicKey(ctx context.Context, in *Ack, opts ...grpc.CallOption) (*SignerKey, error) {
+	out := new(SignerKey)
+	err := c.cc.Invoke(ctx, "/Signer/GetPublicKey", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *signerClient) SignHeader(ctx context.Context, in *Header, opts ...grpc.CallOption) (*HeaderSignature, error) {
+	out := new(HeaderSignature)
+	err := c.cc.Invoke(ctx, "/Signer/SignHeader", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SignerServer is the server API for Signer service.
+// All implementations must embed UnimplementedSignerServer
+// for forward compatibility
+type SignerServer interface {
+	GetPublicKey(context.Context, *Ack) (*SignerKey, error)
+	SignHeader(context.Context, *Header) (*HeaderSignature, error)
+	mustEmbedUnimplementedSignerServer()
+}
+
+// UnimplementedSignerServer must be embedded to have forward compatible implementations.
+type UnimplementedSignerServer struct {
+}
+
+func (UnimplementedSignerServer) GetPublicKey(context.Context, *Ack) (*SignerKey, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPublicKey not implemented")
+}
+func (UnimplementedSignerServer) SignHeader(context.Context, *Header) (*HeaderSignature, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SignHeader not implemented")
+}
+func (UnimplementedSignerServer) mustEmbedUnimplementedSignerServer() {}
+
+// UnsafeSignerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SignerServer will
+// result in compilation errors.
+type UnsafeSignerServer interface {
+	mustEmbedUnimplementedSignerServer()
+}
+
+func RegisterSignerServer(s grpc.ServiceRegistrar, srv SignerServer) {
+	s.RegisterService(&Signer_ServiceDesc, srv)
+}
+
+func _Signer_GetPublicKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ack)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SignerServer).GetPublicKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Signer/GetPublicKey",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SignerServer).GetPublicKey(ctx, req.(*Ack))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Signer_SignHeader_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Header)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SignerServer).SignHeader(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Signer/SignHeader",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SignerServer).SignHeader(ctx, req.(*Header))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Signer_ServiceDesc is the grpc.ServiceDesc for Signer service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Signer_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "Signer",
+	HandlerType: (*SignerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetPublicKey",
+			Handler:    _Signer_GetPublicKey_Handler,
+		},
+		{
+			MethodName: "SignHeader",
+			Handler:    _Signer_SignHeader_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "proto/types.proto",
+}
+
+// ParticipantClient is the client API for Participant service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ParticipantClient interface {
+	Commit(ctx context.Context, in *Header, opts ...grpc.CallOption) (*FrostCommitment, error)
+	SignShare(ctx context.Context, in *SignShareRequest, opts ...grpc.CallOption) (*FrostSignatureShare, error)
+}
+
+type participantClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewParticipantClient(cc grpc.ClientConnInterface) ParticipantClient {
+	return &participantClient{cc}
+}
+
+func (c *participantClient) Commit(ctx context.Context, in *Header, opts ...grpc.CallOption) (*FrostCommitment, error) {
+	out := new(FrostCommitment)
+	err := c.cc.Invoke(ctx, "/Participant/Commit", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *participantClient) SignShare(ctx context.Context, in *SignShareRequest, opts ...grpc.CallOption) (*FrostSignatureShare, error) {
+	out := new(FrostSignatureShare)
+	err := c.cc.Invoke(ctx, "/Participant/SignShare", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ParticipantServer is the server API for Participant service.
+// All implementations must embed UnimplementedParticipantServer
+// for forward compatibility
+type ParticipantServer interface {
+	Commit(context.Context, *Header) (*FrostCommitment, error)
+	SignShare(context.Context, *SignShareRequest) (*FrostSignatureShare, error)
+	mustEmbedUnimplementedParticipantServer()
+}
+
+// UnimplementedParticipantServer must be embedded to have forward compatible implementations.
+type UnimplementedParticipantServer struct {
+}
+
+func (UnimplementedParticipantServer) Commit(context.Context, *Header) (*FrostCommitment, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Commit not implemented")
+}
+func (UnimplementedParticipantServer) SignShare(context.Context, *SignShareRequest) (*FrostSignatureShare, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SignShare not implemented")
+}
+func (UnimplementedParticipantServer) mustEmbedUnimplementedParticipantServer() {}
+
+// UnsafeParticipantServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ParticipantServer will
+// result in compilation errors.
+type UnsafeParticipantServer interface {
+	mustEmbedUnimplementedParticipantServer()
+}
+
+func RegisterParticipantServer(s grpc.ServiceRegistrar, srv ParticipantServer) {
+	s.RegisterService(&Participant_ServiceDesc, srv)
+}
+
+func _Participant_Commit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Header)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ParticipantServer).Commit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Participant/Commit",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ParticipantServer).Commit(ctx, req.(*Header))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Participant_SignShare_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SignShareRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ParticipantServer).SignShare(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Participant/SignShare",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ParticipantServer).SignShare(ctx, req.(*SignShareRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Participant_ServiceDesc is the grpc.ServiceDesc for Participant service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Participant_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "Participant",
+	HandlerType: (*ParticipantServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Commit",
+			Handler:    _Participant_Commit_Handler,
+		},
+		{
+			MethodName: "SignShare",
+			Handler:    _Participant_SignShare_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/types.proto",
@@ -0,0 +1,187 @@
+package signer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sync"
+
+	"github.com/LDM-A/GoBlocker/crypto"
+	"github.com/LDM-A/GoBlocker/proto"
+	"github.com/LDM-A/GoBlocker/types"
+	"google.golang.org/grpc"
+)
+
+// ParticipantServer is the daemon of a single threshold signing participant.
+// It holds one key share and, like Server, refuses to sign two different
+// headers for the same height or to go back in height.
+type ParticipantServer struct {
+	lock        sync.Mutex
+	participant *types.LocalParticipant
+	guard       *signGuard
+	proto.UnimplementedParticipantServer
+}
+
+// NewParticipantServer creates a participant daemon for the given key share.
+// If stateFile is not empty the last signed height is loaded from and
+// persisted to that file.
+func NewParticipantServer(share *crypto.KeyShare, stateFile string) (*ParticipantServer, error) {
+	guard, err := newSignGuard(stateFile)
+	if err != nil {
+		return nil, err
+	}
+	return &ParticipantServer{
+		participant: types.NewLocalParticipant(share),
+		guard:       guard,
+	}, nil
+}
+
+// Serve listens on addr and blocks until the listener fails. The options
+// should enable mutual TLS so only the validator nodes can start rounds.
+func (s *ParticipantServer) Serve(addr string, opts ...grpc.ServerOption) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.ServeListener(ln, opts...)
+}
+
+// ServeListener serves on ln and blocks until it fails.
+func (s *ParticipantServer) ServeListener(ln net.Listener, opts ...grpc.ServerOption) error {
+	grpcServer := grpc.NewServer(opts...)
+	proto.RegisterParticipantServer(grpcServer, s)
+
+	return grpcServer.Serve(ln)
+}
+
+func (s *ParticipantServer) Commit(ctx context.Context, h *proto.Header) (*proto.FrostCommitment, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.guard.check(h); err != nil {
+		return nil, err
+	}
+	commitment, err := s.participant.Commit(h)
+	if err != nil {
+		return nil, err
+	}
+	return commitmentToProto(commitment), nil
+}
+
+func (s *ParticipantServer) SignShare(ctx context.Context, req *proto.SignShareRequest) (*proto.FrostSignatureShare, error) {
+	if req.Header == nil {
+		return nil, errors.New("missing header")
+	}
+	commitments, err := commitmentsFromProto(req.Commitments)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.guard.check(req.Header); err != nil {
+		return nil, err
+	}
+	share, err := s.participant.Sign(req.Header, commitments)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.guard.record(req.Header, nil); err != nil {
+		return nil, err
+	}
+	return &proto.FrostSignatureShare{
+		Index: uint32(share.Index),
+		Value: share.Value,
+	}, nil
+}
+
+// RemoteParticipant implements types.Participant by forwarding the signing
+// rounds to a participant daemon.
+type RemoteParticipant struct {
+	conn   *grpc.ClientConn
+	client proto.ParticipantClient
+}
+
+func NewRemoteParticipant(addr string, opts ...grpc.DialOption) (*RemoteParticipant, error) {
+	conn, err := grpc.Dial(addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &RemoteParticipant{
+		conn:   conn,
+		client: proto.NewParticipantClient(conn),
+	}, nil
+}
+
+func (p *RemoteParticipant) Commit(h *proto.Header) (*crypto.SigningCommitment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), signTimeout)
+	defer cancel()
+
+	resp, err := p.client.Commit(ctx, h)
+	if err != nil {
+		return nil, err
+	}
+	return commitmentFromProto(resp)
+}
+
+func (p *RemoteParticipant) Sign(h *proto.Header, commitments []*crypto.SigningCommitment) (*crypto.SignatureShare, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), signTimeout)
+	defer cancel()
+
+	req := &proto.SignShareRequest{
+		Header:      h,
+		Commitments: make([]*proto.FrostCommitment, len(commitments)),
+	}
+	for i, c := range commitments {
+		req.Commitments[i] = commitmentToProto(c)
+	}
+	resp, err := p.client.SignShare(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Index == 0 || resp.Index > math.MaxUint16 {
+		return nil, fmt.Errorf("participant returned invalid index %d", resp.Index)
+	}
+	return &crypto.SignatureShare{
+		Index: uint16(resp.Index),
+		Value: resp.Value,
+	}, nil
+}
+
+func (p *RemoteParticipant) Close() error {
+	return p.conn.Close()
+}
+
+func commitmentToProto(c *crypto.SigningCommitment) *proto.FrostCommitment {
+	return &proto.FrostCommitment{
+		Index:   uint32(c.Index),
+		Hiding:  c.Hiding,
+		Binding: c.Binding,
+	}
+}
+
+func commitmentFromProto(c *proto.FrostCommitment) (*crypto.SigningCommitment, error) {
+	if c.Index == 0 || c.Index > math.MaxUint16 {
+		return nil, fmt.Errorf("invalid participant index %d", c.Index)
+	}
+	return &crypto.SigningCommitment{
+		Index:   uint16(c.Index),
+		Hiding:  c.Hiding,
+		Binding: c.Binding,
+	}, nil
+}
+
+func commitmentsFromProto(cc []*proto.FrostCommitment) ([]*crypto.SigningCommitment, error) {
+	commitments := make([]*crypto.SigningCommitment, len(cc))
+	for i, c := range cc {
+		commitment, err := commitmentFromProto(c)
+		if err != nil {
+			return nil, err
+		}
+		commitments[i] = commitment
+	}
+	return commitments, nil
+}
@@ -0,0 +1,81 @@
+package signer
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/LDM-A/GoBlocker/crypto"
+	"github.com/LDM-A/GoBlocker/proto"
+	"github.com/LDM-A/GoBlocker/types"
+	"github.com/LDM-A/GoBlocker/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func startParticipant(t *testing.T, share *crypto.KeyShare, stateFile string) *RemoteParticipant {
+	server, err := NewParticipantServer(share, stateFile)
+	require.Nil(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go server.ServeListener(ln)
+
+	remote, err := NewRemoteParticipant(ln.Addr().String(), grpc.WithInsecure())
+	require.Nil(t, err)
+	t.Cleanup(func() { remote.Close() })
+	return remote
+}
+
+func TestRemoteThresholdSignBlock(t *testing.T) {
+	group, shares, err := crypto.GenerateThresholdKey(2, 3)
+	require.Nil(t, err)
+
+	participants := []types.Participant{}
+	for _, share := range shares {
+		participants = append(participants, startParticipant(t, share, ""))
+	}
+	signer, err := types.NewThresholdSigner(group, participants)
+	require.Nil(t, err)
+
+	block := util.RandomBlock()
+	_, err = types.SignBlockWith(signer, block)
+	require.Nil(t, err)
+	assert.Equal(t, group.GroupKey.Bytes(), block.PublicKey)
+	assert.True(t, types.VerifyBlock(block))
+}
+
+func TestParticipantRefusesDoubleSign(t *testing.T) {
+	group, shares, err := crypto.GenerateThresholdKey(2, 2)
+	require.Nil(t, err)
+
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	signer, err := types.NewThresholdSigner(group, []types.Participant{
+		startParticipant(t, shares[0], stateFile),
+		startParticipant(t, shares[1], ""),
+	})
+	require.Nil(t, err)
+
+	header := &proto.Header{Version: 1, Height: 10, PreviousHash: util.RandomHash()}
+	_, err = signer.SignHeader(header)
+	require.Nil(t, err)
+
+	// Re-signing the exact same header is harmless.
+	_, err = signer.SignHeader(header)
+	assert.Nil(t, err)
+
+	conflicting := &proto.Header{Version: 1, Height: 10, PreviousHash: util.RandomHash()}
+	_, err = signer.SignHeader(conflicting)
+	assert.NotNil(t, err)
+
+	// the first participant remembers the height across restarts
+	restarted, err := types.NewThresholdSigner(group, []types.Participant{
+		startParticipant(t, shares[0], stateFile),
+		startParticipant(t, shares[1], ""),
+	})
+	require.Nil(t, err)
+	_, err = restarted.SignHeader(conflicting)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,81 @@
+package signer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/LDM-A/GoBlocker/crypto"
+	"github.com/LDM-A/GoBlocker/proto"
+	"github.com/LDM-A/GoBlocker/types"
+	"google.golang.org/grpc"
+)
+
+const signTimeout = time.Second * 2
+
+// RemoteSigner implements types.Signer by forwarding headers to a signing
+// daemon listening on a local unix socket.
+type RemoteSigner struct {
+	conn   *grpc.ClientConn
+	client proto.SignerClient
+	pubKey *crypto.PublicKey
+}
+
+func NewRemoteSigner(socketPath string) (*RemoteSigner, error) {
+	conn, err := grpc.Dial("unix://"+socketPath, grpc.WithInsecure())
+	if err != nil {
+		return nil, err
+	}
+	client := proto.NewSignerClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), signTimeout)
+	defer cancel()
+	resp, err := client.GetPublicKey(ctx, &proto.Ack{})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if len(resp.PublicKey) != crypto.PubKeyLen {
+		conn.Close()
+		return nil, fmt.Errorf("signer returned invalid public key length %d", len(resp.PublicKey))
+	}
+
+	return &RemoteSigner{
+		conn:   conn,
+		client: client,
+		pubKey: crypto.PublicKeyFromBytes(resp.PublicKey),
+	}, nil
+}
+
+func (s *RemoteSigner) Public() *crypto.PublicKey {
+	return s.pubKey
+}
+
+func (s *RemoteSigner) SignHeader(h *proto.Header) (*crypto.Signature, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), signTimeout)
+	defer cancel()
+
+	resp, err := s.client.SignHeader(ctx, h)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Signature) != crypto.SignatureLen {
+		return nil, fmt.Errorf("signer returned invalid signature length %d", len(resp.Signature))
+	}
+	sig := crypto.SignatureFromBytes(resp.Signature)
+	if resp.Header == nil {
+		return sig, nil
+	}
+	// the daemon signed this block before with another timestamp
+	timeStamp := h.TimeStamp
+	h.TimeStamp = resp.Header.TimeStamp
+	if !sig.Verify(s.pubKey, types.HashHeader(h)) {
+		h.TimeStamp = timeStamp
+		return nil, fmt.Errorf("signer returned an invalid header for height %d", h.Height)
+	}
+	return sig, nil
+}
+
+func (s *RemoteSigner) Close() error {
+	return s.conn.Close()
+}
@@ -0,0 +1,42 @@
+package signer
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ReadSecret reads a hex encoded secret from path, or from stdin when path
+// is "-". Secrets are kept off the command line so they do not show up in
+// the process list or the shell history. Files accessible by others are
+// refused.
+func ReadSecret(path string) ([]byte, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if info.Mode().Perm()&0077 != 0 {
+			return nil, fmt.Errorf("%s is accessible by others, its mode must be 0600", path)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	secret, err := hex.DecodeString(strings.TrimSpace(line))
+	if err != nil {
+		return nil, fmt.Errorf("secret is not hex encoded")
+	}
+	return secret, nil
+}
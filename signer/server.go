@@ -0,0 +1,215 @@
+package signer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/LDM-A/GoBlocker/crypto"
+	"github.com/LDM-A/GoBlocker/proto"
+	"github.com/LDM-A/GoBlocker/types"
+	"github.com/LDM-A/GoBlocker/util"
+	pb "github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+)
+
+// signState is the last header the daemon signed. It is written to disk
+// before a signature is handed out so a restarted daemon cannot be tricked
+// into signing a second header at the same height.
+type signState struct {
+	Height int32  `json:"height"`
+	Hash   []byte `json:"hash"`
+	// Header and Signature let the daemon hand out the signature again to a
+	// validator that lost the reply.
+	Header    []byte `json:"header,omitempty"`
+	Signature []byte `json:"signature,omitempty"`
+}
+
+// signGuard refuses to sign two different headers for the same height or to
+// go back in height. It is not safe for concurrent use.
+type signGuard struct {
+	stateFile string
+	last      *signState
+}
+
+// newSignGuard loads the last signed header from stateFile. Nothing is
+// persisted when stateFile is empty.
+func newSignGuard(stateFile string) (*signGuard, error) {
+	g := &signGuard{
+		stateFile: stateFile,
+	}
+	if stateFile == "" {
+		return g, nil
+	}
+
+	b, err := os.ReadFile(stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return g, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := &signState{}
+	if err := json.Unmarshal(b, state); err != nil {
+		return nil, fmt.Errorf("corrupt signer state file %s: %w", stateFile, err)
+	}
+	g.last = state
+
+	return g, nil
+}
+
+// check reports whether h may be signed.
+func (g *signGuard) check(h *proto.Header) error {
+	if g.last == nil {
+		return nil
+	}
+	if h.Height < g.last.Height {
+		return fmt.Errorf("refusing to sign height %d, already signed height %d", h.Height, g.last.Height)
+	}
+	if h.Height == g.last.Height && !bytes.Equal(types.HashHeader(h), g.last.Hash) {
+		return fmt.Errorf("refusing to double sign height %d", h.Height)
+	}
+	return nil
+}
+
+// signedBefore returns the last signed header and its signature if it
+// differs from h only in its timestamp.
+func (g *signGuard) signedBefore(h *proto.Header) (*proto.HeaderSignature, bool) {
+	if g.last == nil || g.last.Height != h.Height || g.last.Signature == nil {
+		return nil, false
+	}
+	signed := &proto.Header{}
+	if err := pb.Unmarshal(g.last.Header, signed); err != nil {
+		return nil, false
+	}
+	if signed.Version != h.Version ||
+		!bytes.Equal(signed.PreviousHash, h.PreviousHash) ||
+		!bytes.Equal(signed.RootHash, h.RootHash) {
+		return nil, false
+	}
+	return &proto.HeaderSignature{
+		Signature: g.last.Signature,
+		Header:    signed,
+	}, true
+}
+
+// record checks h and persists it as the last signed header together with
+// sig, if any. It must be called before the signature is handed out.
+func (g *signGuard) record(h *proto.Header, sig []byte) error {
+	if err := g.check(h); err != nil {
+		return err
+	}
+	header, err := pb.Marshal(h)
+	if err != nil {
+		return err
+	}
+	state := &signState{
+		Height:    h.Height,
+		Hash:      types.HashHeader(h),
+		Header:    header,
+		Signature: sig,
+	}
+	if err := g.saveState(state); err != nil {
+		return err
+	}
+	g.last = state
+	return nil
+}
+
+func (g *signGuard) saveState(state *signState) error {
+	if g.stateFile == "" {
+		return nil
+	}
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(g.stateFile, b, 0600)
+}
+
+// Server is the signing daemon. It holds the validator key and refuses to
+// sign two different headers for the same height or to go back in height.
+// Asked for a header that only differs in its timestamp from the one it
+// signed at that height, it returns that header and its signature instead.
+type Server struct {
+	lock  sync.Mutex
+	key   *crypto.PrivateKey
+	guard *signGuard
+	proto.UnimplementedSignerServer
+}
+
+// NewServer creates a signing daemon for the given key. If stateFile is not
+// empty the last signed height is loaded from and persisted to that file.
+func NewServer(key *crypto.PrivateKey, stateFile string) (*Server, error) {
+	guard, err := newSignGuard(stateFile)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{
+		key:   key,
+		guard: guard,
+	}, nil
+}
+
+// Serve listens on the given unix socket path and blocks until the listener
+// fails.
+func (s *Server) Serve(socketPath string) error {
+	ln, err := Listen(socketPath)
+	if err != nil {
+		return err
+	}
+	return s.ServeListener(ln)
+}
+
+// ServeListener serves on ln and blocks until it fails.
+func (s *Server) ServeListener(ln net.Listener) error {
+	grpcServer := grpc.NewServer()
+	proto.RegisterSignerServer(grpcServer, s)
+
+	return grpcServer.Serve(ln)
+}
+
+// Listen creates the unix socket at socketPath. The socket is only
+// accessible to the user running the daemon, anyone else able to connect
+// could have headers signed.
+func Listen(socketPath string) (net.Listener, error) {
+	if err := os.RemoveAll(socketPath); err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+func (s *Server) GetPublicKey(ctx context.Context, _ *proto.Ack) (*proto.SignerKey, error) {
+	return &proto.SignerKey{
+		PublicKey: s.key.Public().Bytes(),
+	}, nil
+}
+
+func (s *Server) SignHeader(ctx context.Context, h *proto.Header) (*proto.HeaderSignature, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if signed, ok := s.guard.signedBefore(h); ok {
+		return signed, nil
+	}
+	sig := s.key.Sign(types.HashHeader(h)).Bytes()
+	if err := s.guard.record(h, sig); err != nil {
+		return nil, err
+	}
+	return &proto.HeaderSignature{
+		Signature: sig,
+	}, nil
+}
@@ -0,0 +1,125 @@
+package signer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/LDM-A/GoBlocker/crypto"
+	"github.com/LDM-A/GoBlocker/proto"
+	"github.com/LDM-A/GoBlocker/types"
+	"github.com/LDM-A/GoBlocker/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startServer(t *testing.T, key *crypto.PrivateKey, stateFile string) string {
+	server, err := NewServer(key, stateFile)
+	require.Nil(t, err)
+
+	socketPath := filepath.Join(t.TempDir(), "signer.sock")
+	ln, err := Listen(socketPath)
+	require.Nil(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go server.ServeListener(ln)
+
+	return socketPath
+}
+
+func TestRemoteSignBlock(t *testing.T) {
+	key := crypto.GeneratePrivateKey()
+	remote, err := NewRemoteSigner(startServer(t, key, ""))
+	require.Nil(t, err)
+	defer remote.Close()
+
+	assert.Equal(t, key.Public().Bytes(), remote.Public().Bytes())
+
+	block := util.RandomBlock()
+	_, err = types.SignBlockWith(remote, block)
+	require.Nil(t, err)
+	assert.True(t, types.VerifyBlock(block))
+}
+
+func TestListenRestrictsSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "signer.sock")
+	ln, err := Listen(socketPath)
+	require.Nil(t, err)
+	defer ln.Close()
+
+	info, err := os.Stat(socketPath)
+	require.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestRemoteSignerRefusesDoubleSign(t *testing.T) {
+	remote, err := NewRemoteSigner(startServer(t, crypto.GeneratePrivateKey(), ""))
+	require.Nil(t, err)
+	defer remote.Close()
+
+	header := &proto.Header{Version: 1, Height: 10, PreviousHash: util.RandomHash()}
+	_, err = remote.SignHeader(header)
+	require.Nil(t, err)
+
+	// Re-signing the exact same header is harmless.
+	_, err = remote.SignHeader(header)
+	assert.Nil(t, err)
+
+	conflicting := &proto.Header{Version: 1, Height: 10, PreviousHash: util.RandomHash()}
+	_, err = remote.SignHeader(conflicting)
+	assert.NotNil(t, err)
+
+	lower := &proto.Header{Version: 1, Height: 9, PreviousHash: util.RandomHash()}
+	_, err = remote.SignHeader(lower)
+	assert.NotNil(t, err)
+}
+
+func TestServerPersistsLastSignedHeight(t *testing.T) {
+	var (
+		key       = crypto.GeneratePrivateKey()
+		stateFile = filepath.Join(t.TempDir(), "state.json")
+	)
+	server, err := NewServer(key, stateFile)
+	require.Nil(t, err)
+	_, err = server.SignHeader(context.Background(), &proto.Header{Height: 5})
+	require.Nil(t, err)
+
+	restarted, err := NewServer(key, stateFile)
+	require.Nil(t, err)
+	_, err = restarted.SignHeader(context.Background(), &proto.Header{Height: 4})
+	assert.NotNil(t, err)
+	_, err = restarted.SignHeader(context.Background(), &proto.Header{Height: 6})
+	assert.Nil(t, err)
+}
+
+func TestServerResendsSignedHeader(t *testing.T) {
+	var (
+		key       = crypto.GeneratePrivateKey()
+		stateFile = filepath.Join(t.TempDir(), "state.json")
+	)
+	remote, err := NewRemoteSigner(startServer(t, key, stateFile))
+	require.Nil(t, err)
+	defer remote.Close()
+
+	header := &proto.Header{Version: 1, Height: 3, PreviousHash: util.RandomHash(), TimeStamp: 1}
+	_, err = remote.SignHeader(header)
+	require.Nil(t, err)
+
+	// the reply got lost and the validator built the block again later
+	again := &proto.Header{Version: 1, Height: 3, PreviousHash: header.PreviousHash, TimeStamp: 2}
+	sig, err := remote.SignHeader(again)
+	require.Nil(t, err)
+	assert.Equal(t, header.TimeStamp, again.TimeStamp)
+	assert.True(t, sig.Verify(key.Public(), types.HashHeader(again)))
+
+	// a restarted daemon still knows the header
+	restarted, err := NewServer(key, stateFile)
+	require.Nil(t, err)
+	resp, err := restarted.SignHeader(context.Background(), &proto.Header{Version: 1, Height: 3, PreviousHash: header.PreviousHash, TimeStamp: 3})
+	require.Nil(t, err)
+	assert.Equal(t, header.TimeStamp, resp.Header.TimeStamp)
+
+	other := &proto.Header{Version: 1, Height: 3, PreviousHash: header.PreviousHash, RootHash: util.RandomHash(), TimeStamp: 4}
+	_, err = remote.SignHeader(other)
+	assert.NotNil(t, err)
+}
@@ -29,23 +29,35 @@ func (h TxHash) Equals(other merkletree.Content) (bool, error) {
 }
 
 func SignBlock(pk *crypto.PrivateKey, b *proto.Block) *crypto.Signature {
-	hash := HashBlock(b)
-	sig := pk.Sign(hash)
-	b.PublicKey = pk.Public().Bytes()
-	b.Signature = sig.Bytes()
+	sig, err := SignBlockWith(NewLocalSigner(pk), b)
+	if err != nil {
+		panic(err)
+	}
+	return sig
+}
 
+// SignBlockWith sets the merkle root of the block and seals the resulting
+// header with the given signer.
+func SignBlockWith(s Signer, b *proto.Block) (*crypto.Signature, error) {
 	if len(b.Transactions) > 0 {
 
 		tree, err := GetMerkleTree(b)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
 
 		b.Header.RootHash = tree.MerkleRoot()
 
 	}
 
-	return sig
+	sig, err := s.SignHeader(b.Header)
+	if err != nil {
+		return nil, err
+	}
+	b.PublicKey = s.Public().Bytes()
+	b.Signature = sig.Bytes()
+
+	return sig, nil
 }
 
 func VerifyRootHash(b *proto.Block) bool {
@@ -81,6 +93,9 @@ func GetMerkleTree(b *proto.Block) (*merkletree.MerkleTree, error) {
 
 }
 
+// VerifyBlock checks the merkle root and the block signature. The signer may
+// be a single validator key or a threshold group key, both produce plain
+// ed25519 signatures.
 func VerifyBlock(b *proto.Block) bool {
 	if len(b.Transactions) > 0 {
 		if !VerifyRootHash(b) {
@@ -0,0 +1,115 @@
+package types
+
+import (
+	"crypto/sha256"
+	"sync"
+	"sync/atomic"
+
+	"github.com/LDM-A/GoBlocker/proto"
+)
+
+// SigCache remembers input signatures that already passed verification,
+// keyed by (signing hash, public key, signature), so a transaction checked on
+// mempool admission is not verified again when it shows up in a block. Once
+// full, the oldest entries are evicted first.
+type SigCache struct {
+	lock    sync.RWMutex
+	entries map[[32]byte]struct{}
+	ring    [][32]byte
+	next    int
+
+	hits   uint64
+	misses uint64
+}
+
+type SigCacheStats struct {
+	Size   int
+	Hits   uint64
+	Misses uint64
+}
+
+// HitRate is the fraction of lookups that were served from the cache.
+func (s SigCacheStats) HitRate() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+func NewSigCache(maxEntries int) *SigCache {
+	return &SigCache{
+		entries: make(map[[32]byte]struct{}, maxEntries),
+		ring:    make([][32]byte, 0, maxEntries),
+	}
+}
+
+func (c *SigCache) Has(sigHash, pubKey, sig []byte) bool {
+	key := sigCacheKey(sigHash, pubKey, sig)
+
+	c.lock.RLock()
+	_, ok := c.entries[key]
+	c.lock.RUnlock()
+
+	if ok {
+		atomic.AddUint64(&c.hits, 1)
+	} else {
+		atomic.AddUint64(&c.misses, 1)
+	}
+	return ok
+}
+
+func (c *SigCache) Add(sigHash, pubKey, sig []byte) {
+	key := sigCacheKey(sigHash, pubKey, sig)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if cap(c.ring) == 0 {
+		return
+	}
+	if _, ok := c.entries[key]; ok {
+		return
+	}
+	if len(c.ring) < cap(c.ring) {
+		c.ring = append(c.ring, key)
+	} else {
+		delete(c.entries, c.ring[c.next])
+		c.ring[c.next] = key
+		c.next = (c.next + 1) % len(c.ring)
+	}
+	c.entries[key] = struct{}{}
+}
+
+func (c *SigCache) Stats() SigCacheStats {
+	c.lock.RLock()
+	size := len(c.entries)
+	c.lock.RUnlock()
+
+	return SigCacheStats{
+		Size:   size,
+		Hits:   atomic.LoadUint64(&c.hits),
+		Misses: atomic.LoadUint64(&c.misses),
+	}
+}
+
+// VerifyTransaction is like the package level VerifyTransaction but skips
+// signatures found in the cache and caches the ones it verifies.
+func (c *SigCache) VerifyTransaction(tx *proto.Transaction) bool {
+	return c.VerifyTransactions([]*proto.Transaction{tx}) == nil
+}
+
+func (c *SigCache) VerifyTransactions(txx []*proto.Transaction) error {
+	return verifyTransactions(txx, c)
+}
+
+func sigCacheKey(sigHash, pubKey, sig []byte) [32]byte {
+	h := sha256.New()
+	h.Write(sigHash)
+	h.Write(pubKey)
+	h.Write(sig)
+
+	var key [32]byte
+	copy(key[:], h.Sum(nil))
+	return key
+}
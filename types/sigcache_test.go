@@ -0,0 +1,49 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/LDM-A/GoBlocker/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSigCacheVerify(t *testing.T) {
+	var (
+		cache = NewSigCache(100)
+		txx   = randomSignedTransactions(10, 1)
+	)
+	assert.Nil(t, cache.VerifyTransactions(txx[:5]))
+	stats := cache.Stats()
+	assert.Equal(t, 5, stats.Size)
+	assert.Equal(t, uint64(0), stats.Hits)
+	assert.Equal(t, uint64(5), stats.Misses)
+
+	assert.Nil(t, cache.VerifyTransactions(txx))
+	stats = cache.Stats()
+	assert.Equal(t, 10, stats.Size)
+	assert.Equal(t, uint64(5), stats.Hits)
+	assert.Equal(t, uint64(10), stats.Misses)
+	assert.Equal(t, 1.0/3, stats.HitRate())
+
+	// a cached signature must not vouch for a modified transaction
+	txx[0].Outputs[0].Amount++
+	assert.False(t, cache.VerifyTransaction(txx[0]))
+}
+
+func TestSigCacheEviction(t *testing.T) {
+	cache := NewSigCache(2)
+	var (
+		a = util.RandomHash()
+		b = util.RandomHash()
+		c = util.RandomHash()
+	)
+	cache.Add(a, a, a)
+	cache.Add(b, b, b)
+	cache.Add(b, b, b)
+	cache.Add(c, c, c)
+
+	assert.Equal(t, 2, cache.Stats().Size)
+	assert.False(t, cache.Has(a, a, a))
+	assert.True(t, cache.Has(b, b, b))
+	assert.True(t, cache.Has(c, c, c))
+}
@@ -0,0 +1,152 @@
+package types
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/LDM-A/GoBlocker/crypto"
+	"github.com/LDM-A/GoBlocker/proto"
+)
+
+// Signer seals block headers on behalf of a validator. The key may live in
+// process memory or behind a remote signing daemon. SignHeader may set the
+// timestamp of h to the one of a header it signed before that is otherwise
+// the same, the signature is then for the updated header.
+type Signer interface {
+	Public() *crypto.PublicKey
+	SignHeader(h *proto.Header) (*crypto.Signature, error)
+}
+
+// LocalSigner signs with a private key held in process memory.
+type LocalSigner struct {
+	key *crypto.PrivateKey
+}
+
+func NewLocalSigner(pk *crypto.PrivateKey) *LocalSigner {
+	return &LocalSigner{
+		key: pk,
+	}
+}
+
+func (s *LocalSigner) Public() *crypto.PublicKey {
+	return s.key.Public()
+}
+
+func (s *LocalSigner) SignHeader(h *proto.Header) (*crypto.Signature, error) {
+	return s.key.Sign(HashHeader(h)), nil
+}
+
+// maxPendingRounds bounds the nonces a participant keeps for signing rounds
+// that never got to the signing step.
+const maxPendingRounds = 16
+
+// Participant holds one share of a threshold group key and takes part in the
+// two FROST rounds: it commits to fresh nonces for a header, then signs the
+// header once the commitments of all signers are known.
+type Participant interface {
+	Commit(h *proto.Header) (*crypto.SigningCommitment, error)
+	Sign(h *proto.Header, commitments []*crypto.SigningCommitment) (*crypto.SignatureShare, error)
+}
+
+// LocalParticipant is a participant whose key share is held in process
+// memory.
+type LocalParticipant struct {
+	lock   sync.Mutex
+	share  *crypto.KeyShare
+	nonces map[string]*crypto.SigningNonces
+}
+
+func NewLocalParticipant(share *crypto.KeyShare) *LocalParticipant {
+	return &LocalParticipant{
+		share:  share,
+		nonces: make(map[string]*crypto.SigningNonces),
+	}
+}
+
+func (p *LocalParticipant) Commit(h *proto.Header) (*crypto.SigningCommitment, error) {
+	nonces, commitment := p.share.Commit()
+	key := string(HashHeader(h))
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if _, ok := p.nonces[key]; !ok && len(p.nonces) >= maxPendingRounds {
+		for other := range p.nonces {
+			delete(p.nonces, other)
+			break
+		}
+	}
+	// committing again for a header replaces the nonces of the earlier round
+	p.nonces[key] = nonces
+	return commitment, nil
+}
+
+func (p *LocalParticipant) Sign(h *proto.Header, commitments []*crypto.SigningCommitment) (*crypto.SignatureShare, error) {
+	hash := HashHeader(h)
+
+	p.lock.Lock()
+	nonces, ok := p.nonces[string(hash)]
+	delete(p.nonces, string(hash))
+	p.lock.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("participant %d did not commit to header at height %d", p.share.Index, h.Height)
+	}
+	return p.share.Sign(hash, nonces, commitments)
+}
+
+// ThresholdSigner seals headers with a t-of-n threshold group key. It
+// coordinates the FROST rounds between the participants, each of which holds
+// a single key share, and needs group.Threshold of them to take part.
+type ThresholdSigner struct {
+	group        *crypto.ThresholdGroup
+	participants []Participant
+}
+
+func NewThresholdSigner(group *crypto.ThresholdGroup, participants []Participant) (*ThresholdSigner, error) {
+	if len(participants) < group.Threshold {
+		return nil, fmt.Errorf("need %d participants, got %d", group.Threshold, len(participants))
+	}
+	return &ThresholdSigner{
+		group:        group,
+		participants: participants,
+	}, nil
+}
+
+func (s *ThresholdSigner) Public() *crypto.PublicKey {
+	return s.group.GroupKey
+}
+
+// SignHeader collects commitments until the threshold is met, skipping
+// participants that fail to answer, and then signs with those participants.
+func (s *ThresholdSigner) SignHeader(h *proto.Header) (*crypto.Signature, error) {
+	var (
+		signers     = []Participant{}
+		commitments = []*crypto.SigningCommitment{}
+		lastErr     error
+	)
+	for _, p := range s.participants {
+		commitment, err := p.Commit(h)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		signers = append(signers, p)
+		commitments = append(commitments, commitment)
+		if len(signers) == s.group.Threshold {
+			break
+		}
+	}
+	if len(signers) < s.group.Threshold {
+		return nil, fmt.Errorf("only %d of %d participants committed: %v", len(signers), s.group.Threshold, lastErr)
+	}
+
+	sigShares := make([]*crypto.SignatureShare, len(signers))
+	for i, p := range signers {
+		sigShare, err := p.Sign(h, commitments)
+		if err != nil {
+			return nil, err
+		}
+		sigShares[i] = sigShare
+	}
+	return s.group.Aggregate(HashHeader(h), commitments, sigShares)
+}
@@ -0,0 +1,110 @@
+package types
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/LDM-A/GoBlocker/crypto"
+	"github.com/LDM-A/GoBlocker/proto"
+	"github.com/LDM-A/GoBlocker/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignBlockWithLocalSigner(t *testing.T) {
+	var (
+		privKey = crypto.GeneratePrivateKey()
+		signer  = NewLocalSigner(privKey)
+		block   = util.RandomBlock()
+	)
+	block.Transactions = append(block.Transactions, &proto.Transaction{Version: 1})
+
+	sig, err := SignBlockWith(signer, block)
+	require.Nil(t, err)
+	assert.Equal(t, privKey.Public().Bytes(), block.PublicKey)
+	assert.Equal(t, sig.Bytes(), block.Signature)
+	assert.True(t, VerifyBlock(block))
+}
+
+func TestSignBlockWithThresholdSigner(t *testing.T) {
+	group, shares, err := crypto.GenerateThresholdKey(2, 3)
+	require.Nil(t, err)
+
+	participants := make([]Participant, len(shares))
+	for i, share := range shares {
+		participants[i] = NewLocalParticipant(share)
+	}
+	_, err = NewThresholdSigner(group, participants[:1])
+	assert.NotNil(t, err)
+
+	signer, err := NewThresholdSigner(group, participants[1:])
+	require.Nil(t, err)
+
+	block := util.RandomBlock()
+	block.Transactions = append(block.Transactions, &proto.Transaction{Version: 1})
+	_, err = SignBlockWith(signer, block)
+	require.Nil(t, err)
+	assert.Equal(t, group.GroupKey.Bytes(), block.PublicKey)
+	assert.True(t, VerifyBlock(block))
+
+	block.Header.Height++
+	assert.False(t, VerifyBlock(block))
+}
+
+// failingParticipant never answers.
+type failingParticipant struct{}
+
+func (failingParticipant) Commit(*proto.Header) (*crypto.SigningCommitment, error) {
+	return nil, errors.New("unreachable")
+}
+
+func (failingParticipant) Sign(*proto.Header, []*crypto.SigningCommitment) (*crypto.SignatureShare, error) {
+	return nil, errors.New("unreachable")
+}
+
+func TestThresholdSignerSkipsUnreachableParticipants(t *testing.T) {
+	group, shares, err := crypto.GenerateThresholdKey(2, 3)
+	require.Nil(t, err)
+
+	signer, err := NewThresholdSigner(group, []Participant{
+		NewLocalParticipant(shares[0]),
+		failingParticipant{},
+		NewLocalParticipant(shares[2]),
+	})
+	require.Nil(t, err)
+	header := &proto.Header{Version: 1, Height: 1, PreviousHash: util.RandomHash()}
+	sig, err := signer.SignHeader(header)
+	require.Nil(t, err)
+	assert.True(t, sig.Verify(group.GroupKey, HashHeader(header)))
+
+	signer, err = NewThresholdSigner(group, []Participant{
+		NewLocalParticipant(shares[0]),
+		failingParticipant{},
+	})
+	require.Nil(t, err)
+	_, err = signer.SignHeader(header)
+	assert.NotNil(t, err)
+}
+
+func TestLocalParticipantNeedsCommitment(t *testing.T) {
+	_, shares, err := crypto.GenerateThresholdKey(2, 3)
+	require.Nil(t, err)
+
+	var (
+		p      = NewLocalParticipant(shares[0])
+		other  = NewLocalParticipant(shares[1])
+		header = &proto.Header{Version: 1, Height: 1}
+	)
+	c1, err := p.Commit(header)
+	require.Nil(t, err)
+	c2, err := other.Commit(header)
+	require.Nil(t, err)
+
+	_, err = p.Sign(&proto.Header{Version: 1, Height: 2}, []*crypto.SigningCommitment{c1, c2})
+	assert.NotNil(t, err)
+	_, err = p.Sign(header, []*crypto.SigningCommitment{c1, c2})
+	assert.Nil(t, err)
+	// the nonces are gone after signing once
+	_, err = p.Sign(header, []*crypto.SigningCommitment{c1, c2})
+	assert.NotNil(t, err)
+}
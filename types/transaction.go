@@ -2,6 +2,9 @@ package types
 
 import (
 	"crypto/sha256"
+	"fmt"
+	"runtime"
+	"sync"
 
 	"github.com/LDM-A/GoBlocker/crypto"
 	"github.com/LDM-A/GoBlocker/proto"
@@ -9,8 +12,11 @@ import (
 	pb "github.com/golang/protobuf/proto"
 )
 
+// minInputsPerWorker keeps tiny transactions from paying for goroutines.
+const minInputsPerWorker = 64
+
 func SignTransaction(pk *crypto.PrivateKey, tx *proto.Transaction) *crypto.Signature {
-	return pk.Sign(HashTransaction(tx))
+	return pk.Sign(SigningHash(tx))
 }
 
 func HashTransaction(tx *proto.Transaction) []byte {
@@ -23,20 +29,122 @@ func HashTransaction(tx *proto.Transaction) []byte {
 	return hash[:]
 }
 
+// SigningHash is the hash every input of the transaction signs. It is the
+// hash of the transaction with all input signatures left out, so inputs can be
+// signed in any order.
+func SigningHash(tx *proto.Transaction) []byte {
+	unsigned := pb.Clone(tx).(*proto.Transaction)
+	for _, input := range unsigned.Inputs {
+		input.Signature = nil
+	}
+	return HashTransaction(unsigned)
+}
+
 func VerifyTransaction(tx *proto.Transaction) bool {
-	for _, input := range tx.Inputs {
-		if len(input.Signature) == 0 {
-			panic("transaction has no signature")
+	return VerifyTransactions([]*proto.Transaction{tx}) == nil
+}
+
+// VerifyTransactions verifies the input signatures of all given transactions,
+// spreading batches of inputs over a pool of workers.
+func VerifyTransactions(txx []*proto.Transaction) error {
+	return verifyTransactions(txx, nil)
+}
+
+type sigEntry struct {
+	tx     int
+	pubKey *crypto.PublicKey
+	sig    *crypto.Signature
+	msg    []byte
+}
+
+func verifyTransactions(txx []*proto.Transaction, cache *SigCache) error {
+	hashes := make([][]byte, len(txx))
+	parallel(len(txx), 1, func(start, end int) {
+		for i := start; i < end; i++ {
+			hashes[i] = SigningHash(txx[i])
 		}
-		sig := crypto.SignatureFromBytes(input.Signature)
-		pubKey := crypto.PublicKeyFromBytes(input.PublicKey)
+	})
 
-		// FIX Make sure to prevent problems after verification cause signature is set to nil
-		input.Signature = nil
+	entries := []sigEntry{}
+	for i, tx := range txx {
+		for j, input := range tx.Inputs {
+			if len(input.Signature) != crypto.SignatureLen || len(input.PublicKey) != crypto.PubKeyLen {
+				return fmt.Errorf("transaction %d has a malformed signature on input %d", i, j)
+			}
+			if cache != nil && cache.Has(hashes[i], input.PublicKey, input.Signature) {
+				continue
+			}
+			entries = append(entries, sigEntry{
+				tx:     i,
+				pubKey: crypto.PublicKeyFromBytes(input.PublicKey),
+				sig:    crypto.SignatureFromBytes(input.Signature),
+				msg:    hashes[i],
+			})
+		}
+	}
+
+	var (
+		lock    sync.Mutex
+		invalid = -1
+	)
+	parallel(len(entries), minInputsPerWorker, func(start, end int) {
+		batch := crypto.NewBatchVerifier()
+		for _, e := range entries[start:end] {
+			batch.Add(e.pubKey, e.msg, e.sig)
+		}
+		ok, valid := batch.Verify()
+		if cache != nil {
+			for i, e := range entries[start:end] {
+				if valid[i] {
+					cache.Add(e.msg, e.pubKey.Bytes(), e.sig.Bytes())
+				}
+			}
+		}
+		if ok {
+			return
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		for i, isValid := range valid {
+			tx := entries[start+i].tx
+			if !isValid && (invalid == -1 || tx < invalid) {
+				invalid = tx
+			}
+		}
+	})
+
+	if invalid != -1 {
+		return fmt.Errorf("transaction %d has an invalid signature", invalid)
+	}
+	return nil
+}
+
+// parallel splits [0, n) into contiguous chunks of at least minChunk items
+// and runs fn on them using up to GOMAXPROCS goroutines.
+func parallel(n, minChunk int, fn func(start, end int)) {
+	workers := runtime.GOMAXPROCS(0)
+	if limit := n / minChunk; limit < workers {
+		workers = limit
+	}
+	if workers <= 1 {
+		fn(0, n)
+		return
+	}
 
-		if !sig.Verify(pubKey, HashTransaction(tx)) {
-			return false
+	var (
+		wg        sync.WaitGroup
+		chunkSize = (n + workers - 1) / workers
+	)
+	for start := 0; start < n; start += chunkSize {
+		end := start + chunkSize
+		if end > n {
+			end = n
 		}
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			fn(start, end)
+		}(start, end)
 	}
-	return true
+	wg.Wait()
 }
@@ -46,3 +46,101 @@ func TestNewTransaction(t *testing.T) {
 
 	fmt.Printf("%+v\n", tx)
 }
+
+func TestVerifyTransactionMultipleInputs(t *testing.T) {
+	var (
+		keyA = crypto.GeneratePrivateKey()
+		keyB = crypto.GeneratePrivateKey()
+		tx   = &proto.Transaction{
+			Version: 1,
+			Inputs: []*proto.TxInput{
+				{PrevTxHash: util.RandomHash(), PublicKey: keyA.Public().Bytes()},
+				{PrevTxHash: util.RandomHash(), PublicKey: keyB.Public().Bytes()},
+			},
+			Outputs: []*proto.TxOutput{{Amount: 10, Address: keyA.Public().Address().Bytes()}},
+		}
+	)
+	tx.Inputs[0].Signature = SignTransaction(keyA, tx).Bytes()
+	tx.Inputs[1].Signature = SignTransaction(keyB, tx).Bytes()
+
+	assert.True(t, VerifyTransaction(tx))
+	// verification must not touch the transaction
+	assert.True(t, VerifyTransaction(tx))
+	assert.NotNil(t, tx.Inputs[0].Signature)
+
+	tx.Inputs[1].Signature = SignTransaction(keyA, tx).Bytes()
+	assert.False(t, VerifyTransaction(tx))
+
+	tx.Inputs[1].Signature = nil
+	assert.False(t, VerifyTransaction(tx))
+}
+
+func randomSignedTransactions(nTxx, nInputs int) []*proto.Transaction {
+	txx := make([]*proto.Transaction, nTxx)
+	for i := range txx {
+		privKey := crypto.GeneratePrivateKey()
+		tx := &proto.Transaction{
+			Version: 1,
+			Outputs: []*proto.TxOutput{{Amount: 10, Address: privKey.Public().Address().Bytes()}},
+		}
+		for j := 0; j < nInputs; j++ {
+			tx.Inputs = append(tx.Inputs, &proto.TxInput{
+				PrevTxHash:   util.RandomHash(),
+				PrevOutIndex: uint32(j),
+				PublicKey:    privKey.Public().Bytes(),
+			})
+		}
+		sig := SignTransaction(privKey, tx).Bytes()
+		for _, input := range tx.Inputs {
+			input.Signature = sig
+		}
+		txx[i] = tx
+	}
+	return txx
+}
+
+func TestVerifyTransactions(t *testing.T) {
+	txx := randomSignedTransactions(300, 2)
+	assert.Nil(t, VerifyTransactions(txx))
+
+	txx[217].Outputs[0].Amount = 1000
+	err := VerifyTransactions(txx)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "transaction 217")
+}
+
+func BenchmarkVerifyTransactionsSequential(b *testing.B) {
+	for _, n := range []int{1000, 5000} {
+		txx := randomSignedTransactions(n, 1)
+		b.Run(fmt.Sprintf("inputs=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, tx := range txx {
+					hash := SigningHash(tx)
+					for _, input := range tx.Inputs {
+						sig := crypto.SignatureFromBytes(input.Signature)
+						sig.Verify(crypto.PublicKeyFromBytes(input.PublicKey), hash)
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkVerifyTransactions(b *testing.B) {
+	for _, n := range []int{1000, 5000} {
+		txx := randomSignedTransactions(n, 1)
+		b.Run(fmt.Sprintf("inputs=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				VerifyTransactions(txx)
+			}
+		})
+	}
+}
+
+func BenchmarkVerifyTransactionManyInputs(b *testing.B) {
+	tx := randomSignedTransactions(1, 5000)[0]
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		VerifyTransaction(tx)
+	}
+}